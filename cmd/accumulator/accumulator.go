@@ -8,11 +8,18 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"sync"
 	"time"
 
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	jsoniter "github.com/json-iterator/go"
 	liquiditytypes "github.com/tendermint/liquidity/x/liquidity/types"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/event"
+	"github.com/b-harvest/gravity-dex-backend/service/price"
+	"github.com/b-harvest/gravity-dex-backend/service/pricetable"
 )
 
 const TimeBucketKeyFormat = "2006-01-02T15:04:05"
@@ -22,12 +29,26 @@ type AccumulatorConfig struct {
 	NumWorkers       int
 	TimeUnit         time.Duration
 	WatchedAddresses []string
+	WatchFile        string // file of watched addresses, reloaded when modified
+	WatchOutput      string // file to append watch records to; stdout if empty
+	WatchFormat      string
+	WatchWebhook     string        // url to POST watch records to
+	CompactAfter     time.Duration // time buckets older than this are compacted, if positive
+	CompactUnit      time.Duration
+	PriceConfigFile  string // gdex config file whose 'server.price' and 'server.pricetable' are used to get current prices
+	PriceHistoryFile string // see LoadPriceHistory
 }
 
 type Accumulator struct {
-	cfg              AccumulatorConfig
-	cm               *CacheManager
-	watchedAddresses map[string]struct{}
+	cfg           AccumulatorConfig
+	cm            *CacheManager
+	watchList     *WatchList
+	watchExporter WatchExporter
+	cache         *Cache // lazily loaded by Run
+	ps            PriceSource
+	psUpdated     bool // whether ps has been updated at least once
+	watchMux      sync.Mutex
+	watchRecords  []WatchRecord // accumulated but not exported yet
 }
 
 func NewAccumulator(cfg AccumulatorConfig, cm *CacheManager) (*Accumulator, error) {
@@ -37,20 +58,138 @@ func NewAccumulator(cfg AccumulatorConfig, cm *CacheManager) (*Accumulator, erro
 	if cfg.TimeUnit == 0 {
 		cfg.TimeUnit = time.Hour
 	}
+	if cfg.CompactUnit == 0 {
+		cfg.CompactUnit = 24 * time.Hour
+	}
+	if cfg.CompactAfter > 0 && cfg.CompactUnit%cfg.TimeUnit != 0 {
+		return nil, fmt.Errorf("compaction unit must be a multiple of %s", cfg.TimeUnit)
+	}
 	if _, err := os.Stat(cfg.BlockDataDir); err != nil {
 		return nil, fmt.Errorf("check block data dir: %w", err)
 	}
+	if cfg.WatchFormat == "" {
+		cfg.WatchFormat = WatchFormatText
+	}
+	wl, err := NewWatchList(cfg.WatchedAddresses, cfg.WatchFile)
+	if err != nil {
+		return nil, fmt.Errorf("load watch list: %w", err)
+	}
 	acc := &Accumulator{
-		cfg:              cfg,
-		cm:               cm,
-		watchedAddresses: make(map[string]struct{}),
+		cfg:       cfg,
+		cm:        cm,
+		watchList: wl,
 	}
-	for _, addr := range cfg.WatchedAddresses {
-		acc.watchedAddresses[addr] = struct{}{}
+	if err := acc.setupWatchExporter(); err != nil {
+		return nil, fmt.Errorf("setup watch exporter: %w", err)
+	}
+	if err := acc.setupPriceSource(); err != nil {
+		acc.Close()
+		return nil, fmt.Errorf("setup price source: %w", err)
 	}
 	return acc, nil
 }
 
+func (acc *Accumulator) setupWatchExporter() error {
+	var es multiWatchExporter
+	if acc.cfg.WatchOutput == "" {
+		e, err := NewWriterWatchExporter(os.Stdout, acc.cfg.WatchFormat)
+		if err != nil {
+			return err
+		}
+		es = append(es, e)
+	} else {
+		e, err := NewFileWatchExporter(acc.cfg.WatchOutput, acc.cfg.WatchFormat)
+		if err != nil {
+			return fmt.Errorf("open watch output: %w", err)
+		}
+		es = append(es, e)
+	}
+	if acc.cfg.WatchWebhook != "" {
+		es = append(es, NewWebhookWatchExporter(acc.cfg.WatchWebhook))
+	}
+	acc.watchExporter = es
+	return nil
+}
+
+func (acc *Accumulator) Close() error {
+	return acc.watchExporter.Close()
+}
+
+// addWatchRecord buffers the record if its address is watched.
+// Buffered records are exported by ExportWatchRecords, after the accumulated
+// data is saved, so that blocks accumulated again after a failure do not
+// export their records twice.
+func (acc *Accumulator) addWatchRecord(r WatchRecord, pool liquiditytypes.Pool) {
+	if !acc.watchList.Contains(r.Address) {
+		return
+	}
+	r.PoolID = pool.Id
+	r.PoolDenoms = pool.ReserveCoinDenoms
+	acc.watchMux.Lock()
+	defer acc.watchMux.Unlock()
+	acc.watchRecords = append(acc.watchRecords, r)
+}
+
+// ExportWatchRecords exports the buffered watch records in height order.
+func (acc *Accumulator) ExportWatchRecords(ctx context.Context) error {
+	acc.watchMux.Lock()
+	rs := acc.watchRecords
+	acc.watchRecords = nil
+	acc.watchMux.Unlock()
+	// Records of a block are buffered in order by a single worker.
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].Height < rs[j].Height
+	})
+	for _, r := range rs {
+		if err := acc.watchExporter.Export(ctx, r); err != nil {
+			return fmt.Errorf("export watch record: %w", err)
+		}
+	}
+	return nil
+}
+
+// discardWatchRecords drops the buffered watch records of data which is not saved.
+func (acc *Accumulator) discardWatchRecords() {
+	acc.watchMux.Lock()
+	defer acc.watchMux.Unlock()
+	acc.watchRecords = nil
+}
+
+func (acc *Accumulator) setupPriceSource() error {
+	var gdexCfg config.Config
+	ptCfg := pricetable.DefaultConfig
+	if acc.cfg.PriceConfigFile != "" {
+		var err error
+		gdexCfg, err = config.Load(acc.cfg.PriceConfigFile)
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+		ptCfg = gdexCfg.Server.PriceTable
+		if err := ptCfg.Validate(); err != nil {
+			return fmt.Errorf("validate 'server.pricetable' field: %w", err)
+		}
+	}
+	switch {
+	case acc.cfg.PriceHistoryFile != "":
+		h, err := LoadPriceHistory(acc.cfg.PriceHistoryFile, ptCfg.DenomMetadataMap())
+		if err != nil {
+			return fmt.Errorf("load price history: %w", err)
+		}
+		acc.ps = h
+	case acc.cfg.PriceConfigFile != "":
+		if err := gdexCfg.Server.Price.Validate(); err != nil {
+			return fmt.Errorf("validate 'server.price' field: %w", err)
+		}
+		ps, err := price.NewService(gdexCfg.Server.Price)
+		if err != nil {
+			return fmt.Errorf("new price service: %w", err)
+		}
+		acc.ps = NewLivePriceSource(pricetable.NewService(ptCfg, ps))
+		log.Printf("past transactions are valued at current prices; use --price-history to value them at their own time")
+	}
+	return nil
+}
+
 func (acc *Accumulator) LatestBlockBucket() (int64, error) {
 	es, err := os.ReadDir(acc.cfg.BlockDataDir)
 	if err != nil {
@@ -146,37 +285,47 @@ func (acc *Accumulator) UpdateData(ctx context.Context, blockData *BlockData, da
 		}
 		switch evt.Type {
 		case liquiditytypes.EventTypeDepositToPool:
-			evt, err := NewDepositEvent(evt)
+			evt, err := event.DecodeDepositToPool(evt)
 			if err != nil {
 				return fmt.Errorf("extract deposit event: %w", err)
 			}
-			if _, ok := acc.watchedAddresses[evt.DepositorAddress]; ok {
+			if acc.watchList.Contains(evt.Depositor) {
 				pool, ok := poolByID[evt.PoolID]
 				if !ok {
 					return fmt.Errorf("pool %d nout found", evt.PoolID)
 				}
-				fmt.Printf("[%d/%s] %s deposits %v to %s/%s pool\n",
-					height, t.Format(time.RFC3339), evt.DepositorAddress, evt.AcceptedCoins,
-					pool.ReserveCoinDenoms[0], pool.ReserveCoinDenoms[1])
+				acc.addWatchRecord(WatchRecord{
+					Type:    WatchRecordTypeDeposit,
+					Height:  height,
+					Time:    t,
+					Address: evt.Depositor,
+					Coins:   evt.AcceptedCoins.String(),
+				}, pool)
 			}
-			data.DepositCoins(bucketKey, evt.PoolID, evt.AcceptedCoins)
+			data.DepositCoins(bucketKey, evt.PoolID, evt.AcceptedCoins, USDValue(acc.ps, evt.AcceptedCoins, t))
+			data.TimeBucket(bucketKey).AddActiveAddress(evt.Depositor)
 		case liquiditytypes.EventTypeWithdrawFromPool:
-			evt, err := NewWithdrawEvent(evt)
+			evt, err := event.DecodeWithdrawFromPool(evt)
 			if err != nil {
 				return fmt.Errorf("extract withdraw event: %w", err)
 			}
-			if _, ok := acc.watchedAddresses[evt.WithdrawerAddress]; ok {
+			if acc.watchList.Contains(evt.Withdrawer) {
 				pool, ok := poolByID[evt.PoolID]
 				if !ok {
 					return fmt.Errorf("pool %d nout found", evt.PoolID)
 				}
-				fmt.Printf("[%d/%s] %s withdraws %v to %s/%s pool\n",
-					height, t.Format(time.RFC3339), evt.WithdrawerAddress, evt.WithdrawnCoins,
-					pool.ReserveCoinDenoms[0], pool.ReserveCoinDenoms[1])
+				acc.addWatchRecord(WatchRecord{
+					Type:    WatchRecordTypeWithdraw,
+					Height:  height,
+					Time:    t,
+					Address: evt.Withdrawer,
+					Coins:   evt.WithdrawnCoins.String(),
+				}, pool)
 			}
-			data.WithdrawCoins(bucketKey, evt.PoolID, evt.WithdrawnCoins)
+			data.WithdrawCoins(bucketKey, evt.PoolID, evt.WithdrawnCoins, USDValue(acc.ps, evt.WithdrawnCoins, t))
+			data.TimeBucket(bucketKey).AddActiveAddress(evt.Withdrawer)
 		case liquiditytypes.EventTypeSwapTransacted:
-			evt, err := NewSwapEvent(evt, poolByID)
+			evt, err := event.DecodeSwapTransacted(evt)
 			if err != nil {
 				return fmt.Errorf("extract swap event: %w", err)
 			}
@@ -184,12 +333,23 @@ func (acc *Accumulator) UpdateData(ctx context.Context, blockData *BlockData, da
 			if !ok {
 				return fmt.Errorf("pool %d not found", evt.PoolID)
 			}
-			if _, ok := acc.watchedAddresses[evt.SwapRequesterAddress]; ok {
-				fmt.Printf("[%d/%s] %s swaps %s to %s in %s/%s pool\n",
-					height, t.Format(time.RFC3339), evt.SwapRequesterAddress, evt.ExchangedOfferCoin,
-					evt.ExchangedDemandCoin, pool.ReserveCoinDenoms[0], pool.ReserveCoinDenoms[1])
+			demandCoinDenom, ok := event.OppositeReserveCoinDenom(pool, evt.ExchangedOfferCoin.Denom)
+			if !ok {
+				return fmt.Errorf("opposite reserve coin denom for %s in pool %d not found", evt.ExchangedOfferCoin.Denom, evt.PoolID)
 			}
-			data.SwapCoin(bucketKey, evt.PoolID, evt.ExchangedOfferCoin, evt.ExchangedDemandCoin)
+			demandCoin := evt.DemandCoin(evt.ExchangedOfferCoin, demandCoinDenom)
+			acc.addWatchRecord(WatchRecord{
+				Type:       WatchRecordTypeSwap,
+				Height:     height,
+				Time:       t,
+				Address:    evt.SwapRequester,
+				OfferCoin:  evt.ExchangedOfferCoin.String(),
+				DemandCoin: demandCoin.String(),
+				SwapPrice:  evt.SwapPrice.String(),
+			}, pool)
+			data.SwapCoin(bucketKey, evt.PoolID, evt.ExchangedOfferCoin, demandCoin,
+				USDValue(acc.ps, sdk.NewCoins(evt.ExchangedOfferCoin), t), USDValue(acc.ps, sdk.NewCoins(demandCoin), t))
+			data.TimeBucket(bucketKey).AddActiveAddress(evt.SwapRequester)
 		}
 	}
 	return nil
@@ -199,6 +359,23 @@ func (acc *Accumulator) Accumulate(ctx context.Context, data *Data, startHeight,
 	if data == nil {
 		data = NewData()
 	}
+	if reloaded, err := acc.watchList.Reload(); err != nil {
+		return nil, fmt.Errorf("reload watch list: %w", err)
+	} else if reloaded {
+		log.Printf("reloaded watch list; %d addresses", acc.watchList.Len())
+	}
+	if acc.ps != nil {
+		// Keep accumulating with the previous prices if they are not available
+		// at the moment, rather than stopping until they are.
+		if err := acc.ps.Update(ctx); err != nil {
+			if !acc.psUpdated {
+				return nil, fmt.Errorf("update prices: %w", err)
+			}
+			log.Printf("failed to update prices, using the previous prices: %v", err)
+		} else {
+			acc.psUpdated = true
+		}
+	}
 	jobs := make(chan int64, endHeight-startHeight)
 
 	worker := func(ctx context.Context) error {
@@ -243,21 +420,30 @@ func (acc *Accumulator) Accumulate(ctx context.Context, data *Data, startHeight,
 }
 
 func (acc *Accumulator) Run(ctx context.Context) error {
-	c, err := acc.cm.Get(ctx)
-	if err != nil {
-		return fmt.Errorf("get cache: %w", err)
-	}
-	var data *Data
-	blockHeight := int64(1)
-	if c != nil {
-		data = c.Data
-		blockHeight = c.BlockHeight
+	if err := acc.run(ctx); err != nil {
+		runFailures.Inc()
+		return err
 	}
+	latestBlockHeight.Set(float64(acc.cache.BlockHeight))
+	return nil
+}
 
-	if blockHeight > 1 {
-		log.Printf("last cached block height: %v", c.BlockHeight)
-	} else {
-		log.Printf("no cache found")
+func (acc *Accumulator) run(ctx context.Context) error {
+	if acc.cache == nil {
+		c, err := acc.cm.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("load cache: %w", err)
+		}
+		if c != nil {
+			if c.Data.TimeUnit != acc.cfg.TimeUnit {
+				return fmt.Errorf("time unit of the cache is %s, not %s", c.Data.TimeUnit, acc.cfg.TimeUnit)
+			}
+			log.Printf("last cached block height: %v", c.BlockHeight)
+		} else {
+			log.Printf("no cache found")
+			c = &Cache{Data: NewData()}
+		}
+		acc.cache = c
 	}
 
 	h, err := acc.LatestBlockHeight()
@@ -265,25 +451,44 @@ func (acc *Accumulator) Run(ctx context.Context) error {
 		return fmt.Errorf("get latest block height: %w", err)
 	}
 
-	if blockHeight >= h {
+	if acc.cache.BlockHeight >= h {
 		log.Printf("the state is up to date")
 	} else {
-		log.Printf("accumulating from %d to %d", blockHeight, h)
+		log.Printf("accumulating from %d to %d", acc.cache.BlockHeight+1, h)
 
 		started := time.Now()
-		data, err = acc.Accumulate(ctx, data, blockHeight, h)
+		data, err := acc.Accumulate(ctx, acc.cache.Data, acc.cache.BlockHeight+1, h)
 		if err != nil {
+			acc.cache = nil // the data may have been partially updated
+			acc.discardWatchRecords()
 			return fmt.Errorf("run accumulator: %w", err)
 		}
 		log.Printf("accumulated state in %s", time.Since(started))
+		runDuration.Observe(time.Since(started).Seconds())
+
+		// Compaction is done only along with new blocks, so that the deleted
+		// time buckets are recorded at a new block height.
+		if acc.cfg.CompactAfter > 0 {
+			if n := data.Compact(time.Now().Add(-acc.cfg.CompactAfter), acc.cfg.CompactUnit); n > 0 {
+				log.Printf("compacted %d time buckets", n)
+			}
+		}
 
-		if err := acc.cm.Set(ctx, &Cache{
+		c := &Cache{
 			BlockHeight: h,
 			Data:        data,
-		}); err != nil {
+		}
+		if err := acc.cm.Set(ctx, c); err != nil {
+			acc.cache = nil
+			acc.discardWatchRecords()
 			return fmt.Errorf("set cache: %w", err)
 		}
+		acc.cache = c
 		log.Printf("saved cache")
+
+		if err := acc.ExportWatchRecords(ctx); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+	liquiditytypes "github.com/tendermint/liquidity/x/liquidity/types"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+)
+
+func writeTestBlockData(t *testing.T, acc *Accumulator, blockData *BlockData) {
+	name := acc.BlockDataFilename(blockData.Header.Height)
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+	bz, err := jsoniter.Marshal(blockData)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(name, bz, 0644))
+}
+
+type flakyPriceSource struct {
+	fail    bool
+	updates int
+}
+
+func (s *flakyPriceSource) Update(context.Context) error {
+	if s.fail {
+		return errors.New("price api unavailable")
+	}
+	s.updates++
+	return nil
+}
+
+func (s *flakyPriceSource) Price(string, time.Time) (float64, bool) {
+	return 1, s.updates > 0
+}
+
+func TestAccumulator_Accumulate_PriceUpdateFailure(t *testing.T) {
+	dir := t.TempDir()
+	wl, err := NewWatchList(nil, "")
+	require.NoError(t, err)
+	ps := &flakyPriceSource{fail: true}
+	acc := &Accumulator{
+		cfg:       AccumulatorConfig{BlockDataDir: dir, NumWorkers: 1, TimeUnit: time.Hour},
+		watchList: wl,
+		ps:        ps,
+	}
+	writeTestBlockData(t, acc, &BlockData{Header: tmproto.Header{Height: 1, Time: testTime}})
+
+	ctx := context.Background()
+	// Without any prices to fall back on, accumulation fails.
+	_, err = acc.Accumulate(ctx, nil, 1, 1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "update prices")
+
+	ps.fail = false
+	_, err = acc.Accumulate(ctx, nil, 1, 1)
+	require.NoError(t, err)
+
+	// Once updated, the previous prices are used while updates fail.
+	ps.fail = true
+	_, err = acc.Accumulate(ctx, nil, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, ps.updates)
+}
+
+func TestAccumulator_ExportWatchRecords(t *testing.T) {
+	wl, err := NewWatchList([]string{"addr1"}, "")
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	e, err := NewWriterWatchExporter(&buf, WatchFormatText)
+	require.NoError(t, err)
+	acc := &Accumulator{
+		cfg:           AccumulatorConfig{BlockDataDir: t.TempDir(), NumWorkers: 2, TimeUnit: time.Hour},
+		watchList:     wl,
+		watchExporter: e,
+	}
+	pool := liquiditytypes.Pool{Id: 1, ReserveCoinDenoms: []string{"uatom", "uusd"}, PoolCoinDenom: "pool1"}
+	for h := int64(1); h <= 3; h++ {
+		var events []abcitypes.Event
+		for _, depositor := range []string{"addr1", "addr2"} {
+			evt := abcitypes.Event{Type: liquiditytypes.EventTypeDepositToPool}
+			for _, kv := range [][2]string{
+				{liquiditytypes.AttributeValuePoolId, "1"},
+				{liquiditytypes.AttributeValueBatchIndex, "1"},
+				{liquiditytypes.AttributeValueMsgIndex, "1"},
+				{liquiditytypes.AttributeValueDepositor, depositor},
+				{liquiditytypes.AttributeValueAcceptedCoins, fmt.Sprintf("%duatom", h)},
+				{liquiditytypes.AttributeValueRefundedCoins, ""},
+				{liquiditytypes.AttributeValuePoolCoinDenom, "pool1"},
+				{liquiditytypes.AttributeValuePoolCoinAmount, "1"},
+				{liquiditytypes.AttributeValueSuccess, liquiditytypes.Success},
+			} {
+				evt.Attributes = append(evt.Attributes, abcitypes.EventAttribute{Key: []byte(kv[0]), Value: []byte(kv[1])})
+			}
+			events = append(events, evt)
+		}
+		writeTestBlockData(t, acc, &BlockData{
+			Header: tmproto.Header{Height: h, Time: testTime.Add(time.Duration(h) * time.Second)},
+			Events: events,
+			Pools:  []liquiditytypes.Pool{pool},
+		})
+	}
+
+	ctx := context.Background()
+	// Records of data which is not saved are not exported.
+	_, err = acc.Accumulate(ctx, nil, 1, 3)
+	require.NoError(t, err)
+	require.Empty(t, buf.String())
+	acc.discardWatchRecords()
+	require.NoError(t, acc.ExportWatchRecords(ctx))
+	require.Empty(t, buf.String())
+
+	_, err = acc.Accumulate(ctx, nil, 1, 3)
+	require.NoError(t, err)
+	require.NoError(t, acc.ExportWatchRecords(ctx))
+	require.Equal(t,
+		"[1/2021-05-04T00:00:01Z] addr1 deposits 1uatom to uatom/uusd pool\n"+
+			"[2/2021-05-04T00:00:02Z] addr1 deposits 2uatom to uatom/uusd pool\n"+
+			"[3/2021-05-04T00:00:03Z] addr1 deposits 3uatom to uatom/uusd pool\n",
+		buf.String())
+}
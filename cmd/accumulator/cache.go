@@ -4,13 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
-	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
-var CacheKey = "gdex-accumulator:cache"
+// CacheKey is the prefix of the redis keys the cache is stored in.
+// It is bumped when the encoding of Cache changes.
+//
+// Under the prefix, the cache is stored in three keys:
+//   - <prefix>:meta, a hash of the block height and the time unit
+//   - <prefix>:buckets, a hash of gob-encoded time buckets by their keys
+//   - <prefix>:updates, a sorted set of time bucket keys by the block height they were last written at
+//
+// Caches under older prefixes are not migrated and can be deleted.
+// Up to v3 the whole cache was stored in a single key, gdex-accumulator:cache:v3,
+// and v4 had no USD values.
+var CacheKey = "gdex-accumulator:cache:v5"
 
 type Cache struct {
 	BlockHeight int64
@@ -18,46 +31,170 @@ type Cache struct {
 }
 
 type CacheManager struct {
-	rp  *redis.Pool
-	key string
+	rp     *redis.Pool
+	prefix string
+	mux    sync.Mutex
+	cache  *Cache // lazily loaded and incrementally updated by Get, never modified in place
 }
 
-func NewCacheManager(rp *redis.Pool, key string) *CacheManager {
-	return &CacheManager{rp: rp, key: key}
+func NewCacheManager(rp *redis.Pool, prefix string) *CacheManager {
+	return &CacheManager{rp: rp, prefix: prefix}
 }
 
+func (cm *CacheManager) metaKey() string    { return cm.prefix + ":meta" }
+func (cm *CacheManager) bucketsKey() string { return cm.prefix + ":buckets" }
+func (cm *CacheManager) updatesKey() string { return cm.prefix + ":updates" }
+
+// Get returns the latest cache, which must not be modified by the caller.
+// The first call loads the whole cache, and subsequent calls load
+// only the time buckets updated since then.
 func (cm *CacheManager) Get(ctx context.Context) (*Cache, error) {
+	cm.mux.Lock()
+	defer cm.mux.Unlock()
 	conn, err := cm.rp.GetContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get redis conn: %w", err)
 	}
 	defer conn.Close()
-	b, err := redis.Bytes(conn.Do("GET", cm.key))
+	blockHeight, timeUnit, ok, err := cm.meta(conn)
 	if err != nil {
-		if errors.Is(err, redis.ErrNil) {
-			return nil, nil
+		return nil, fmt.Errorf("get meta: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	if cm.cache == nil || cm.cache.Data.TimeUnit != timeUnit {
+		c, err := cm.load(conn, blockHeight, timeUnit)
+		if err != nil {
+			return nil, err
 		}
-		return nil, err
+		cm.cache = c
+	} else if blockHeight != cm.cache.BlockHeight {
+		keys, err := redis.Strings(conn.Do("ZRANGEBYSCORE", cm.updatesKey(), "("+strconv.FormatInt(cm.cache.BlockHeight, 10), "+inf"))
+		if err != nil {
+			return nil, fmt.Errorf("get updated time buckets: %w", err)
+		}
+		data := &Data{
+			TimeBuckets: make(map[string]*DataTimeBucket),
+			TimeUnit:    timeUnit,
+		}
+		for key, b := range cm.cache.Data.TimeBuckets {
+			data.TimeBuckets[key] = b
+		}
+		if len(keys) > 0 {
+			args := redis.Args{}.Add(cm.bucketsKey()).AddFlat(keys)
+			bzs, err := redis.ByteSlices(conn.Do("HMGET", args...))
+			if err != nil {
+				return nil, fmt.Errorf("get time buckets: %w", err)
+			}
+			for i, key := range keys {
+				if bzs[i] == nil {
+					delete(data.TimeBuckets, key)
+					continue
+				}
+				b, err := decodeTimeBucket(bzs[i])
+				if err != nil {
+					return nil, fmt.Errorf("decode time bucket %s: %w", key, err)
+				}
+				data.TimeBuckets[key] = b
+			}
+		}
+		cm.cache = &Cache{BlockHeight: blockHeight, Data: data}
+	}
+	return cm.cache, nil
+}
+
+// Load loads the whole cache from redis. Unlike Get, the returned cache
+// is owned by the caller.
+func (cm *CacheManager) Load(ctx context.Context) (*Cache, error) {
+	conn, err := cm.rp.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get redis conn: %w", err)
+	}
+	defer conn.Close()
+	blockHeight, timeUnit, ok, err := cm.meta(conn)
+	if err != nil {
+		return nil, fmt.Errorf("get meta: %w", err)
 	}
-	var c Cache
-	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&c); err != nil {
-		return nil, fmt.Errorf("decode cache: %w", err)
+	if !ok {
+		return nil, nil
 	}
-	return &c, nil
+	return cm.load(conn, blockHeight, timeUnit)
 }
 
+func (cm *CacheManager) meta(conn redis.Conn) (blockHeight int64, timeUnit time.Duration, ok bool, err error) {
+	m, err := redis.Int64Map(conn.Do("HGETALL", cm.metaKey()))
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if len(m) == 0 {
+		return 0, 0, false, nil
+	}
+	return m["blockHeight"], time.Duration(m["timeUnit"]), true, nil
+}
+
+func (cm *CacheManager) load(conn redis.Conn, blockHeight int64, timeUnit time.Duration) (*Cache, error) {
+	vs, err := redis.ByteSlices(conn.Do("HGETALL", cm.bucketsKey()))
+	if err != nil {
+		return nil, fmt.Errorf("get time buckets: %w", err)
+	}
+	data := NewData()
+	data.TimeUnit = timeUnit
+	for i := 0; i+1 < len(vs); i += 2 {
+		key := string(vs[i])
+		b, err := decodeTimeBucket(vs[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("decode time bucket %s: %w", key, err)
+		}
+		data.TimeBuckets[key] = b
+	}
+	return &Cache{BlockHeight: blockHeight, Data: data}, nil
+}
+
+// Set saves the time buckets changed since the last save, and the block height.
 func (cm *CacheManager) Set(ctx context.Context, c *Cache) error {
 	conn, err := cm.rp.GetContext(ctx)
 	if err != nil {
 		return fmt.Errorf("get redis conn: %w", err)
 	}
 	defer conn.Close()
-	buf := &bytes.Buffer{}
-	if err := gob.NewEncoder(buf).Encode(c); err != nil {
-		return fmt.Errorf("encode cache: %w", err)
+	if err := conn.Send("MULTI"); err != nil {
+		return err
 	}
-	if _, err := conn.Do("SET", cm.key, buf.Bytes()); err != nil {
+	for _, key := range c.Data.DirtyTimeBucketKeys() {
+		if b, ok := c.Data.TimeBuckets[key]; ok {
+			buf := &bytes.Buffer{}
+			if err := gob.NewEncoder(buf).Encode(b); err != nil {
+				return fmt.Errorf("encode time bucket %s: %w", key, err)
+			}
+			if err := conn.Send("HSET", cm.bucketsKey(), key, buf.Bytes()); err != nil {
+				return err
+			}
+		} else if err := conn.Send("HDEL", cm.bucketsKey(), key); err != nil {
+			return err
+		}
+		if err := conn.Send("ZADD", cm.updatesKey(), c.BlockHeight, key); err != nil {
+			return err
+		}
+	}
+	if err := conn.Send("HSET", cm.metaKey(),
+		"blockHeight", c.BlockHeight, "timeUnit", int64(c.Data.TimeUnit)); err != nil {
 		return err
 	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return err
+	}
+	c.Data.ClearDirty()
 	return nil
 }
+
+func decodeTimeBucket(bz []byte) (*DataTimeBucket, error) {
+	var b DataTimeBucket
+	if err := gob.NewDecoder(bytes.NewReader(bz)).Decode(&b); err != nil {
+		return nil, err
+	}
+	if b.Pools == nil {
+		b.Pools = make(map[uint64]*PoolData)
+	}
+	return &b, nil
+}
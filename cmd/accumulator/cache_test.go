@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheManager(t *testing.T) {
+	ctx := context.Background()
+	cm, rp := newTestCacheManager(t)
+	conn := rp.Get()
+	defer conn.Close()
+
+	key := func(h int) string { return testTime.Add(time.Duration(h) * time.Hour).Format(TimeBucketKeyFormat) }
+	updates := func() map[string]int64 {
+		m, err := redis.Int64Map(conn.Do("ZRANGEBYSCORE", cm.updatesKey(), "-inf", "+inf", "WITHSCORES"))
+		require.NoError(t, err)
+		return m
+	}
+	bucketKeys := func() []string {
+		keys, err := redis.Strings(conn.Do("HKEYS", cm.bucketsKey()))
+		require.NoError(t, err)
+		return keys
+	}
+
+	c, err := cm.Get(ctx)
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	data := newTestData()
+	require.NoError(t, cm.Set(ctx, &Cache{BlockHeight: 100, Data: data}))
+	require.Empty(t, data.DirtyTimeBucketKeys())
+
+	meta, err := redis.Int64Map(conn.Do("HGETALL", cm.metaKey()))
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"blockHeight": 100, "timeUnit": int64(time.Hour)}, meta)
+	require.ElementsMatch(t, []string{key(0), key(1), key(2)}, bucketKeys())
+	require.Equal(t, map[string]int64{key(0): 100, key(1): 100, key(2): 100}, updates())
+
+	c1, err := cm.Get(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 100, c1.BlockHeight)
+	require.Equal(t, time.Hour, c1.Data.TimeUnit)
+	require.Len(t, c1.Data.TimeBuckets, 3)
+	require.Equal(t, NewStats(data, testTime, testTime.Add(2*time.Hour)), NewStats(c1.Data, testTime, testTime.Add(2*time.Hour)))
+
+	// Only the changed time buckets are written.
+	c, err = cm.Load(ctx)
+	require.NoError(t, err)
+	c.BlockHeight = 110
+	c.Data.DepositCoins(key(2), 2, sdk.NewCoins(sdk.NewInt64Coin("uatom", 1)), 1)
+	c.Data.DepositCoins(key(3), 2, sdk.NewCoins(sdk.NewInt64Coin("uatom", 1)), 1)
+	require.Equal(t, []string{key(2), key(3)}, c.Data.DirtyTimeBucketKeys())
+	require.NoError(t, cm.Set(ctx, c))
+	require.Equal(t, map[string]int64{key(0): 100, key(1): 100, key(2): 110, key(3): 110}, updates())
+
+	// Get loads only the time buckets updated since the last call,
+	// and never modifies the caches it returned before.
+	c2, err := cm.Get(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 110, c2.BlockHeight)
+	require.Len(t, c2.Data.TimeBuckets, 4)
+	require.Same(t, c1.Data.TimeBuckets[key(0)], c2.Data.TimeBuckets[key(0)])
+	require.Equal(t, 1, c2.Data.TimeBuckets[key(2)].Pools[2].NumDeposits)
+	require.Equal(t, 1, c2.Data.TimeBuckets[key(3)].Pools[2].NumDeposits)
+	require.Len(t, c1.Data.TimeBuckets, 3)
+	require.Equal(t, 0, c1.Data.TimeBuckets[key(2)].Pools[2].NumDeposits)
+
+	// Deleted time buckets are removed from the hash, and from the cache by Get.
+	c, err = cm.Load(ctx)
+	require.NoError(t, err)
+	c.BlockHeight = 120
+	require.Equal(t, 4, c.Data.Compact(testTime.Add(24*time.Hour), 24*time.Hour))
+	require.NoError(t, cm.Set(ctx, c))
+	require.Equal(t, []string{key(0)}, bucketKeys())
+	require.Equal(t, map[string]int64{key(0): 120, key(1): 120, key(2): 120, key(3): 120}, updates())
+
+	c3, err := cm.Get(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 120, c3.BlockHeight)
+	require.Len(t, c3.Data.TimeBuckets, 1)
+	require.Equal(t, 24*time.Hour, c3.Data.TimeBuckets[key(0)].Duration)
+	require.Equal(t, NewStats(c.Data, testTime, testTime), NewStats(c3.Data, testTime, testTime))
+
+	// A change of the time unit reloads the whole cache.
+	c.Data.TimeUnit = 24 * time.Hour
+	c.BlockHeight = 130
+	require.NoError(t, cm.Set(ctx, c))
+	c4, err := cm.Get(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, c4.Data.TimeUnit)
+	require.NotSame(t, c3.Data.TimeBuckets[key(0)], c4.Data.TimeBuckets[key(0)])
+}
@@ -14,7 +14,10 @@ import (
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/spf13/cobra"
+
+	"github.com/b-harvest/gravity-dex-backend/util"
 )
 
 var cfg AccumulatorConfig
@@ -27,6 +30,12 @@ func RootCmd() *cobra.Command {
 	cmd.PersistentFlags().IntVarP(&cfg.NumWorkers, "workers", "n", runtime.NumCPU(), "number of concurrent workers")
 	cmd.PersistentFlags().DurationVarP(&cfg.TimeUnit, "unit", "u", 0, "time unit")
 	cmd.PersistentFlags().StringSliceVarP(&cfg.WatchedAddresses, "watch", "w", nil, "watch addresses")
+	cmd.PersistentFlags().StringVar(&cfg.WatchFile, "watch-file", "", "file of watch addresses, one per line; reloaded when modified")
+	cmd.PersistentFlags().StringVar(&cfg.WatchOutput, "watch-output", "", "file to append watch records to; stdout if empty")
+	cmd.PersistentFlags().StringVar(&cfg.WatchFormat, "watch-format", WatchFormatText, "format of watch records: text, jsonl or csv")
+	cmd.PersistentFlags().StringVar(&cfg.WatchWebhook, "watch-webhook", "", "url to POST watch records to as JSON; records are delivered in the background and retried on failures")
+	cmd.PersistentFlags().StringVar(&cfg.PriceConfigFile, "price-config", "", "gdex config file to get current USD prices with; transactions are valued at the prices when they are accumulated, not at their own time")
+	cmd.PersistentFlags().StringVar(&cfg.PriceHistoryFile, "price-history", "", "price history file to get USD prices at the time of transactions with")
 	_ = cmd.MarkFlagRequired("dir")
 	cmd.AddCommand(ReplayCmd())
 	cmd.AddCommand(ServerCmd())
@@ -35,15 +44,41 @@ func RootCmd() *cobra.Command {
 
 func ReplayCmd() *cobra.Command {
 	var startHeight, endHeight int64
+	var format, groupBy, bucket, out string
 	cmd := &cobra.Command{
 		Use: "replay",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cmd.SilenceUsage = true
 
+			byPool, byTime, err := ParseGroupBy(groupBy)
+			if err != nil {
+				return fmt.Errorf("parse group by: %w", err)
+			}
+			switch format {
+			case ReplayFormatRaw, ReplayFormatJSON, ReplayFormatJSONL, ReplayFormatCSV:
+			default:
+				return fmt.Errorf("unknown format: %q", format)
+			}
+			if out == "-" && cfg.WatchOutput == "" && (len(cfg.WatchedAddresses) > 0 || cfg.WatchFile != "") {
+				return fmt.Errorf("--watch-output is required when writing the result to stdout")
+			}
+
 			acc, err := NewAccumulator(cfg, nil)
 			if err != nil {
 				return fmt.Errorf("new accumulator: %w", err)
 			}
+			defer acc.Close()
+
+			bucketDuration := acc.cfg.TimeUnit
+			if bucket != "" {
+				bucketDuration, err = util.ParseDuration(bucket)
+				if err != nil {
+					return fmt.Errorf("parse bucket: %w", err)
+				}
+				if bucketDuration <= 0 || bucketDuration%acc.cfg.TimeUnit != 0 {
+					return fmt.Errorf("bucket must be a multiple of %s", acc.cfg.TimeUnit)
+				}
+			}
 
 			if startHeight == 0 {
 				return fmt.Errorf("start height must be greater than 0")
@@ -63,18 +98,52 @@ func ReplayCmd() *cobra.Command {
 				return fmt.Errorf("accumulate: %w", err)
 			}
 			log.Printf("accumulated state in %s", time.Since(started))
+			if err := acc.ExportWatchRecords(context.Background()); err != nil {
+				return err
+			}
 
-			name := fmt.Sprintf("%d_%d.json", startHeight, endHeight)
-			if err := WriteJSONFile(name, data); err != nil {
-				return fmt.Errorf("write data file: %w", err)
+			if out == "" {
+				ext := format
+				if format == ReplayFormatRaw {
+					ext = "json"
+				}
+				out = fmt.Sprintf("%d_%d.%s", startHeight, endHeight, ext)
+			}
+			w := os.Stdout
+			if out != "-" {
+				f, err := os.Create(out)
+				if err != nil {
+					return fmt.Errorf("create result file: %w", err)
+				}
+				defer f.Close()
+				w = f
+			}
+			if format == ReplayFormatRaw {
+				if err := jsoniter.NewEncoder(w).Encode(data); err != nil {
+					return fmt.Errorf("write result: %w", err)
+				}
+			} else {
+				rows, err := ReplayTable(data, byPool, byTime, bucketDuration)
+				if err != nil {
+					return fmt.Errorf("aggregate data: %w", err)
+				}
+				if err := WriteReplayRows(w, format, rows); err != nil {
+					return fmt.Errorf("write result: %w", err)
+				}
+			}
+			if out != "-" {
+				log.Printf("wrote result to %s", out)
 			}
-			log.Printf("wrote result to %s", name)
 
 			return nil
 		},
 	}
 	cmd.Flags().Int64VarP(&startHeight, "start", "s", 1, "replay start height")
 	cmd.Flags().Int64VarP(&endHeight, "end", "e", 0, "replay end height")
+	cmd.Flags().StringVarP(&format, "format", "f", ReplayFormatRaw, "result format: raw, json, jsonl or csv; formats other than raw write a flat table")
+	cmd.Flags().StringVarP(&groupBy, "group-by", "g", "pool,time", "group rows of the table by pool, time or pool,time")
+	cmd.Flags().StringVarP(&bucket, "bucket", "b", "", "time bucket of the table, like 1h or 1d; defaults to the time unit")
+	cmd.Flags().StringVarP(&out, "out", "o", "", "result file; - for stdout, defaults to <start>_<end>.<format>")
 	return cmd
 }
 
@@ -96,6 +165,7 @@ func ServerCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("new accumulator: %w", err)
 			}
+			defer acc.Close()
 
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
@@ -150,5 +220,7 @@ func ServerCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&redisURL, "redis", "r", "redis://localhost", "redis url")
 	cmd.Flags().DurationVarP(&updateInterval, "interval", "i", 30*time.Second, "update interval")
 	cmd.Flags().StringVarP(&bindAddr, "bind", "b", "0.0.0.0:9000", "binding address")
+	cmd.Flags().DurationVar(&cfg.CompactAfter, "compact-after", 0, "compact time buckets older than this; 0 disables compaction")
+	cmd.Flags().DurationVar(&cfg.CompactUnit, "compact-unit", 24*time.Hour, "time unit of compacted time buckets")
 	return cmd
 }
@@ -2,20 +2,21 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
-	jsoniter "github.com/json-iterator/go"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
 )
 
 type Data struct {
 	TimeBuckets map[string]*DataTimeBucket `json:"timeBuckets"`
 	TimeUnit    time.Duration              `json:"timeUnit"`
 	mux         sync.Mutex
+	dirty       map[string]struct{} // keys of time buckets changed since the last save
 }
 
 func NewData() *Data {
@@ -28,73 +29,240 @@ func (data *Data) TimeBucketKey(t time.Time) string {
 	return t.Truncate(data.TimeUnit).Format(TimeBucketKeyFormat)
 }
 
-func (data *Data) Sum(start, end time.Time) map[uint64]*PoolData {
-	m := make(map[uint64]*PoolData)
+// TimeRange returns the start times of the first and the last time buckets.
+func (data *Data) TimeRange() (start, end time.Time, ok bool) {
+	for key := range data.TimeBuckets {
+		t, err := time.Parse(TimeBucketKeyFormat, key)
+		if err != nil {
+			continue
+		}
+		if !ok || t.Before(start) {
+			start = t
+		}
+		if !ok || t.After(end) {
+			end = t
+		}
+		ok = true
+	}
+	return
+}
+
+// NumActiveAddresses returns the number of unique addresses which made
+// any transaction between start and end.
+func (data *Data) NumActiveAddresses(start, end time.Time) int {
+	addrs := make(map[string]struct{})
+	data.forEachTimeBucket(start, end, func(_ time.Time, b *DataTimeBucket) {
+		for addr := range b.ActiveAddresses {
+			addrs[addr] = struct{}{}
+		}
+	})
+	return len(addrs)
+}
+
+// forEachTimeBucket calls f with each time bucket overlapping the time buckets
+// start and end fall into, and the bucket's start time.
+// Compacted time buckets overlapping the window are included as a whole.
+func (data *Data) forEachTimeBucket(start, end time.Time, f func(t time.Time, b *DataTimeBucket)) {
 	startT := start.UTC().Truncate(data.TimeUnit)
 	endT := end.UTC().Truncate(data.TimeUnit)
-	for !startT.After(endT) {
-		bucketKey := data.TimeBucketKey(startT)
-		b, ok := data.TimeBuckets[bucketKey]
-		if ok {
-			for poolID, p := range b.Pools {
-				mp, ok := m[poolID]
-				if !ok {
-					mp = NewPoolData()
-					m[poolID] = mp
-				}
-				mp.Add(p)
-			}
+	for key, b := range data.TimeBuckets {
+		t, err := time.Parse(TimeBucketKeyFormat, key)
+		if err != nil {
+			continue
+		}
+		d := b.Duration
+		if d < data.TimeUnit {
+			d = data.TimeUnit
 		}
-		startT = startT.Add(data.TimeUnit)
+		if t.After(endT) || !t.Add(d).After(startT) {
+			continue
+		}
+		f(t, b)
 	}
+}
+
+func (data *Data) Sum(start, end time.Time) map[uint64]*PoolData {
+	m := make(map[uint64]*PoolData)
+	data.forEachTimeBucket(start, end, func(_ time.Time, b *DataTimeBucket) {
+		for poolID, p := range b.Pools {
+			mp, ok := m[poolID]
+			if !ok {
+				mp = NewPoolData()
+				m[poolID] = mp
+			}
+			mp.Add(p)
+		}
+	})
 	return m
 }
 
-func (data *Data) DepositCoins(bucketKey string, poolID uint64, coins sdk.Coins) {
+// PoolSeries returns the sums of the pool's data in consecutive buckets of
+// the given duration from start to end, in a single pass over the time buckets.
+// The duration must be a multiple of the data's time unit.
+// A compacted time bucket starting before start is counted in the first bucket.
+func (data *Data) PoolSeries(poolID uint64, start, end time.Time, bucket time.Duration) []*PoolData {
+	start = start.UTC().Truncate(data.TimeUnit)
+	end = end.UTC().Truncate(data.TimeUnit)
+	if end.Before(start) {
+		return nil
+	}
+	series := make([]*PoolData, end.Sub(start)/bucket+1)
+	for i := range series {
+		series[i] = NewPoolData()
+	}
+	data.forEachTimeBucket(start, end, func(t time.Time, b *DataTimeBucket) {
+		p, ok := b.Pools[poolID]
+		if !ok {
+			return
+		}
+		if t.Before(start) {
+			t = start
+		}
+		series[t.Sub(start)/bucket].Add(p)
+	})
+	return series
+}
+
+// PoolIDs returns sorted ids of all pools in the data.
+func (data *Data) PoolIDs() []uint64 {
+	m := make(map[uint64]struct{})
+	for _, b := range data.TimeBuckets {
+		for poolID := range b.Pools {
+			m[poolID] = struct{}{}
+		}
+	}
+	var ids []uint64
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Compact merges time buckets which started before the given time into
+// buckets of the given unit, which must be a multiple of the data's time unit.
+// A compacted bucket is stored under the key of its start time, and is
+// counted as a whole by any time window overlapping it.
+func (data *Data) Compact(before time.Time, unit time.Duration) int {
+	data.mux.Lock()
+	defer data.mux.Unlock()
+	before = before.UTC().Truncate(unit)
+	var keys []string
+	for key, b := range data.TimeBuckets {
+		if b.Duration >= unit {
+			continue
+		}
+		t, err := time.Parse(TimeBucketKeyFormat, key)
+		if err != nil || !t.Before(before) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		t, _ := time.Parse(TimeBucketKeyFormat, key)
+		compactedKey := t.Truncate(unit).Format(TimeBucketKeyFormat)
+		cb := data.TimeBucket(compactedKey)
+		cb.Duration = unit
+		if compactedKey != key {
+			cb.Merge(data.TimeBuckets[key])
+			delete(data.TimeBuckets, key)
+			data.markDirty(key)
+		}
+	}
+	return len(keys)
+}
+
+func (data *Data) markDirty(key string) {
+	if data.dirty == nil {
+		data.dirty = make(map[string]struct{})
+	}
+	data.dirty[key] = struct{}{}
+}
+
+// DirtyTimeBucketKeys returns keys of time buckets which have been changed
+// or deleted since the last call to ClearDirty.
+func (data *Data) DirtyTimeBucketKeys() []string {
+	var keys []string
+	for key := range data.dirty {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (data *Data) ClearDirty() {
+	data.dirty = nil
+}
+
+func (data *Data) DepositCoins(bucketKey string, poolID uint64, coins sdk.Coins, usd float64) {
 	p := data.TimeBucket(bucketKey).Pool(poolID)
 	p.NumDeposits++
+	p.USDDeposited += usd
 	for _, coin := range coins {
-		p.CoinsDeposited[coin.Denom] += coin.Amount.Int64()
+		p.CoinsDeposited.AddAmount(coin.Denom, coin.Amount)
 	}
 }
 
-func (data *Data) WithdrawCoins(bucketKey string, poolID uint64, coins sdk.Coins) {
+func (data *Data) WithdrawCoins(bucketKey string, poolID uint64, coins sdk.Coins, usd float64) {
 	p := data.TimeBucket(bucketKey).Pool(poolID)
 	p.NumWithdrawals++
+	p.USDWithdrawn += usd
 	for _, coin := range coins {
-		p.CoinsWithdrawn[coin.Denom] += coin.Amount.Int64()
+		p.CoinsWithdrawn.AddAmount(coin.Denom, coin.Amount)
 	}
 }
 
-func (data *Data) SwapCoin(bucketKey string, poolID uint64, offerCoin sdk.Coin, demandCoin sdk.Coin) {
+func (data *Data) SwapCoin(bucketKey string, poolID uint64, offerCoin sdk.Coin, demandCoin sdk.Coin, offerUSD, demandUSD float64) {
 	p := data.TimeBucket(bucketKey).Pool(poolID)
 	if offerCoin.Denom < demandCoin.Denom {
 		p.NumSwapsXToY++
 	} else {
 		p.NumSwapsYToX++
 	}
-	p.CoinsSwapped[offerCoin.Denom] += offerCoin.Amount.Int64()
-	p.CoinsTransacted[offerCoin.Denom] += offerCoin.Amount.Int64()
-	p.CoinsTransacted[demandCoin.Denom] += demandCoin.Amount.Int64()
+	p.CoinsSwapped.AddAmount(offerCoin.Denom, offerCoin.Amount)
+	p.CoinsTransacted.AddAmount(offerCoin.Denom, offerCoin.Amount)
+	p.CoinsTransacted.AddAmount(demandCoin.Denom, demandCoin.Amount)
+	p.USDSwapped += offerUSD
+	p.USDTransacted += offerUSD + demandUSD
 }
 
-func (data *Data) SwapCoinYToX(bucketKey string, poolID uint64, denom string, amount int64) {
+func (data *Data) SwapCoinYToX(bucketKey string, poolID uint64, denom string, amount sdk.Int) {
 	p := data.TimeBucket(bucketKey).Pool(poolID)
 	p.NumSwapsYToX++
-	p.CoinsSwapped[denom] += amount
+	p.CoinsSwapped.AddAmount(denom, amount)
 }
 
 type DataTimeBucket struct {
-	Pools map[uint64]*PoolData `json:"pools"`
+	Pools           map[uint64]*PoolData `json:"pools"`
+	ActiveAddresses map[string]struct{}  `json:"activeAddresses"`
+	Duration        time.Duration        `json:"duration,omitempty"` // set when compacted, otherwise the data's time unit
 }
 
 func NewDataTimeBucket() *DataTimeBucket {
 	return &DataTimeBucket{
-		Pools: make(map[uint64]*PoolData),
+		Pools:           make(map[uint64]*PoolData),
+		ActiveAddresses: make(map[string]struct{}),
+	}
+}
+
+func (b *DataTimeBucket) AddActiveAddress(addr string) {
+	if b.ActiveAddresses == nil {
+		b.ActiveAddresses = make(map[string]struct{})
+	}
+	b.ActiveAddresses[addr] = struct{}{}
+}
+
+func (b *DataTimeBucket) Merge(other *DataTimeBucket) {
+	for poolID, p := range other.Pools {
+		b.Pool(poolID).Add(p)
+	}
+	for addr := range other.ActiveAddresses {
+		b.AddActiveAddress(addr)
 	}
 }
 
 func (data *Data) TimeBucket(key string) *DataTimeBucket {
+	data.markDirty(key)
 	hs, ok := data.TimeBuckets[key]
 	if !ok {
 		hs = NewDataTimeBucket()
@@ -112,6 +280,14 @@ type PoolData struct {
 	NumSwapsYToX    int   `json:"numSwapsYToX"`
 	CoinsSwapped    Coins `json:"coinsSwapped"`
 	CoinsTransacted Coins `json:"coinsTransacted"`
+	// USD values of the coins above. They are valued at the time of transactions
+	// with --price-history, but at the time of accumulation with --price-config,
+	// so that blocks accumulated at once are all valued at the same prices.
+	// They are zero if the accumulator has no price source.
+	USDDeposited  float64 `json:"usdDeposited"`
+	USDWithdrawn  float64 `json:"usdWithdrawn"`
+	USDSwapped    float64 `json:"usdSwapped"`
+	USDTransacted float64 `json:"usdTransacted"`
 }
 
 func NewPoolData() *PoolData {
@@ -141,9 +317,13 @@ func (pd *PoolData) Add(other *PoolData) {
 	pd.NumSwapsYToX += other.NumSwapsYToX
 	pd.CoinsSwapped.Add(other.CoinsSwapped)
 	pd.CoinsTransacted.Add(other.CoinsTransacted)
+	pd.USDDeposited += other.USDDeposited
+	pd.USDWithdrawn += other.USDWithdrawn
+	pd.USDSwapped += other.USDSwapped
+	pd.USDTransacted += other.USDTransacted
 }
 
-type Coins map[string]int64
+type Coins map[string]schema.Int
 
 func (cs Coins) String() string {
 	var denoms []string
@@ -153,7 +333,7 @@ func (cs Coins) String() string {
 	sort.Strings(denoms)
 	var ss []string
 	for _, denom := range denoms {
-		ss = append(ss, fmt.Sprintf("%d%s", cs[denom], denom))
+		ss = append(ss, fmt.Sprintf("%s%s", cs[denom], denom))
 	}
 	return strings.Join(ss, ",")
 }
@@ -161,25 +341,17 @@ func (cs Coins) String() string {
 func (cs Coins) Div(q int64) Coins {
 	res := make(Coins)
 	for denom, amount := range cs {
-		res[denom] = amount / q
+		res[denom] = amount.Quo(q)
 	}
 	return res
 }
 
 func (cs Coins) Add(coins Coins) {
 	for denom, amount := range coins {
-		cs[denom] += amount
+		cs[denom] = cs[denom].Add(amount)
 	}
 }
 
-func WriteJSONFile(name string, v interface{}) error {
-	f, err := os.Create(name)
-	if err != nil {
-		return fmt.Errorf("create: %w", err)
-	}
-	defer f.Close()
-	if err := jsoniter.NewEncoder(f).Encode(v); err != nil {
-		return fmt.Errorf("encode: %w", err)
-	}
-	return nil
+func (cs Coins) AddAmount(denom string, amount sdk.Int) {
+	cs[denom] = cs[denom].Add(schema.NewIntFromSDK(amount))
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestData_PoolSeries(t *testing.T) {
+	data := newTestData()
+	for _, tc := range []struct {
+		name       string
+		poolID     uint64
+		start, end time.Time
+		bucket     time.Duration
+		expected   [][3]int // deposits, withdrawals and swaps of each point
+	}{
+		{"hourly", 1, testTime, testTime.Add(2 * time.Hour), time.Hour, [][3]int{{1, 0, 0}, {0, 0, 1}, {0, 0, 0}}},
+		{"two hours", 2, testTime, testTime.Add(2 * time.Hour), 2 * time.Hour, [][3]int{{0, 0, 1}, {0, 1, 0}}},
+		{"longer than the window", 1, testTime, testTime.Add(2 * time.Hour), 24 * time.Hour, [][3]int{{1, 0, 1}}},
+		{"inside buckets", 2, testTime.Add(90 * time.Minute), testTime.Add(150 * time.Minute), time.Hour, [][3]int{{0, 0, 1}, {0, 1, 0}}},
+		{"unknown pool", 3, testTime, testTime.Add(time.Hour), time.Hour, [][3]int{{0, 0, 0}, {0, 0, 0}}},
+		{"end before start", 1, testTime.Add(time.Hour), testTime, time.Hour, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual [][3]int
+			for _, p := range data.PoolSeries(tc.poolID, tc.start, tc.end, tc.bucket) {
+				actual = append(actual, [3]int{p.NumDeposits, p.NumWithdrawals, p.NumSwapsXToY + p.NumSwapsYToX})
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestData_DirtyTimeBucketKeys(t *testing.T) {
+	data := newTestData()
+	key := func(h int) string { return data.TimeBucketKey(testTime.Add(time.Duration(h) * time.Hour)) }
+	require.Equal(t, []string{key(0), key(1), key(2)}, data.DirtyTimeBucketKeys())
+
+	data.ClearDirty()
+	require.Empty(t, data.DirtyTimeBucketKeys())
+
+	data.SwapCoin(key(1), 1, sdk.NewInt64Coin("uatom", 1), sdk.NewInt64Coin("uusd", 1), 0, 0)
+	data.TimeBucket(key(5)).AddActiveAddress("addr4")
+	require.Equal(t, []string{key(1), key(5)}, data.DirtyTimeBucketKeys())
+}
+
+func TestData_Compact(t *testing.T) {
+	data := newTestData()
+	key := func(h int) string { return data.TimeBucketKey(testTime.Add(time.Duration(h) * time.Hour)) }
+	data.TimeBucket(key(24)).AddActiveAddress("addr4")
+	data.ClearDirty()
+
+	// Only time buckets before the start of the compaction unit are compacted.
+	require.Equal(t, 3, data.Compact(testTime.Add(30*time.Hour), 24*time.Hour))
+	require.Len(t, data.TimeBuckets, 2)
+	require.Equal(t, 24*time.Hour, data.TimeBuckets[key(0)].Duration)
+	require.Zero(t, data.TimeBuckets[key(24)].Duration)
+	// Merged time buckets are dirty, so that they are deleted when saved.
+	require.Equal(t, []string{key(0), key(1), key(2)}, data.DirtyTimeBucketKeys())
+
+	// Compacting again does nothing.
+	data.ClearDirty()
+	require.Equal(t, 0, data.Compact(testTime.Add(30*time.Hour), 24*time.Hour))
+	require.Empty(t, data.DirtyTimeBucketKeys())
+
+	stats := NewStats(data, testTime, testTime.Add(2*time.Hour))
+	require.Equal(t, 3, stats.NumActiveAddresses)
+	require.Equal(t, 4, stats.NumTransactions)
+
+	// A window starting inside a compacted time bucket includes the whole bucket.
+	stats = NewStats(data, testTime.Add(time.Hour), testTime.Add(2*time.Hour))
+	require.Equal(t, 3, stats.NumActiveAddresses)
+	require.Equal(t, 4, stats.NumTransactions)
+	stats = NewStats(data, testTime.Add(23*time.Hour), testTime.Add(24*time.Hour))
+	require.Equal(t, 4, stats.NumActiveAddresses)
+	stats = NewStats(data, testTime.Add(24*time.Hour), testTime.Add(25*time.Hour))
+	require.Equal(t, 1, stats.NumActiveAddresses)
+
+	// And the series counts it in the first point.
+	series := data.PoolSeries(1, testTime.Add(time.Hour), testTime.Add(3*time.Hour), time.Hour)
+	require.Len(t, series, 3)
+	require.Equal(t, 1, series[0].NumDeposits)
+	require.Equal(t, 1, series[0].NumSwapsXToY)
+	require.Equal(t, 0, series[1].NumDeposits+series[1].NumSwapsXToY)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/b-harvest/gravity-dex-backend/metrics"
+)
+
+var (
+	runDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "accumulator",
+		Name:      "run_duration_seconds",
+		Help:      "Duration of accumulator runs which accumulated new blocks.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+	})
+	runFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "accumulator",
+		Name:      "run_failures_total",
+		Help:      "Number of failed accumulator runs.",
+	})
+	latestBlockHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "accumulator",
+		Name:      "latest_block_height",
+		Help:      "Latest accumulated block height.",
+	})
+)
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+	"github.com/b-harvest/gravity-dex-backend/service/price"
+	"github.com/b-harvest/gravity-dex-backend/service/pricetable"
+)
+
+// PriceSource provides USD prices of coin denoms.
+type PriceSource interface {
+	// Update is called before accumulating blocks.
+	Update(ctx context.Context) error
+	// Price returns the USD price of the denom at the time.
+	Price(denom string, t time.Time) (float64, bool)
+}
+
+// USDValue returns the USD value of the coins at the time.
+// Coins without a price are ignored.
+func USDValue(ps PriceSource, coins sdk.Coins, t time.Time) float64 {
+	if ps == nil {
+		return 0
+	}
+	v := 0.0
+	for _, coin := range coins {
+		if p, ok := ps.Price(coin.Denom, t); ok {
+			v += p * schema.NewIntFromSDK(coin.Amount).Float64()
+		}
+	}
+	return v
+}
+
+var _ PriceSource = (*LivePriceSource)(nil)
+
+// LivePriceSource values coins with the current prices regardless of the time,
+// so past transactions are valued at today's prices.
+type LivePriceSource struct {
+	pts *pricetable.Service
+	mux sync.RWMutex
+	t   price.Table
+}
+
+func NewLivePriceSource(pts *pricetable.Service) *LivePriceSource {
+	return &LivePriceSource{pts: pts}
+}
+
+func (s *LivePriceSource) Update(ctx context.Context) error {
+	t, err := s.pts.PriceTable(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("get price table: %w", err)
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.t = t
+	return nil
+}
+
+func (s *LivePriceSource) Price(denom string, _ time.Time) (float64, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	p, ok := s.t[denom]
+	return p, ok
+}
+
+var _ PriceSource = (*PriceHistory)(nil)
+
+// PriceHistory values coins with recorded prices.
+type PriceHistory struct {
+	*pricetable.History
+}
+
+// LoadPriceHistory loads a price history file, see pricetable.LoadHistory.
+func LoadPriceHistory(name string, denomMetadata map[string]pricetable.DenomMetadata) (*PriceHistory, error) {
+	h, err := pricetable.LoadHistory(name, denomMetadata)
+	if err != nil {
+		return nil, err
+	}
+	return &PriceHistory{h}, nil
+}
+
+func (h *PriceHistory) Update(context.Context) error {
+	return nil
+}
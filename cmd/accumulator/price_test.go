@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/b-harvest/gravity-dex-backend/service/pricetable"
+)
+
+func newTestPriceHistory(t *testing.T) *PriceHistory {
+	name := filepath.Join(t.TempDir(), "prices.json")
+	// Entries are out of order, and symbols are case-insensitive.
+	require.NoError(t, os.WriteFile(name, []byte(`{
+  "ATOM": [
+    {"time": "2021-05-04T12:00:00Z", "price": 30},
+    {"time": "2021-05-04T00:00:00Z", "price": 20}
+  ],
+  "uusd": [
+    {"time": "2021-05-01T00:00:00Z", "price": 0.000001}
+  ]
+}`), 0644))
+	h, err := LoadPriceHistory(name, map[string]pricetable.DenomMetadata{
+		"uatom": {Denom: "uatom", Display: "atom", Exponent: 6},
+		"uusd":  {Denom: "uusd", Display: "usd", Exponent: 6},
+	})
+	require.NoError(t, err)
+	return h
+}
+
+func TestPriceHistory_Price(t *testing.T) {
+	h := newTestPriceHistory(t)
+	for _, tc := range []struct {
+		denom    string
+		t        time.Time
+		expected float64
+		ok       bool
+	}{
+		{"atom", testTime.Add(-time.Second), 0, false},
+		{"atom", testTime, 20, true},
+		{"atom", testTime.Add(6 * time.Hour), 20, true},
+		{"atom", testTime.Add(12 * time.Hour), 30, true},
+		{"atom", testTime.Add(48 * time.Hour), 30, true},
+		// Base denoms are priced by their display denoms, scaled by the exponent.
+		{"uatom", testTime.Add(6 * time.Hour), 0.00002, true},
+		{"uatom", testTime.Add(-time.Second), 0, false},
+		// Prices recorded for base denoms are used as they are.
+		{"uusd", testTime, 0.000001, true},
+		{"uluna", testTime, 0, false},
+	} {
+		p, ok := h.Price(tc.denom, tc.t)
+		require.Equal(t, tc.ok, ok, "%s at %s", tc.denom, tc.t)
+		require.InDelta(t, tc.expected, p, 1e-12, "%s at %s", tc.denom, tc.t)
+	}
+}
+
+func TestUSDValue(t *testing.T) {
+	h := newTestPriceHistory(t)
+	coins := sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000000), sdk.NewInt64Coin("uusd", 5000000), sdk.NewInt64Coin("uluna", 1))
+	// Coins without a price are ignored.
+	require.InDelta(t, 25, USDValue(h, coins, testTime), 1e-9)
+	require.InDelta(t, 35, USDValue(h, coins, testTime.Add(12*time.Hour)), 1e-9)
+	require.InDelta(t, 5, USDValue(h, coins, testTime.Add(-time.Second)), 1e-9)
+	require.Zero(t, USDValue(nil, coins, testTime))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	ReplayFormatRaw   = "raw" // the whole Data
+	ReplayFormatJSON  = "json"
+	ReplayFormatJSONL = "jsonl"
+	ReplayFormatCSV   = "csv"
+)
+
+// ReplayRow is a row of the flat replay table.
+// Bucket is zero when not grouped by time, and PoolID is zero when not grouped by pool.
+type ReplayRow struct {
+	Bucket          time.Time `json:"bucket"`
+	PoolID          uint64    `json:"poolId"`
+	Denoms          []string  `json:"denoms"`
+	NumDeposits     int       `json:"numDeposits"`
+	NumWithdrawals  int       `json:"numWithdrawals"`
+	NumSwapsXToY    int       `json:"numSwapsXToY"`
+	NumSwapsYToX    int       `json:"numSwapsYToX"`
+	CoinsDeposited  string    `json:"coinsDeposited"`
+	CoinsWithdrawn  string    `json:"coinsWithdrawn"`
+	CoinsSwapped    string    `json:"coinsSwapped"`
+	CoinsTransacted string    `json:"coinsTransacted"`
+	USDDeposited    float64   `json:"usdDeposited"`
+	USDWithdrawn    float64   `json:"usdWithdrawn"`
+	USDSwapped      float64   `json:"usdSwapped"`
+	USDTransacted   float64   `json:"usdTransacted"`
+}
+
+var replayRowCSVHeader = []string{
+	"bucket", "pool_id", "denoms",
+	"num_deposits", "num_withdrawals", "num_swaps_x_to_y", "num_swaps_y_to_x",
+	"coins_deposited", "coins_withdrawn", "coins_swapped", "coins_transacted",
+	"usd_deposited", "usd_withdrawn", "usd_swapped", "usd_transacted",
+}
+
+func NewReplayRow(bucket time.Time, poolID uint64, p *PoolData) ReplayRow {
+	denoms := []string{}
+	if poolID != 0 {
+		denomSet := make(map[string]struct{})
+		for _, cs := range []Coins{p.CoinsDeposited, p.CoinsWithdrawn, p.CoinsTransacted} {
+			for denom := range cs {
+				denomSet[denom] = struct{}{}
+			}
+		}
+		for denom := range denomSet {
+			denoms = append(denoms, denom)
+		}
+		sort.Strings(denoms)
+	}
+	return ReplayRow{
+		Bucket:          bucket,
+		PoolID:          poolID,
+		Denoms:          denoms,
+		NumDeposits:     p.NumDeposits,
+		NumWithdrawals:  p.NumWithdrawals,
+		NumSwapsXToY:    p.NumSwapsXToY,
+		NumSwapsYToX:    p.NumSwapsYToX,
+		CoinsDeposited:  p.CoinsDeposited.String(),
+		CoinsWithdrawn:  p.CoinsWithdrawn.String(),
+		CoinsSwapped:    p.CoinsSwapped.String(),
+		CoinsTransacted: p.CoinsTransacted.String(),
+		USDDeposited:    p.USDDeposited,
+		USDWithdrawn:    p.USDWithdrawn,
+		USDSwapped:      p.USDSwapped,
+		USDTransacted:   p.USDTransacted,
+	}
+}
+
+func (r ReplayRow) CSVRecord() []string {
+	var bucket string
+	if !r.Bucket.IsZero() {
+		bucket = r.Bucket.Format(time.RFC3339)
+	}
+	var poolID string
+	if r.PoolID != 0 {
+		poolID = strconv.FormatUint(r.PoolID, 10)
+	}
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return []string{
+		bucket, poolID, strings.Join(r.Denoms, "/"),
+		strconv.Itoa(r.NumDeposits), strconv.Itoa(r.NumWithdrawals),
+		strconv.Itoa(r.NumSwapsXToY), strconv.Itoa(r.NumSwapsYToX),
+		r.CoinsDeposited, r.CoinsWithdrawn, r.CoinsSwapped, r.CoinsTransacted,
+		formatFloat(r.USDDeposited), formatFloat(r.USDWithdrawn),
+		formatFloat(r.USDSwapped), formatFloat(r.USDTransacted),
+	}
+}
+
+// ReplayTable aggregates the data into rows grouped by pool and/or time buckets
+// of the given duration, sorted by bucket and pool id.
+func ReplayTable(data *Data, groupByPool, groupByTime bool, bucket time.Duration) ([]ReplayRow, error) {
+	type rowKey struct {
+		bucket time.Time
+		poolID uint64
+	}
+	sums := make(map[rowKey]*PoolData)
+	for key, b := range data.TimeBuckets {
+		t, err := time.Parse(TimeBucketKeyFormat, key)
+		if err != nil {
+			return nil, fmt.Errorf("parse time bucket key %q: %w", key, err)
+		}
+		var k rowKey
+		if groupByTime {
+			k.bucket = t.Truncate(bucket)
+		}
+		for poolID, p := range b.Pools {
+			if groupByPool {
+				k.poolID = poolID
+			}
+			sum, ok := sums[k]
+			if !ok {
+				sum = NewPoolData()
+				sums[k] = sum
+			}
+			sum.Add(p)
+		}
+	}
+	var rows []ReplayRow
+	for k, sum := range sums {
+		rows = append(rows, NewReplayRow(k.bucket, k.poolID, sum))
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].Bucket.Equal(rows[j].Bucket) {
+			return rows[i].Bucket.Before(rows[j].Bucket)
+		}
+		return rows[i].PoolID < rows[j].PoolID
+	})
+	return rows, nil
+}
+
+func WriteReplayRows(w io.Writer, format string, rows []ReplayRow) error {
+	switch format {
+	case ReplayFormatJSON:
+		if rows == nil {
+			rows = []ReplayRow{}
+		}
+		return jsoniter.NewEncoder(w).Encode(rows)
+	case ReplayFormatJSONL:
+		enc := jsoniter.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ReplayFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(replayRowCSVHeader); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := cw.Write(row.CSVRecord()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown format: %q", format)
+	}
+}
+
+// ParseGroupBy parses a comma-separated list of "pool" and "time".
+func ParseGroupBy(s string) (byPool, byTime bool, err error) {
+	for _, g := range strings.Split(s, ",") {
+		switch strings.TrimSpace(g) {
+		case "pool":
+			byPool = true
+		case "time":
+			byTime = true
+		default:
+			return false, false, fmt.Errorf("unknown group: %q", g)
+		}
+	}
+	return
+}
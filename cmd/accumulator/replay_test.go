@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGroupBy(t *testing.T) {
+	for _, tc := range []struct {
+		s              string
+		byPool, byTime bool
+		ok             bool
+	}{
+		{"pool", true, false, true},
+		{"time", false, true, true},
+		{"pool,time", true, true, true},
+		{"time, pool", true, true, true},
+		{"", false, false, false},
+		{"pool,address", false, false, false},
+	} {
+		byPool, byTime, err := ParseGroupBy(tc.s)
+		if !tc.ok {
+			require.Error(t, err, tc.s)
+			continue
+		}
+		require.NoError(t, err, tc.s)
+		require.Equal(t, tc.byPool, byPool, tc.s)
+		require.Equal(t, tc.byTime, byTime, tc.s)
+	}
+}
+
+func TestReplayTable(t *testing.T) {
+	data := newTestData()
+	type row struct {
+		bucket                            time.Time
+		poolID                            uint64
+		deposits, withdrawals, xToY, yToX int
+	}
+	for _, tc := range []struct {
+		name           string
+		byPool, byTime bool
+		bucket         time.Duration
+		expected       []row
+	}{
+		{
+			"pool and time", true, true, time.Hour,
+			[]row{
+				{testTime, 1, 1, 0, 0, 0},
+				{testTime.Add(time.Hour), 1, 0, 0, 1, 0},
+				{testTime.Add(time.Hour), 2, 0, 0, 0, 1},
+				{testTime.Add(2 * time.Hour), 2, 0, 1, 0, 0},
+			},
+		},
+		{
+			"pool and two hours", true, true, 2 * time.Hour,
+			[]row{
+				{testTime, 1, 1, 0, 1, 0},
+				{testTime, 2, 0, 0, 0, 1},
+				{testTime.Add(2 * time.Hour), 2, 0, 1, 0, 0},
+			},
+		},
+		{
+			"pool", true, false, time.Hour,
+			[]row{
+				{time.Time{}, 1, 1, 0, 1, 0},
+				{time.Time{}, 2, 0, 1, 0, 1},
+			},
+		},
+		{
+			"day", false, true, 24 * time.Hour,
+			[]row{
+				{testTime, 0, 1, 1, 1, 1},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rows, err := ReplayTable(data, tc.byPool, tc.byTime, tc.bucket)
+			require.NoError(t, err)
+			var actual []row
+			for _, r := range rows {
+				actual = append(actual, row{r.Bucket, r.PoolID, r.NumDeposits, r.NumWithdrawals, r.NumSwapsXToY, r.NumSwapsYToX})
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+
+	rows, err := ReplayTable(data, true, false, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, []string{"uatom", "uusd"}, rows[0].Denoms)
+	require.Equal(t, "10uatom,20uusd", rows[0].CoinsDeposited)
+	require.Equal(t, "5uatom", rows[0].CoinsSwapped)
+	require.Equal(t, "5uatom,10uusd", rows[0].CoinsTransacted)
+	require.EqualValues(t, 40, rows[0].USDDeposited)
+	require.EqualValues(t, 10, rows[0].USDSwapped)
+
+	rows, err = ReplayTable(data, false, false, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Empty(t, rows[0].Denoms)
+
+	data.TimeBuckets["invalid"] = NewDataTimeBucket()
+	_, err = ReplayTable(data, true, true, time.Hour)
+	require.Error(t, err)
+}
+
+func TestWriteReplayRows(t *testing.T) {
+	rows, err := ReplayTable(newTestData(), true, true, 2*time.Hour)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteReplayRows(&buf, ReplayFormatCSV, rows))
+	require.Equal(t, strings.Join([]string{
+		"bucket,pool_id,denoms,num_deposits,num_withdrawals,num_swaps_x_to_y,num_swaps_y_to_x,coins_deposited,coins_withdrawn,coins_swapped,coins_transacted,usd_deposited,usd_withdrawn,usd_swapped,usd_transacted",
+		`2021-05-04T00:00:00Z,1,uatom/uusd,1,0,1,0,"10uatom,20uusd",,5uatom,"5uatom,10uusd",40,0,10,20`,
+		`2021-05-04T00:00:00Z,2,uatom/uusd,0,0,0,1,,,3uusd,"1uatom,3uusd",0,0,3,5`,
+		`2021-05-04T02:00:00Z,2,uatom,0,1,0,0,,1uatom,,,0,2,0,0`,
+		"",
+	}, "\n"), buf.String())
+
+	// Rows without a bucket or a pool leave those columns empty.
+	rows, err = ReplayTable(newTestData(), false, false, time.Hour)
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, WriteReplayRows(&buf, ReplayFormatCSV, rows))
+	require.True(t, strings.HasPrefix(strings.Split(buf.String(), "\n")[1], ",,,1,1,1,1,"))
+
+	buf.Reset()
+	require.NoError(t, WriteReplayRows(&buf, ReplayFormatJSONL, rows))
+	require.Equal(t,
+		`{"bucket":"0001-01-01T00:00:00Z","poolId":0,"denoms":[],"numDeposits":1,"numWithdrawals":1,"numSwapsXToY":1,"numSwapsYToX":1,`+
+			`"coinsDeposited":"10uatom,20uusd","coinsWithdrawn":"1uatom","coinsSwapped":"5uatom,3uusd","coinsTransacted":"6uatom,13uusd",`+
+			`"usdDeposited":40,"usdWithdrawn":2,"usdSwapped":13,"usdTransacted":25}`+"\n",
+		buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteReplayRows(&buf, ReplayFormatJSON, nil))
+	require.Equal(t, "[]\n", buf.String())
+
+	require.Error(t, WriteReplayRows(&buf, "xml", rows))
+}
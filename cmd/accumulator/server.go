@@ -8,6 +8,8 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/b-harvest/gravity-dex-backend/metrics"
 )
 
 type Server struct {
@@ -18,6 +20,7 @@ type Server struct {
 func NewServer(cm *CacheManager) *Server {
 	e := echo.New()
 	e.Use(middleware.Recover())
+	e.Use(metrics.EchoMiddleware())
 	e.Use(middleware.CORS())
 	e.HideBanner = true
 	e.HidePort = true
@@ -32,9 +35,174 @@ func NewServer(cm *CacheManager) *Server {
 
 func (s *Server) registerRoutes() {
 	s.GET("/stats", s.GetStats)
+	s.GET("/stats/pools", s.GetPoolsStats)
+	s.GET("/stats/pools/:id", s.GetPoolStats)
+	s.GET("/metrics", metrics.EchoHandler())
+}
+
+type Stats struct {
+	NumActiveAddresses int     `json:"numActiveAddresses"`
+	NumDeposits        int     `json:"numDeposits"`
+	NumWithdrawals     int     `json:"numWithdrawals"`
+	NumSwaps           int     `json:"numSwaps"`
+	NumTransactions    int     `json:"numTransactions"`
+	TransactedCoins    string  `json:"transactedCoins"` // deposited, withdrawn, offered and demanded coins
+	SwapVolume         string  `json:"swapVolume"`      // offered coins
+	TransactedUSD      float64 `json:"transactedUSD"`
+	SwapVolumeUSD      float64 `json:"swapVolumeUSD"`
+}
+
+func NewStats(data *Data, start, end time.Time) Stats {
+	var (
+		stats           Stats
+		transactedCoins = make(Coins)
+		swapVolume      = make(Coins)
+	)
+	for _, p := range data.Sum(start, end) {
+		stats.NumDeposits += p.NumDeposits
+		stats.NumWithdrawals += p.NumWithdrawals
+		stats.NumSwaps += p.NumSwapsXToY + p.NumSwapsYToX
+		transactedCoins.Add(p.CoinsDeposited)
+		transactedCoins.Add(p.CoinsWithdrawn)
+		transactedCoins.Add(p.CoinsTransacted)
+		swapVolume.Add(p.CoinsSwapped)
+		stats.TransactedUSD += p.USDDeposited + p.USDWithdrawn + p.USDTransacted
+		stats.SwapVolumeUSD += p.USDSwapped
+	}
+	stats.NumActiveAddresses = data.NumActiveAddresses(start, end)
+	stats.NumTransactions = stats.NumDeposits + stats.NumWithdrawals + stats.NumSwaps
+	stats.TransactedCoins = transactedCoins.String()
+	stats.SwapVolume = swapVolume.String()
+	return stats
+}
+
+type GetStatsRequest struct {
+	From int64 `query:"from"` // unix timestamp
+	To   int64 `query:"to"`   // unix timestamp
+}
+
+type GetStatsResponse struct {
+	BlockHeight                   int64                   `json:"blockHeight"`
+	NumActiveAddresses            int                     `json:"numActiveAddresses"`
+	NumActiveAddressesLast24Hours int                     `json:"numActiveAddressesLast24Hours"`
+	NumDeposits                   int                     `json:"numDeposits"`
+	NumSwaps                      int                     `json:"numSwaps"`
+	NumTransactions               int                     `json:"numTransactions"`
+	NumDepositsLast24Hours        int                     `json:"numDepositsLast24Hours"`
+	NumSwapsLast24Hours           int                     `json:"numSwapsLast24Hours"`
+	NumTransactionsLast24Hours    int                     `json:"numTransactionsLast24Hours"`
+	TransactedCoins               string                  `json:"transactedCoins"`
+	TransactedCoinsLast24Hours    string                  `json:"transactedCoinsLast24Hours"`
+	SwapVolume                    string                  `json:"swapVolume"`
+	SwapVolumeLast24Hours         string                  `json:"swapVolumeLast24Hours"`
+	TransactedUSD                 float64                 `json:"transactedUSD"`
+	TransactedUSDLast24Hours      float64                 `json:"transactedUSDLast24Hours"`
+	SwapVolumeUSD                 float64                 `json:"swapVolumeUSD"`
+	SwapVolumeUSDLast24Hours      float64                 `json:"swapVolumeUSDLast24Hours"`
+	Window                        *GetStatsResponseWindow `json:"window,omitempty"`
+}
+
+type GetStatsResponseWindow struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Stats
 }
 
 func (s *Server) GetStats(c echo.Context) error {
+	var req GetStatsRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	cache, err := s.cm.Get(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("get cache: %w", err)
+	}
+	if cache == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "stats not found")
+	}
+	now := time.Now()
+	resp := GetStatsResponse{BlockHeight: cache.BlockHeight}
+	if start, end, ok := cache.Data.TimeRange(); ok {
+		all := NewStats(cache.Data, start, end)
+		last24h := NewStats(cache.Data, now.Add(-24*time.Hour), now)
+		resp.NumActiveAddresses = all.NumActiveAddresses
+		resp.NumActiveAddressesLast24Hours = last24h.NumActiveAddresses
+		resp.NumDeposits = all.NumDeposits
+		resp.NumSwaps = all.NumSwaps
+		resp.NumTransactions = all.NumTransactions
+		resp.NumDepositsLast24Hours = last24h.NumDeposits
+		resp.NumSwapsLast24Hours = last24h.NumSwaps
+		resp.NumTransactionsLast24Hours = last24h.NumTransactions
+		resp.TransactedCoins = all.TransactedCoins
+		resp.TransactedCoinsLast24Hours = last24h.TransactedCoins
+		resp.SwapVolume = all.SwapVolume
+		resp.SwapVolumeLast24Hours = last24h.SwapVolume
+		resp.TransactedUSD = all.TransactedUSD
+		resp.TransactedUSDLast24Hours = last24h.TransactedUSD
+		resp.SwapVolumeUSD = all.SwapVolumeUSD
+		resp.SwapVolumeUSDLast24Hours = last24h.SwapVolumeUSD
+	}
+	if req.From > 0 || req.To > 0 {
+		from, to := time.Unix(req.From, 0).UTC(), now.UTC()
+		if req.To > 0 {
+			to = time.Unix(req.To, 0).UTC()
+		}
+		if !from.Before(to) {
+			return echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+		}
+		if start, _, ok := cache.Data.TimeRange(); ok && from.Before(start) {
+			from = start
+		}
+		resp.Window = &GetStatsResponseWindow{
+			From:  from,
+			To:    to,
+			Stats: NewStats(cache.Data, from, to),
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// maxPoolStatsSeriesLength limits the number of points in a pool stats time series.
+const maxPoolStatsSeriesLength = 10000
+
+type PoolStats struct {
+	PoolID uint64 `json:"poolId"`
+	*PoolData
+}
+
+// timeWindow returns the time window between from and to, which are unix timestamps.
+// The window defaults to the whole time range of the data.
+func timeWindow(data *Data, from, to int64) (start, end time.Time, err error) {
+	start, end, _ = data.TimeRange()
+	if from > 0 {
+		start = time.Unix(from, 0).UTC()
+	}
+	if to > 0 {
+		end = time.Unix(to, 0).UTC()
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+	return start, end, nil
+}
+
+type GetPoolsStatsRequest struct {
+	From int64 `query:"from"` // unix timestamp
+	To   int64 `query:"to"`   // unix timestamp
+}
+
+type GetPoolsStatsResponse struct {
+	BlockHeight int64       `json:"blockHeight"`
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	Pools       []PoolStats `json:"pools"`
+}
+
+func (s *Server) GetPoolsStats(c echo.Context) error {
+	var req GetPoolsStatsRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
 	cache, err := s.cm.Get(c.Request().Context())
 	if err != nil {
 		return fmt.Errorf("get cache: %w", err)
@@ -42,20 +210,103 @@ func (s *Server) GetStats(c echo.Context) error {
 	if cache == nil {
 		return echo.NewHTTPError(http.StatusServiceUnavailable, "stats not found")
 	}
-	var resp struct {
-		BlockHeight                   int64  `json:"blockHeight"`
-		NumActiveAddresses            int    `json:"numActiveAddresses"`
-		NumActiveAddressesLast24Hours int    `json:"numActiveAddressesLast24Hours"`
-		NumDeposits                   int    `json:"numDeposits"`
-		NumSwaps                      int    `json:"numSwaps"`
-		NumTransactions               int    `json:"numTransactions"`
-		NumDepositsLast24Hours        int    `json:"numDepositsLast24Hours"`
-		NumSwapsLast24Hours           int    `json:"numSwapsLast24Hours"`
-		NumTransactionsLast24Hours    int    `json:"numTransactionsLast24Hours"`
-		TransactedCoins               string `json:"transactedCoins"`
-		TransactedCoinsLast24Hours    string `json:"transactedCoinsLast24Hours"`
-		SwapVolume                    string `json:"swapVolume"`
-		SwapVolumeLast24Hours         string `json:"swapVolumeLast24Hours"`
+	start, end, err := timeWindow(cache.Data, req.From, req.To)
+	if err != nil {
+		return err
+	}
+	sum := cache.Data.Sum(start, end)
+	resp := GetPoolsStatsResponse{
+		BlockHeight: cache.BlockHeight,
+		From:        start,
+		To:          end,
+		Pools:       []PoolStats{},
+	}
+	for _, id := range cache.Data.PoolIDs() {
+		p, ok := sum[id]
+		if !ok {
+			p = NewPoolData()
+		}
+		resp.Pools = append(resp.Pools, PoolStats{PoolID: id, PoolData: p})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+type GetPoolStatsRequest struct {
+	ID     uint64 `param:"id"`
+	From   int64  `query:"from"`   // unix timestamp
+	To     int64  `query:"to"`     // unix timestamp
+	Bucket string `query:"bucket"` // duration of each time series bucket, e.g. "1h"
+}
+
+type GetPoolStatsResponse struct {
+	BlockHeight int64                       `json:"blockHeight"`
+	From        time.Time                   `json:"from"`
+	To          time.Time                   `json:"to"`
+	Bucket      string                      `json:"bucket"`
+	Stats       PoolStats                   `json:"stats"`
+	Series      []GetPoolStatsResponsePoint `json:"series"`
+}
+
+type GetPoolStatsResponsePoint struct {
+	StartTime time.Time `json:"startTime"`
+	*PoolData
+}
+
+func (s *Server) GetPoolStats(c echo.Context) error {
+	var req GetPoolStatsRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	cache, err := s.cm.Get(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("get cache: %w", err)
+	}
+	if cache == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "stats not found")
+	}
+	data := cache.Data
+	found := false
+	for _, id := range data.PoolIDs() {
+		if id == req.ID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return echo.NewHTTPError(http.StatusNotFound, "pool not found")
+	}
+	start, end, err := timeWindow(data, req.From, req.To)
+	if err != nil {
+		return err
+	}
+	bucket := data.TimeUnit
+	if req.Bucket != "" {
+		bucket, err = time.ParseDuration(req.Bucket)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid bucket")
+		}
+		if bucket < data.TimeUnit || bucket%data.TimeUnit != 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("bucket must be a multiple of %s", data.TimeUnit))
+		}
+	}
+	start = start.Truncate(bucket)
+	if end.Sub(start)/bucket >= maxPoolStatsSeriesLength {
+		return echo.NewHTTPError(http.StatusBadRequest, "too many buckets in the time window")
+	}
+	resp := GetPoolStatsResponse{
+		BlockHeight: cache.BlockHeight,
+		From:        start,
+		To:          end,
+		Bucket:      bucket.String(),
+		Stats:       PoolStats{PoolID: req.ID, PoolData: NewPoolData()},
+		Series:      []GetPoolStatsResponsePoint{},
+	}
+	for i, p := range data.PoolSeries(req.ID, start, end, bucket) {
+		resp.Stats.Add(p)
+		resp.Series = append(resp.Series, GetPoolStatsResponsePoint{
+			StartTime: start.Add(time.Duration(i) * bucket),
+			PoolData:  p,
+		})
 	}
 	return c.JSON(http.StatusOK, resp)
 }
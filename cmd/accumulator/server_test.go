@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCacheManager returns a cache manager under a prefix unique to the test,
+// or skips the test if redis is not available.
+func newTestCacheManager(t *testing.T) (*CacheManager, *redis.Pool) {
+	uri := os.Getenv("GDEX_TEST_REDIS_URI")
+	if uri == "" {
+		uri = "redis://localhost"
+	}
+	rp := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(uri, redis.DialConnectTimeout(3*time.Second))
+		},
+	}
+	t.Cleanup(func() { rp.Close() })
+	conn := rp.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+	cm := NewCacheManager(rp, "gdex-accumulator-test:"+t.Name())
+	clear := func() {
+		conn := rp.Get()
+		defer conn.Close()
+		_, err := conn.Do("DEL", cm.metaKey(), cm.bucketsKey(), cm.updatesKey())
+		require.NoError(t, err)
+	}
+	clear()
+	t.Cleanup(clear)
+	return cm, rp
+}
+
+var testTime = time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+
+// newTestData returns data of three hourly time buckets starting from testTime:
+//   - 00:00, addr1 deposits to pool 1
+//   - 01:00, addr1 and addr2 swap in pool 1 and 2
+//   - 02:00, addr3 withdraws from pool 2
+func newTestData() *Data {
+	data := NewData()
+	data.TimeUnit = time.Hour
+	key := func(h int) string { return data.TimeBucketKey(testTime.Add(time.Duration(h) * time.Hour)) }
+
+	data.DepositCoins(key(0), 1, sdk.NewCoins(sdk.NewInt64Coin("uatom", 10), sdk.NewInt64Coin("uusd", 20)), 40)
+	data.TimeBucket(key(0)).AddActiveAddress("addr1")
+
+	data.SwapCoin(key(1), 1, sdk.NewInt64Coin("uatom", 5), sdk.NewInt64Coin("uusd", 10), 10, 10)
+	data.TimeBucket(key(1)).AddActiveAddress("addr1")
+	data.SwapCoin(key(1), 2, sdk.NewInt64Coin("uusd", 3), sdk.NewInt64Coin("uatom", 1), 3, 2)
+	data.TimeBucket(key(1)).AddActiveAddress("addr2")
+
+	data.WithdrawCoins(key(2), 2, sdk.NewCoins(sdk.NewInt64Coin("uatom", 1)), 2)
+	data.TimeBucket(key(2)).AddActiveAddress("addr3")
+	return data
+}
+
+func TestNewStats(t *testing.T) {
+	data := newTestData()
+	for _, tc := range []struct {
+		name       string
+		start, end time.Time
+		expected   Stats
+	}{
+		{
+			"all",
+			testTime, testTime.Add(2 * time.Hour),
+			Stats{
+				NumActiveAddresses: 3,
+				NumDeposits:        1,
+				NumWithdrawals:     1,
+				NumSwaps:           2,
+				NumTransactions:    4,
+				TransactedCoins:    "17uatom,33uusd",
+				SwapVolume:         "5uatom,3uusd",
+				TransactedUSD:      67,
+				SwapVolumeUSD:      13,
+			},
+		},
+		{
+			// addr1 is active in both buckets, but counted once.
+			"first two buckets",
+			testTime, testTime.Add(time.Hour),
+			Stats{
+				NumActiveAddresses: 2,
+				NumDeposits:        1,
+				NumSwaps:           2,
+				NumTransactions:    3,
+				TransactedCoins:    "16uatom,33uusd",
+				SwapVolume:         "5uatom,3uusd",
+				TransactedUSD:      65,
+				SwapVolumeUSD:      13,
+			},
+		},
+		{
+			// The window covers the buckets its start and end fall into.
+			"inside buckets",
+			testTime.Add(90 * time.Minute), testTime.Add(150 * time.Minute),
+			Stats{
+				NumActiveAddresses: 3,
+				NumWithdrawals:     1,
+				NumSwaps:           2,
+				NumTransactions:    3,
+				TransactedCoins:    "7uatom,13uusd",
+				SwapVolume:         "5uatom,3uusd",
+				TransactedUSD:      27,
+				SwapVolumeUSD:      13,
+			},
+		},
+		{
+			"no buckets",
+			testTime.Add(3 * time.Hour), testTime.Add(4 * time.Hour),
+			Stats{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, NewStats(data, tc.start, tc.end))
+		})
+	}
+}
+
+func TestServer_GetStats(t *testing.T) {
+	cm, _ := newTestCacheManager(t)
+	s := NewServer(cm)
+
+	get := func(target string) (int, GetStatsResponse) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp GetStatsResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec.Code, resp
+	}
+
+	code, _ := get("/stats")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+
+	require.NoError(t, cm.Set(context.Background(), &Cache{BlockHeight: 100, Data: newTestData()}))
+
+	code, resp := get("/stats")
+	require.Equal(t, http.StatusOK, code)
+	require.EqualValues(t, 100, resp.BlockHeight)
+	require.Equal(t, 3, resp.NumActiveAddresses)
+	require.Equal(t, 4, resp.NumTransactions)
+	require.Equal(t, 0, resp.NumActiveAddressesLast24Hours)
+	require.Nil(t, resp.Window)
+
+	code, resp = get("/stats?from=" + unix(testTime.Add(time.Hour)) + "&to=" + unix(testTime.Add(2*time.Hour)))
+	require.Equal(t, http.StatusOK, code)
+	require.NotNil(t, resp.Window)
+	require.Equal(t, testTime.Add(time.Hour), resp.Window.From)
+	require.Equal(t, testTime.Add(2*time.Hour), resp.Window.To)
+	require.Equal(t, 3, resp.Window.NumActiveAddresses)
+	require.Equal(t, 3, resp.Window.NumTransactions)
+
+	// The window starts no earlier than the data.
+	code, resp = get("/stats?from=1&to=" + unix(testTime.Add(time.Hour)))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, testTime, resp.Window.From)
+	require.Equal(t, 2, resp.Window.NumActiveAddresses)
+
+	code, _ = get("/stats?from=" + unix(testTime.Add(time.Hour)) + "&to=" + unix(testTime))
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func unix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func TestServer_GetPoolsStats(t *testing.T) {
+	cm, _ := newTestCacheManager(t)
+	s := NewServer(cm)
+	require.NoError(t, cm.Set(context.Background(), &Cache{BlockHeight: 100, Data: newTestData()}))
+
+	get := func(target string) (int, GetPoolsStatsResponse) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp GetPoolsStatsResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec.Code, resp
+	}
+
+	code, resp := get("/stats/pools")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, testTime, resp.From)
+	require.Equal(t, testTime.Add(2*time.Hour), resp.To)
+	require.Len(t, resp.Pools, 2)
+	require.EqualValues(t, 1, resp.Pools[0].PoolID)
+	require.Equal(t, 1, resp.Pools[0].NumDeposits)
+	require.Equal(t, 1, resp.Pools[0].NumSwapsXToY)
+	require.EqualValues(t, 2, resp.Pools[1].PoolID)
+	require.Equal(t, 1, resp.Pools[1].NumWithdrawals)
+	require.Equal(t, 1, resp.Pools[1].NumSwapsYToX)
+
+	// Pools without data in the window are still listed.
+	code, resp = get("/stats/pools?from=" + unix(testTime.Add(2*time.Hour)))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Pools, 2)
+	require.Equal(t, 0, resp.Pools[0].NumDeposits+resp.Pools[0].NumSwapsXToY)
+	require.Equal(t, 1, resp.Pools[1].NumWithdrawals)
+	require.Equal(t, 0, resp.Pools[1].NumSwapsYToX)
+
+	code, _ = get("/stats/pools?from=" + unix(testTime.Add(time.Hour)) + "&to=" + unix(testTime))
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestServer_GetPoolStats(t *testing.T) {
+	cm, _ := newTestCacheManager(t)
+	s := NewServer(cm)
+	require.NoError(t, cm.Set(context.Background(), &Cache{BlockHeight: 100, Data: newTestData()}))
+
+	get := func(target string) (int, GetPoolStatsResponse) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp GetPoolStatsResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec.Code, resp
+	}
+	type point struct {
+		startTime                    time.Time
+		deposits, swaps, withdrawals int
+	}
+	points := func(resp GetPoolStatsResponse) []point {
+		var ps []point
+		for _, p := range resp.Series {
+			ps = append(ps, point{p.StartTime, p.NumDeposits, p.NumSwapsXToY + p.NumSwapsYToX, p.NumWithdrawals})
+		}
+		return ps
+	}
+
+	code, resp := get("/stats/pools/1")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "1h0m0s", resp.Bucket)
+	require.Equal(t, 1, resp.Stats.NumDeposits)
+	require.Equal(t, 1, resp.Stats.NumSwapsXToY)
+	require.Equal(t, []point{
+		{testTime, 1, 0, 0},
+		{testTime.Add(time.Hour), 0, 1, 0},
+		{testTime.Add(2 * time.Hour), 0, 0, 0},
+	}, points(resp))
+
+	// The window is extended to the start of the bucket it starts in.
+	code, resp = get("/stats/pools/2?bucket=2h&from=" + unix(testTime.Add(time.Hour)))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "2h0m0s", resp.Bucket)
+	require.Equal(t, testTime, resp.From)
+	require.Equal(t, 1, resp.Stats.NumSwapsYToX)
+	require.Equal(t, 1, resp.Stats.NumWithdrawals)
+	require.Equal(t, []point{
+		{testTime, 0, 1, 0},
+		{testTime.Add(2 * time.Hour), 0, 0, 1},
+	}, points(resp))
+
+	for _, target := range []string{
+		"/stats/pools/1?bucket=abc",
+		"/stats/pools/1?bucket=90m",
+		"/stats/pools/1?bucket=30m",
+		"/stats/pools/1?bucket=1h&from=1&to=" + unix(testTime.Add(2*time.Hour)), // too many buckets
+	} {
+		code, _ := get(target)
+		require.Equal(t, http.StatusBadRequest, code, target)
+	}
+	code, _ = get("/stats/pools/3")
+	require.Equal(t, http.StatusNotFound, code)
+}
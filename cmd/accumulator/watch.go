@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	WatchFormatText  = "text"
+	WatchFormatJSONL = "jsonl"
+	WatchFormatCSV   = "csv"
+)
+
+const (
+	WatchRecordTypeDeposit  = "deposit"
+	WatchRecordTypeWithdraw = "withdraw"
+	WatchRecordTypeSwap     = "swap"
+)
+
+// WatchRecord is an activity of a watched address.
+// Coins is set for deposits and withdrawals, and OfferCoin, DemandCoin and
+// SwapPrice are set for swaps.
+type WatchRecord struct {
+	Type       string    `json:"type"`
+	Height     int64     `json:"height"`
+	Time       time.Time `json:"time"`
+	Address    string    `json:"address"`
+	PoolID     uint64    `json:"poolId"`
+	PoolDenoms []string  `json:"poolDenoms"`
+	Coins      string    `json:"coins,omitempty"`
+	OfferCoin  string    `json:"offerCoin,omitempty"`
+	DemandCoin string    `json:"demandCoin,omitempty"`
+	SwapPrice  string    `json:"swapPrice,omitempty"`
+}
+
+var watchRecordCSVHeader = []string{
+	"type", "height", "time", "address", "pool_id", "pool_denoms",
+	"coins", "offer_coin", "demand_coin", "swap_price",
+}
+
+func (r WatchRecord) CSVRecord() []string {
+	return []string{
+		r.Type,
+		strconv.FormatInt(r.Height, 10),
+		r.Time.UTC().Format(time.RFC3339Nano),
+		r.Address,
+		strconv.FormatUint(r.PoolID, 10),
+		strings.Join(r.PoolDenoms, "/"),
+		r.Coins,
+		r.OfferCoin,
+		r.DemandCoin,
+		r.SwapPrice,
+	}
+}
+
+func (r WatchRecord) String() string {
+	prefix := fmt.Sprintf("[%d/%s] %s", r.Height, r.Time.Format(time.RFC3339), r.Address)
+	pool := strings.Join(r.PoolDenoms, "/")
+	switch r.Type {
+	case WatchRecordTypeDeposit:
+		return fmt.Sprintf("%s deposits %s to %s pool", prefix, r.Coins, pool)
+	case WatchRecordTypeWithdraw:
+		return fmt.Sprintf("%s withdraws %s to %s pool", prefix, r.Coins, pool)
+	default:
+		return fmt.Sprintf("%s swaps %s to %s in %s pool", prefix, r.OfferCoin, r.DemandCoin, pool)
+	}
+}
+
+// WatchExporter exports watch records.
+// Records are exported in height order once the blocks they belong to
+// are saved.
+type WatchExporter interface {
+	Export(ctx context.Context, r WatchRecord) error
+	Close() error
+}
+
+// WriterWatchExporter writes watch records to a writer in a format.
+type WriterWatchExporter struct {
+	w      io.Writer
+	format string
+	cw     *csv.Writer
+	mux    sync.Mutex
+}
+
+func NewWriterWatchExporter(w io.Writer, format string) (*WriterWatchExporter, error) {
+	e := &WriterWatchExporter{w: w, format: format}
+	switch format {
+	case WatchFormatText, WatchFormatJSONL:
+	case WatchFormatCSV:
+		e.cw = csv.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown watch format: %q", format)
+	}
+	return e, nil
+}
+
+// NewFileWatchExporter appends watch records to a file.
+// For the csv format, the header is written when the file is empty.
+func NewFileWatchExporter(name, format string) (*WriterWatchExporter, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	e, err := NewWriterWatchExporter(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if format == WatchFormatCSV {
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("stat: %w", err)
+		}
+		if fi.Size() == 0 {
+			if err := e.writeCSV(watchRecordCSVHeader); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("write header: %w", err)
+			}
+		}
+	}
+	return e, nil
+}
+
+func (e *WriterWatchExporter) writeCSV(record []string) error {
+	if err := e.cw.Write(record); err != nil {
+		return err
+	}
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+func (e *WriterWatchExporter) Export(_ context.Context, r WatchRecord) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	switch e.format {
+	case WatchFormatText:
+		_, err := fmt.Fprintln(e.w, r.String())
+		return err
+	case WatchFormatJSONL:
+		return jsoniter.NewEncoder(e.w).Encode(r)
+	default:
+		return e.writeCSV(r.CSVRecord())
+	}
+}
+
+func (e *WriterWatchExporter) Close() error {
+	if c, ok := e.w.(io.Closer); ok && e.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+const (
+	webhookQueueSize    = 1024
+	webhookMaxAttempts  = 8
+	webhookMinBackoff   = time.Second
+	webhookMaxBackoff   = time.Minute
+	webhookCloseTimeout = 30 * time.Second
+)
+
+// WebhookWatchExporter POSTs each watch record as JSON to a URL.
+// Records are queued and delivered in the background, so that a slow webhook
+// blocks the accumulation only when the queue is full.
+// Failed deliveries are retried with exponential backoff, except for client errors,
+// and records which still fail are dropped with a log.
+type WebhookWatchExporter struct {
+	url         string
+	hc          *http.Client
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+	queue       chan WatchRecord
+	closing     chan struct{}
+	closeOnce   sync.Once
+	done        chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	dropped     int64
+}
+
+func NewWebhookWatchExporter(url string) *WebhookWatchExporter {
+	return newWebhookWatchExporter(url, webhookMinBackoff, webhookMaxBackoff, webhookMaxAttempts)
+}
+
+func newWebhookWatchExporter(url string, minBackoff, maxBackoff time.Duration, maxAttempts int) *WebhookWatchExporter {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &WebhookWatchExporter{
+		url:         url,
+		hc:          &http.Client{Timeout: 10 * time.Second},
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		maxAttempts: maxAttempts,
+		queue:       make(chan WatchRecord, webhookQueueSize),
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	go e.run()
+	return e
+}
+
+// Export queues the record, waiting for room in the queue if it is full.
+func (e *WebhookWatchExporter) Export(ctx context.Context, r WatchRecord) error {
+	select {
+	case <-e.closing:
+		return fmt.Errorf("webhook watch exporter is closed")
+	default:
+	}
+	select {
+	case e.queue <- r:
+		return nil
+	case <-e.closing:
+		return fmt.Errorf("webhook watch exporter is closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *WebhookWatchExporter) run() {
+	defer close(e.done)
+	for {
+		select {
+		case r := <-e.queue:
+			e.deliver(r)
+		case <-e.closing:
+			for {
+				select {
+				case r := <-e.queue:
+					e.deliver(r)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *WebhookWatchExporter) deliver(r WatchRecord) {
+	backoff := e.minBackoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := e.post(e.ctx, r)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt >= e.maxAttempts || e.ctx.Err() != nil {
+			atomic.AddInt64(&e.dropped, 1)
+			log.Printf("dropping watch record after %d attempts: %v", attempt, err)
+			return
+		}
+		select {
+		case <-e.ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > e.maxBackoff {
+			backoff = e.maxBackoff
+		}
+	}
+}
+
+// post sends the record and reports whether a failure is worth retrying.
+func (e *WebhookWatchExporter) post(ctx context.Context, r WatchRecord) (retryable bool, err error) {
+	bz, err := jsoniter.Marshal(r)
+	if err != nil {
+		return false, fmt.Errorf("marshal record: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(bz))
+	if err != nil {
+		return false, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.hc.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	defer io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		retryable := resp.StatusCode/100 != 4 || resp.StatusCode == http.StatusTooManyRequests
+		return retryable, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// Close stops accepting records and waits for the queued records to be delivered,
+// for up to webhookCloseTimeout.
+func (e *WebhookWatchExporter) Close() error {
+	e.closeOnce.Do(func() { close(e.closing) })
+	select {
+	case <-e.done:
+	case <-time.After(webhookCloseTimeout):
+		e.cancel()
+		<-e.done
+	}
+	e.cancel()
+	if n := atomic.LoadInt64(&e.dropped); n > 0 {
+		return fmt.Errorf("dropped %d watch records", n)
+	}
+	return nil
+}
+
+type multiWatchExporter []WatchExporter
+
+func (es multiWatchExporter) Export(ctx context.Context, r WatchRecord) error {
+	for _, e := range es {
+		if err := e.Export(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (es multiWatchExporter) Close() error {
+	var firstErr error
+	for _, e := range es {
+		if err := e.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WatchList is a set of watched addresses, which can be reloaded from a file.
+type WatchList struct {
+	static  []string
+	file    string
+	modTime time.Time
+	mux     sync.RWMutex
+	addrs   map[string]struct{}
+}
+
+// NewWatchList returns a watch list of the static addresses and the
+// addresses in the file, if any.
+func NewWatchList(static []string, file string) (*WatchList, error) {
+	wl := &WatchList{static: static, file: file}
+	wl.set(nil)
+	if _, err := wl.Reload(); err != nil {
+		return nil, err
+	}
+	return wl, nil
+}
+
+func (wl *WatchList) set(fileAddrs []string) {
+	addrs := make(map[string]struct{})
+	for _, addr := range wl.static {
+		addrs[addr] = struct{}{}
+	}
+	for _, addr := range fileAddrs {
+		addrs[addr] = struct{}{}
+	}
+	wl.mux.Lock()
+	defer wl.mux.Unlock()
+	wl.addrs = addrs
+}
+
+// Reload reloads the watch list file if it has been modified since
+// the last load. The file has an address per line, and lines starting
+// with '#' are ignored.
+func (wl *WatchList) Reload() (bool, error) {
+	if wl.file == "" {
+		return false, nil
+	}
+	fi, err := os.Stat(wl.file)
+	if err != nil {
+		return false, err
+	}
+	if fi.ModTime().Equal(wl.modTime) {
+		return false, nil
+	}
+	f, err := os.Open(wl.file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	var addrs []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addrs = append(addrs, line)
+	}
+	if err := sc.Err(); err != nil {
+		return false, fmt.Errorf("read watch list: %w", err)
+	}
+	wl.set(addrs)
+	wl.modTime = fi.ModTime()
+	return true, nil
+}
+
+func (wl *WatchList) Contains(addr string) bool {
+	wl.mux.RLock()
+	defer wl.mux.RUnlock()
+	_, ok := wl.addrs[addr]
+	return ok
+}
+
+func (wl *WatchList) Len() int {
+	wl.mux.RLock()
+	defer wl.mux.RUnlock()
+	return len(wl.addrs)
+}
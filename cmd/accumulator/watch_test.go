@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testDepositRecord = WatchRecord{
+		Type:       WatchRecordTypeDeposit,
+		Height:     10,
+		Time:       testTime,
+		Address:    "addr1",
+		PoolID:     1,
+		PoolDenoms: []string{"uatom", "uusd"},
+		Coins:      "10uatom,20uusd",
+	}
+	testSwapRecord = WatchRecord{
+		Type:       WatchRecordTypeSwap,
+		Height:     11,
+		Time:       testTime.Add(time.Second),
+		Address:    "addr2",
+		PoolID:     1,
+		PoolDenoms: []string{"uatom", "uusd"},
+		OfferCoin:  "5uatom",
+		DemandCoin: "10uusd",
+		SwapPrice:  "2.000000000000000000",
+	}
+)
+
+func TestWriterWatchExporter(t *testing.T) {
+	for _, tc := range []struct {
+		format   string
+		expected string
+	}{
+		{
+			WatchFormatText,
+			"[10/2021-05-04T00:00:00Z] addr1 deposits 10uatom,20uusd to uatom/uusd pool\n" +
+				"[11/2021-05-04T00:00:01Z] addr2 swaps 5uatom to 10uusd in uatom/uusd pool\n",
+		},
+		{
+			WatchFormatJSONL,
+			`{"type":"deposit","height":10,"time":"2021-05-04T00:00:00Z","address":"addr1","poolId":1,"poolDenoms":["uatom","uusd"],"coins":"10uatom,20uusd"}` + "\n" +
+				`{"type":"swap","height":11,"time":"2021-05-04T00:00:01Z","address":"addr2","poolId":1,"poolDenoms":["uatom","uusd"],"offerCoin":"5uatom","demandCoin":"10uusd","swapPrice":"2.000000000000000000"}` + "\n",
+		},
+		{
+			WatchFormatCSV,
+			"deposit,10,2021-05-04T00:00:00Z,addr1,1,uatom/uusd,\"10uatom,20uusd\",,,\n" +
+				"swap,11,2021-05-04T00:00:01Z,addr2,1,uatom/uusd,,5uatom,10uusd,2.000000000000000000\n",
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			e, err := NewWriterWatchExporter(&buf, tc.format)
+			require.NoError(t, err)
+			require.NoError(t, e.Export(context.Background(), testDepositRecord))
+			require.NoError(t, e.Export(context.Background(), testSwapRecord))
+			require.NoError(t, e.Close())
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+
+	_, err := NewWriterWatchExporter(io.Discard, "xml")
+	require.Error(t, err)
+}
+
+func TestNewFileWatchExporter(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "watch.csv")
+	// The header is written only when the file is empty, so that the file
+	// can be appended to across runs.
+	for _, r := range []WatchRecord{testDepositRecord, testSwapRecord} {
+		e, err := NewFileWatchExporter(name, WatchFormatCSV)
+		require.NoError(t, err)
+		require.NoError(t, e.Export(context.Background(), r))
+		require.NoError(t, e.Close())
+	}
+	bz, err := os.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t,
+		"type,height,time,address,pool_id,pool_denoms,coins,offer_coin,demand_coin,swap_price\n"+
+			"deposit,10,2021-05-04T00:00:00Z,addr1,1,uatom/uusd,\"10uatom,20uusd\",,,\n"+
+			"swap,11,2021-05-04T00:00:01Z,addr2,1,uatom/uusd,,5uatom,10uusd,2.000000000000000000\n",
+		string(bz))
+}
+
+func TestWebhookWatchExporter(t *testing.T) {
+	var (
+		mux      sync.Mutex
+		attempts = make(map[int64]int)
+		received []WatchRecord
+	)
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+		var rec WatchRecord
+		require.NoError(t, jsoniter.NewDecoder(r.Body).Decode(&rec))
+		mux.Lock()
+		defer mux.Unlock()
+		attempts[rec.Height]++
+		switch {
+		case rec.Height == 10 && attempts[rec.Height] < 3: // fails twice, then succeeds
+			w.WriteHeader(http.StatusInternalServerError)
+		case rec.Height == 11: // never retried
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			received = append(received, rec)
+		}
+	}))
+	defer srv.Close()
+
+	e := newWebhookWatchExporter(srv.URL, time.Millisecond, 4*time.Millisecond, 5)
+	// Records are queued even while the webhook does not respond.
+	for _, r := range []WatchRecord{testDepositRecord, testSwapRecord, {Type: WatchRecordTypeWithdraw, Height: 12}} {
+		require.NoError(t, e.Export(context.Background(), r))
+	}
+	close(block)
+	// Close waits for the queued records to be delivered.
+	require.EqualError(t, e.Close(), "dropped 1 watch records")
+	require.Error(t, e.Export(context.Background(), testDepositRecord))
+
+	require.Equal(t, map[int64]int{10: 3, 11: 1, 12: 1}, attempts)
+	require.Len(t, received, 2)
+	require.Equal(t, testDepositRecord.Address, received[0].Address)
+	require.EqualValues(t, 12, received[1].Height)
+}
+
+func TestWebhookWatchExporter_MaxAttempts(t *testing.T) {
+	var (
+		mux      sync.Mutex
+		attempts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		attempts++
+		mux.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	e := newWebhookWatchExporter(srv.URL, time.Millisecond, time.Millisecond, 3)
+	require.NoError(t, e.Export(context.Background(), testDepositRecord))
+	require.EqualError(t, e.Close(), "dropped 1 watch records")
+	require.Equal(t, 3, attempts)
+}
+
+func TestWatchList_Reload(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "watch.txt")
+	require.NoError(t, os.WriteFile(name, []byte("addr2\n\n# addr3\n  addr4  \n"), 0644))
+
+	wl, err := NewWatchList([]string{"addr1"}, name)
+	require.NoError(t, err)
+	require.Equal(t, 3, wl.Len())
+	for addr, expected := range map[string]bool{"addr1": true, "addr2": true, "addr3": false, "addr4": true} {
+		require.Equal(t, expected, wl.Contains(addr), addr)
+	}
+
+	reloaded, err := wl.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	// Static addresses are kept, and addresses removed from the file are removed.
+	require.NoError(t, os.WriteFile(name, []byte("addr3\n"), 0644))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(name, modTime, modTime))
+	reloaded, err = wl.Reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	require.Equal(t, 2, wl.Len())
+	require.True(t, wl.Contains("addr1"))
+	require.False(t, wl.Contains("addr2"))
+	require.True(t, wl.Contains("addr3"))
+
+	require.NoError(t, os.Remove(name))
+	_, err = wl.Reload()
+	require.Error(t, err)
+	require.Equal(t, 2, wl.Len())
+
+	wl, err = NewWatchList([]string{"addr1"}, "")
+	require.NoError(t, err)
+	reloaded, err = wl.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+	require.Equal(t, 1, wl.Len())
+}
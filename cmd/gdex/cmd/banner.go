@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/schema"
+	"github.com/b-harvest/gravity-dex-backend/service/store"
+)
+
+// bannerActor is the actor of the audit logs recorded by the banner commands.
+const bannerActor = "cli"
+
+func BannerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "banner",
+		Short: "manage banners",
+	}
+	cmd.AddCommand(BannerListCmd())
+	cmd.AddCommand(BannerAddCmd())
+	cmd.AddCommand(BannerUpdateCmd())
+	cmd.AddCommand(BannerDeleteCmd())
+	cmd.AddCommand(BannerImportCmd())
+	return cmd
+}
+
+// withBannerStore connects to the database the server reads banners from.
+func withBannerStore(fn func(ctx context.Context, ss *store.Service) error) error {
+	cfg, err := config.Load("config.yml")
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	if err := cfg.Server.Store.Validate(); err != nil {
+		return fmt.Errorf("validate store config: %w", err)
+	}
+	ctx := context.Background()
+	mc, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.Server.MongoDB.URI))
+	if err != nil {
+		return fmt.Errorf("connect mongodb: %w", err)
+	}
+	defer mc.Disconnect(ctx)
+	ss := store.NewService(cfg.Server.Store, mc)
+	if _, err := ss.EnsureDBIndexes(ctx); err != nil {
+		return fmt.Errorf("ensure db indexes: %w", err)
+	}
+	n, err := ss.MigrateBanners(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate banners: %w", err)
+	}
+	if n > 0 {
+		fmt.Printf("migrated %d banners without an id\n", n)
+	}
+	return fn(ctx, ss)
+}
+
+func saveBanner(ctx context.Context, ss *store.Service, b schema.Banner, allowOverlap bool) error {
+	if err := b.Validate(); err != nil {
+		return fmt.Errorf("invalid banner %q: %w", b.ID, err)
+	}
+	var created bool
+	if err := ss.WithAuditLog(ctx, schema.AuditLog{
+		Actor:     bannerActor,
+		Action:    schema.AuditLogActionSaveBanner,
+		BannerID:  b.ID,
+		CreatedAt: time.Now(),
+	}, func(*schema.AuditLog) error {
+		var err error
+		created, err = ss.SaveBanner(ctx, b, allowOverlap)
+		return err
+	}); err != nil {
+		var overlapErr *store.BannerOverlapError
+		if errors.As(err, &overlapErr) {
+			return fmt.Errorf("%w; use --allow-overlap to save it anyway", err)
+		}
+		return fmt.Errorf("save banner %q: %w", b.ID, err)
+	}
+	if created {
+		fmt.Printf("created banner %q\n", b.ID)
+	} else {
+		fmt.Printf("saved banner %q\n", b.ID)
+	}
+	return nil
+}
+
+func BannerListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list banners",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return withBannerStore(func(ctx context.Context, ss *store.Service) error {
+				bs, err := ss.Banners(ctx)
+				if err != nil {
+					return fmt.Errorf("get banners: %w", err)
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tVISIBLE AT\tSTARTS AT\tENDS AT\tTEXT")
+				for _, b := range bs {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", b.ID,
+						b.VisibleAt.Format(time.RFC3339), b.StartsAt.Format(time.RFC3339), b.EndsAt.Format(time.RFC3339), b.Text)
+				}
+				return w.Flush()
+			})
+		},
+	}
+	return cmd
+}
+
+type bannerFlags struct {
+	upcomingText, text, url     string
+	visibleAt, startsAt, endsAt string
+	allowOverlap                bool
+}
+
+func (f *bannerFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.upcomingText, "upcoming-text", "", "text shown before the banner starts")
+	cmd.Flags().StringVar(&f.text, "text", "", "text shown after the banner starts")
+	cmd.Flags().StringVar(&f.url, "url", "", "link of the banner")
+	cmd.Flags().StringVar(&f.visibleAt, "visible-at", "", "time when the banner becomes visible, in RFC3339 (default is --starts-at)")
+	cmd.Flags().StringVar(&f.startsAt, "starts-at", "", "time when the banner starts, in RFC3339")
+	cmd.Flags().StringVar(&f.endsAt, "ends-at", "", "time when the banner ends, in RFC3339")
+	cmd.Flags().BoolVar(&f.allowOverlap, "allow-overlap", false, "save the banner even if it overlaps others")
+}
+
+// apply sets the fields of the banner given by the flags.
+func (f *bannerFlags) apply(cmd *cobra.Command, b *schema.Banner) error {
+	if cmd.Flags().Changed("upcoming-text") {
+		b.UpcomingText = f.upcomingText
+	}
+	if cmd.Flags().Changed("text") {
+		b.Text = f.text
+	}
+	if cmd.Flags().Changed("url") {
+		b.URL = f.url
+	}
+	for _, x := range []struct {
+		name string
+		v    string
+		t    *time.Time
+	}{
+		{"visible-at", f.visibleAt, &b.VisibleAt},
+		{"starts-at", f.startsAt, &b.StartsAt},
+		{"ends-at", f.endsAt, &b.EndsAt},
+	} {
+		if !cmd.Flags().Changed(x.name) {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, x.v)
+		if err != nil {
+			return fmt.Errorf("parse --%s: %w", x.name, err)
+		}
+		*x.t = t
+	}
+	return nil
+}
+
+func BannerAddCmd() *cobra.Command {
+	var f bannerFlags
+	cmd := &cobra.Command{
+		Use:   "add [id]",
+		Short: "add a banner",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			b := schema.Banner{ID: args[0]}
+			if err := f.apply(cmd, &b); err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("visible-at") {
+				b.VisibleAt = b.StartsAt
+			}
+			return withBannerStore(func(ctx context.Context, ss *store.Service) error {
+				if _, err := ss.BannerByID(ctx, b.ID); err == nil {
+					return fmt.Errorf("banner %q already exists", b.ID)
+				} else if !errors.Is(err, mongo.ErrNoDocuments) {
+					return fmt.Errorf("get banner: %w", err)
+				}
+				return saveBanner(ctx, ss, b, f.allowOverlap)
+			})
+		},
+	}
+	f.register(cmd)
+	return cmd
+}
+
+func BannerUpdateCmd() *cobra.Command {
+	var f bannerFlags
+	cmd := &cobra.Command{
+		Use:   "update [id]",
+		Short: "update fields of a banner",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return withBannerStore(func(ctx context.Context, ss *store.Service) error {
+				b, err := ss.BannerByID(ctx, args[0])
+				if err != nil {
+					if errors.Is(err, mongo.ErrNoDocuments) {
+						return fmt.Errorf("banner %q not found", args[0])
+					}
+					return fmt.Errorf("get banner: %w", err)
+				}
+				if err := f.apply(cmd, &b); err != nil {
+					return err
+				}
+				return saveBanner(ctx, ss, b, f.allowOverlap)
+			})
+		},
+	}
+	f.register(cmd)
+	return cmd
+}
+
+func BannerDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete [id]",
+		Short: "delete a banner",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return withBannerStore(func(ctx context.Context, ss *store.Service) error {
+				if err := ss.WithAuditLog(ctx, schema.AuditLog{
+					Actor:     bannerActor,
+					Action:    schema.AuditLogActionDeleteBanner,
+					BannerID:  args[0],
+					CreatedAt: time.Now(),
+				}, func(*schema.AuditLog) error {
+					return ss.DeleteBanner(ctx, args[0])
+				}); err != nil {
+					if errors.Is(err, mongo.ErrNoDocuments) {
+						return fmt.Errorf("banner %q not found", args[0])
+					}
+					return fmt.Errorf("delete banner: %w", err)
+				}
+				fmt.Printf("deleted banner %q\n", args[0])
+				return nil
+			})
+		},
+	}
+	return cmd
+}
+
+// decodeBanners decodes banners to import, and validates all of them first so that
+// nothing is saved if any of them is invalid.
+// Banners without an id, as in files of banner-importer, are given ids derived from them.
+func decodeBanners(r io.Reader) ([]schema.Banner, error) {
+	var bs []schema.Banner
+	if err := json.NewDecoder(r).Decode(&bs); err != nil {
+		return nil, fmt.Errorf("decode banners: %w", err)
+	}
+	ids := make(map[string]struct{})
+	for i := range bs {
+		if bs[i].ID == "" {
+			bs[i].ID = bs[i].DerivedID()
+		}
+		if err := bs[i].Validate(); err != nil {
+			return nil, fmt.Errorf("invalid banner %q: %w", bs[i].ID, err)
+		}
+		if _, ok := ids[bs[i].ID]; ok {
+			return nil, fmt.Errorf("duplicate banner %q", bs[i].ID)
+		}
+		ids[bs[i].ID] = struct{}{}
+	}
+	return bs, nil
+}
+
+func BannerImportCmd() *cobra.Command {
+	var allowOverlap bool
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "create or replace banners from a json file, banners.json by default",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			name := "banners.json"
+			if len(args) > 0 {
+				name = args[0]
+			}
+			f, err := os.Open(name)
+			if err != nil {
+				return fmt.Errorf("open file: %w", err)
+			}
+			defer f.Close()
+			bs, err := decodeBanners(f)
+			if err != nil {
+				return err
+			}
+			return withBannerStore(func(ctx context.Context, ss *store.Service) error {
+				// Check overlaps of all banners first, so that nothing is saved if any of them overlaps.
+				if !allowOverlap {
+					if err := ss.CheckBannerOverlaps(ctx, bs); err != nil {
+						return fmt.Errorf("%w; use --allow-overlap to import anyway", err)
+					}
+				}
+				for _, b := range bs {
+					if err := saveBanner(ctx, ss, b, true); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&allowOverlap, "allow-overlap", false, "save banners even if they overlap others")
+	return cmd
+}
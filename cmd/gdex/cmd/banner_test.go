@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBanners(t *testing.T) {
+	// A file of banner-importer, whose banners have no id.
+	bs, err := decodeBanners(strings.NewReader(`[
+  {
+    "UpcomingText": "event 1 is coming",
+    "Text": "event 1",
+    "URL": "https://example.com",
+    "VisibleAt": "2021-05-04T08:30:00Z",
+    "StartsAt": "2021-05-04T09:00:00Z",
+    "EndsAt": "2021-05-04T09:10:00Z"
+  },
+  {
+    "ID": "event-2",
+    "Text": "event 2",
+    "VisibleAt": "2021-05-04T17:30:00Z",
+    "StartsAt": "2021-05-04T18:00:00Z",
+    "EndsAt": "2021-05-04T18:10:00Z"
+  }
+]`))
+	require.NoError(t, err)
+	require.Len(t, bs, 2)
+	require.Equal(t, bs[0].DerivedID(), bs[0].ID)
+	require.True(t, strings.HasPrefix(bs[0].ID, "20210504T090000Z-"))
+	require.Equal(t, "event 1 is coming", bs[0].UpcomingText)
+	require.Equal(t, "https://example.com", bs[0].URL)
+	require.True(t, time.Date(2021, time.May, 4, 8, 30, 0, 0, time.UTC).Equal(bs[0].VisibleAt))
+	require.Equal(t, "event-2", bs[1].ID)
+
+	// Importing the same file again gives the same ids.
+	bs2, err := decodeBanners(strings.NewReader(`[{"Text": "event 1", "VisibleAt": "2021-05-04T08:30:00Z", "StartsAt": "2021-05-04T09:00:00Z", "EndsAt": "2021-05-04T09:10:00Z"}]`))
+	require.NoError(t, err)
+	require.Equal(t, bs[0].ID, bs2[0].ID)
+
+	for _, tc := range []struct {
+		name, json, err string
+	}{
+		{
+			"invalid",
+			`[{"ID": "event-1", "Text": "event 1", "StartsAt": "2021-05-04T09:00:00Z", "EndsAt": "2021-05-04T09:00:00Z"}]`,
+			`invalid banner "event-1": startsAt must be before endsAt`,
+		},
+		{
+			"duplicate",
+			`[{"ID": "event-1", "Text": "event 1", "StartsAt": "2021-05-04T09:00:00Z", "EndsAt": "2021-05-04T10:00:00Z"},
+			  {"ID": "event-1", "Text": "event 2", "StartsAt": "2021-05-04T11:00:00Z", "EndsAt": "2021-05-04T12:00:00Z"}]`,
+			`duplicate banner "event-1"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodeBanners(strings.NewReader(tc.json))
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
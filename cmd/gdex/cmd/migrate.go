@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/service/pricetable"
+	"github.com/b-harvest/gravity-dex-backend/service/store"
+)
+
+func MigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "migrate database",
+	}
+	cmd.AddCommand(MigrateAmountsCmd())
+	cmd.AddCommand(MigrateBannersCmd())
+	cmd.AddCommand(MigrateUsernamesCmd())
+	cmd.AddCommand(MigrateSnapshotPricesCmd())
+	return cmd
+}
+
+func MigrateAmountsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "amounts",
+		Short: "rewrite coin amounts stored as numbers as decimal strings",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			cfg, err := config.Load("config.yml")
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			if err := cfg.Transformer.Store.Validate(); err != nil {
+				return fmt.Errorf("validate store config: %w", err)
+			}
+
+			logger, err := cfg.Transformer.Log.Build()
+			if err != nil {
+				return fmt.Errorf("build logger: %w", err)
+			}
+			defer logger.Sync()
+
+			mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.Transformer.MongoDB.URI))
+			if err != nil {
+				return fmt.Errorf("connect mongodb: %w", err)
+			}
+			defer mc.Disconnect(context.Background())
+
+			ss := store.NewService(cfg.Transformer.Store, mc)
+			n, err := ss.MigrateAmounts(context.Background())
+			if err != nil {
+				return fmt.Errorf("migrate amounts: %w", err)
+			}
+			logger.Info("migrated amounts", zap.Int64("documents", n))
+			return nil
+		},
+	}
+	return cmd
+}
+
+func MigrateBannersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "banners",
+		Short: "give banners imported by older versions ids derived from them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			cfg, err := config.Load("config.yml")
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			if err := cfg.Server.Store.Validate(); err != nil {
+				return fmt.Errorf("validate store config: %w", err)
+			}
+
+			logger, err := cfg.Server.Log.Build()
+			if err != nil {
+				return fmt.Errorf("build logger: %w", err)
+			}
+			defer logger.Sync()
+
+			mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.Server.MongoDB.URI))
+			if err != nil {
+				return fmt.Errorf("connect mongodb: %w", err)
+			}
+			defer mc.Disconnect(context.Background())
+
+			ss := store.NewService(cfg.Server.Store, mc)
+			n, err := ss.MigrateBanners(context.Background())
+			if err != nil {
+				return fmt.Errorf("migrate banners: %w", err)
+			}
+			logger.Info("migrated banners", zap.Int64("banners", n))
+			return nil
+		},
+	}
+	return cmd
+}
+
+func MigrateUsernamesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "usernames",
+		Short: "list usernames shared by several accounts, which must be renamed before usernames are made unique",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			cfg, err := config.Load("config.yml")
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			if err := cfg.Server.Store.Validate(); err != nil {
+				return fmt.Errorf("validate store config: %w", err)
+			}
+
+			mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.Server.MongoDB.URI))
+			if err != nil {
+				return fmt.Errorf("connect mongodb: %w", err)
+			}
+			defer mc.Disconnect(context.Background())
+
+			ss := store.NewService(cfg.Server.Store, mc)
+			dups, err := ss.DuplicateUsernames(context.Background())
+			if err != nil {
+				return fmt.Errorf("get duplicate usernames: %w", err)
+			}
+			if len(dups) == 0 {
+				fmt.Println("no duplicate usernames")
+				return nil
+			}
+			for _, dup := range dups {
+				fmt.Printf("%s\t%s\n", dup.Username, strings.Join(dup.Addresses, ","))
+			}
+			return fmt.Errorf("%d usernames are shared by several accounts", len(dups))
+		},
+	}
+	return cmd
+}
+
+func MigrateSnapshotPricesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot-prices [price-history-file]",
+		Short: "set the prices of pool snapshots without prices from a price history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			cfg, err := config.Load("config.yml")
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			if err := cfg.Server.Store.Validate(); err != nil {
+				return fmt.Errorf("validate store config: %w", err)
+			}
+
+			logger, err := cfg.Server.Log.Build()
+			if err != nil {
+				return fmt.Errorf("build logger: %w", err)
+			}
+			defer logger.Sync()
+
+			h, err := pricetable.LoadHistory(args[0], cfg.Server.PriceTable.DenomMetadataMap())
+			if err != nil {
+				return fmt.Errorf("load price history: %w", err)
+			}
+
+			mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.Server.MongoDB.URI))
+			if err != nil {
+				return fmt.Errorf("connect mongodb: %w", err)
+			}
+			defer mc.Disconnect(context.Background())
+
+			ss := store.NewService(cfg.Server.Store, mc)
+			n, err := ss.BackfillPoolSnapshotPrices(context.Background(), h.Price)
+			if err != nil {
+				return fmt.Errorf("backfill pool snapshot prices: %w", err)
+			}
+			logger.Info("set pool snapshot prices", zap.Int("snapshots", n))
+			return nil
+		},
+	}
+	return cmd
+}
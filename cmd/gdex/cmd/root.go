@@ -10,5 +10,7 @@ func RootCmd() *cobra.Command {
 	cmd.AddCommand(TransformerCmd())
 	cmd.AddCommand(ServerCmd())
 	cmd.AddCommand(DumperCmd())
+	cmd.AddCommand(MigrateCmd())
+	cmd.AddCommand(BannerCmd())
 	return cmd
 }
@@ -99,6 +99,18 @@ func ServerCmd() *cobra.Command {
 				}
 				return nil
 			})
+			eg.Go(func() error {
+				if err := s.RunLeaderElection(ctx2); err != nil {
+					return fmt.Errorf("run leader election: %w", err)
+				}
+				return nil
+			})
+			eg.Go(func() error {
+				if err := s.RunStreamHub(ctx2); err != nil {
+					return fmt.Errorf("run stream hub: %w", err)
+				}
+				return nil
+			})
 
 			quit := make(chan os.Signal, 1)
 			signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -10,12 +10,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/spf13/cobra"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 
 	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/metrics"
 	"github.com/b-harvest/gravity-dex-backend/service/store"
 	"github.com/b-harvest/gravity-dex-backend/transformer"
 )
@@ -27,40 +29,11 @@ func TransformerCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cmd.SilenceUsage = true
 
-			cfg, err := config.Load("config.yml")
+			t, logger, cleanup, err := setupTransformer()
 			if err != nil {
-				return fmt.Errorf("load config: %w", err)
-			}
-			if err := cfg.Transformer.Validate(); err != nil {
-				return fmt.Errorf("validate transformer config: %w", err)
-			}
-
-			logger, err := cfg.Transformer.Log.Build()
-			if err != nil {
-				return fmt.Errorf("build logger: %w", err)
-			}
-			defer logger.Sync()
-
-			mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.Transformer.MongoDB.URI))
-			if err != nil {
-				return fmt.Errorf("connect mongodb: %w", err)
-			}
-			defer mc.Disconnect(context.Background())
-			if err := mc.Ping(context.Background(), nil); err != nil {
-				return fmt.Errorf("ping mongodb: %w", err)
-			}
-
-			ss := store.NewService(cfg.Transformer.Store, mc)
-			names, err := ss.EnsureDBIndexes(context.Background())
-			if err != nil {
-				return fmt.Errorf("ensure db indexes: %w", err)
-			}
-			logger.Info("created db indexes", zap.Strings("names", names))
-
-			t, err := transformer.New(cfg.Transformer, ss, logger)
-			if err != nil {
-				return fmt.Errorf("new transformer: %w", err)
+				return err
 			}
+			defer cleanup()
 
 			logger.Info("started")
 
@@ -68,6 +41,16 @@ func TransformerCmd() *cobra.Command {
 			defer cancel()
 
 			var wg sync.WaitGroup
+			if addr := t.Config().MetricsAddr; addr != "" {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					logger.Info("serving metrics", zap.String("addr", addr))
+					if err := metrics.Serve(ctx, addr); err != nil {
+						logger.Error("failed to serve metrics", zap.Error(err))
+					}
+				}()
+			}
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -98,5 +81,125 @@ func TransformerCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.AddCommand(TransformerRollbackCmd())
+	cmd.AddCommand(TransformerReindexCmd())
+	return cmd
+}
+
+func TransformerRollbackCmd() *cobra.Command {
+	var to int64
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "roll back the state to the latest state snapshot at or below a block height",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return rollback(to)
+		},
+	}
+	cmd.Flags().Int64Var(&to, "to", 0, "block height to roll back to")
+	_ = cmd.MarkFlagRequired("to")
 	return cmd
 }
+
+func TransformerReindexCmd() *cobra.Command {
+	var from int64
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "roll back the state so that the transformer reprocesses blocks from a block height",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			if from < 1 {
+				return fmt.Errorf("'from' must be positive")
+			}
+			return rollback(from - 1)
+		},
+	}
+	cmd.Flags().Int64Var(&from, "from", 0, "block height to reprocess from")
+	_ = cmd.MarkFlagRequired("from")
+	return cmd
+}
+
+func rollback(blockHeight int64) error {
+	if blockHeight < 0 {
+		return fmt.Errorf("block height must not be negative")
+	}
+	t, logger, cleanup, err := setupTransformer()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	h, err := t.Rollback(context.Background(), blockHeight)
+	if err != nil {
+		return fmt.Errorf("rollback: %w", err)
+	}
+	logger.Info("rolled back", zap.Int64("height", h))
+	return nil
+}
+
+func setupTransformer() (*transformer.Transformer, *zap.Logger, func(), error) {
+	cfg, err := config.Load("config.yml")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("load config: %w", err)
+	}
+	if err := cfg.Transformer.Validate(); err != nil {
+		return nil, nil, nil, fmt.Errorf("validate transformer config: %w", err)
+	}
+
+	logger, err := cfg.Transformer.Log.Build()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("build logger: %w", err)
+	}
+
+	mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.Transformer.MongoDB.URI))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("connect mongodb: %w", err)
+	}
+	cleanup := func() {
+		mc.Disconnect(context.Background())
+		logger.Sync()
+	}
+	if err := mc.Ping(context.Background(), nil); err != nil {
+		cleanup()
+		return nil, nil, nil, fmt.Errorf("ping mongodb: %w", err)
+	}
+
+	ss := store.NewService(cfg.Transformer.Store, mc)
+	names, err := ss.EnsureDBIndexes(context.Background())
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, fmt.Errorf("ensure db indexes: %w", err)
+	}
+	logger.Info("created db indexes", zap.Strings("names", names))
+	if cfg.Transformer.UseTransaction {
+		ok, err := ss.SupportsTransactions(context.Background())
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, fmt.Errorf("check transaction support: %w", err)
+		}
+		if !ok {
+			cleanup()
+			return nil, nil, nil, fmt.Errorf("'use_transaction' is set but mongodb does not support transactions; run it as a replica set")
+		}
+	}
+
+	t, err := transformer.New(cfg.Transformer, ss, logger)
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, fmt.Errorf("new transformer: %w", err)
+	}
+	if cfg.Transformer.Redis.URI != "" {
+		rp := &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.DialURL(cfg.Transformer.Redis.URI)
+			},
+		}
+		mongoCleanup := cleanup
+		cleanup = func() {
+			rp.Close()
+			mongoCleanup()
+		}
+		t.SetBlockHeightNotifier(transformer.NewRedisBlockHeightNotifier(rp, cfg.Transformer.Redis.HeightChannel))
+	}
+	return t, logger, cleanup, nil
+}
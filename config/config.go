@@ -28,6 +28,9 @@ func Load(path string) (Config, error) {
 	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil {
 		return Config{}, err
 	}
+	if len(cfg.Server.CandleResolutions) == 0 {
+		cfg.Server.CandleResolutions = cfg.Transformer.CandleResolutions
+	}
 	return cfg, nil
 }
 
@@ -43,14 +46,22 @@ var DefaultRedisConfig = RedisConfig{
 	URI:                   "redis://localhost",
 	AccountCacheKeyPrefix: "gdex:account:",
 	ScoreBoardCacheKey:    "gdex:scoreboard",
+	ScoreBoardAccountsKey: "gdex:scoreboard:accounts",
 	PoolsCacheKey:         "gdex:pools",
 	PricesCacheKey:        "gdex:prices",
+	UpdatesChannel:        "gdex:updates",
+	LeaderKey:             "gdex:leader",
+	HeightChannel:         "gdex:height",
 }
 
 type RedisConfig struct {
 	URI                   string `yaml:"uri"`
 	AccountCacheKeyPrefix string `yaml:"account_cache_key_prefix"`
 	ScoreBoardCacheKey    string `yaml:"score_board_cache_key"`
+	ScoreBoardAccountsKey string `yaml:"score_board_accounts_key"`
 	PoolsCacheKey         string `yaml:"pools_cache_key"`
 	PricesCacheKey        string `yaml:"prices_cache_key"`
+	UpdatesChannel        string `yaml:"updates_channel"`
+	LeaderKey             string `yaml:"leader_key"`
+	HeightChannel         string `yaml:"height_channel"`
 }
@@ -13,38 +13,99 @@ import (
 )
 
 var DefaultServerConfig = ServerConfig{
-	Debug:               false,
-	BindAddr:            "0.0.0.0:8080",
-	ScoreBoardSize:      100,
-	CacheLoadTimeout:    10 * time.Second,
-	CacheUpdateInterval: 5 * time.Second,
-	AddressPrefix:       "cosmos1",
-	Store:               store.DefaultConfig,
-	Price:               price.DefaultConfig,
-	PriceTable:          pricetable.DefaultConfig,
-	Score:               score.DefaultConfig,
-	MongoDB:             DefaultMongoDBConfig,
-	Redis:               DefaultRedisConfig,
-	Log:                 zap.NewProductionConfig(),
+	Debug:                false,
+	BindAddr:             "0.0.0.0:8080",
+	ScoreBoardSize:       100,
+	ScoreBoardMaxRadius:  50,
+	AccountHistorySize:   50,
+	PoolHistoryMaxSize:   1000,
+	CacheLoadTimeout:     10 * time.Second,
+	CacheUpdateInterval:  5 * time.Second,
+	CacheRefreshInterval: time.Minute,
+	CacheMaxAge:          5 * time.Minute,
+	TransformerMaxLag:    10 * time.Minute,
+	StreamKeepAlive:      15 * time.Second,
+	StreamMaxTopics:      10,
+	LeaderLeaseTTL:       15 * time.Second,
+	AddressPrefix:        "cosmos1",
+	Admin:                DefaultAdminConfig,
+	Store:                store.DefaultConfig,
+	Price:                price.DefaultConfig,
+	PriceTable:           pricetable.DefaultConfig,
+	Score:                score.DefaultConfig,
+	MongoDB:              DefaultMongoDBConfig,
+	Redis:                DefaultRedisConfig,
+	Log:                  zap.NewProductionConfig(),
 }
 
 type ServerConfig struct {
-	Debug               bool              `yaml:"debug"`
-	BindAddr            string            `yaml:"bind_addr"`
-	ScoreBoardSize      int               `yaml:"score_board_size"`
-	CacheLoadTimeout    time.Duration     `yaml:"cache_load_timeout"`
-	CacheUpdateInterval time.Duration     `yaml:"cache_update_interval"`
-	AddressPrefix       string            `yaml:"address_prefix"`
-	Store               store.Config      `yaml:"store"`
-	Price               price.Config      `yaml:"price"`
-	PriceTable          pricetable.Config `yaml:"pricetable"`
-	Score               score.Config      `yaml:"score"`
-	MongoDB             MongoDBConfig     `yaml:"mongodb"`
-	Redis               RedisConfig       `yaml:"redis"`
-	Log                 zap.Config        `yaml:"log"`
+	Debug                bool              `yaml:"debug"`
+	BindAddr             string            `yaml:"bind_addr"`
+	ScoreBoardSize       int               `yaml:"score_board_size"`
+	ScoreBoardMaxRadius  int               `yaml:"score_board_max_radius"`
+	AccountHistorySize   int               `yaml:"account_history_size"`
+	PoolHistoryMaxSize   int               `yaml:"pool_history_max_size"`
+	CandleResolutions    []time.Duration   `yaml:"candle_resolutions"` // transformer.candle_resolutions if empty
+	CacheLoadTimeout     time.Duration     `yaml:"cache_load_timeout"`
+	CacheUpdateInterval  time.Duration     `yaml:"cache_update_interval"` // fallback when no block height is notified
+	CacheRefreshInterval time.Duration     `yaml:"cache_refresh_interval"`
+	CacheMaxAge          time.Duration     `yaml:"cache_max_age"`       // caches older than this make the server not ready
+	TransformerMaxLag    time.Duration     `yaml:"transformer_max_lag"` // same for the transformer's last commit
+	StreamKeepAlive      time.Duration     `yaml:"stream_keep_alive"`
+	StreamMaxTopics      int               `yaml:"stream_max_topics"`
+	InstanceID           string            `yaml:"instance_id"`
+	LeaderLeaseTTL       time.Duration     `yaml:"leader_lease_ttl"`
+	AddressPrefix        string            `yaml:"address_prefix"`
+	Admin                AdminConfig       `yaml:"admin"`
+	Store                store.Config      `yaml:"store"`
+	Price                price.Config      `yaml:"price"`
+	PriceTable           pricetable.Config `yaml:"pricetable"`
+	Score                score.Config      `yaml:"score"`
+	MongoDB              MongoDBConfig     `yaml:"mongodb"`
+	Redis                RedisConfig       `yaml:"redis"`
+	Log                  zap.Config        `yaml:"log"`
 }
 
 func (cfg ServerConfig) Validate() error {
+	if cfg.ScoreBoardSize <= 0 {
+		return fmt.Errorf("'score_board_size' must be positive")
+	}
+	if cfg.ScoreBoardMaxRadius <= 0 {
+		return fmt.Errorf("'score_board_max_radius' must be positive")
+	}
+	if cfg.AccountHistorySize <= 0 {
+		return fmt.Errorf("'account_history_size' must be positive")
+	}
+	if cfg.PoolHistoryMaxSize <= 0 {
+		return fmt.Errorf("'pool_history_max_size' must be positive")
+	}
+	if len(cfg.CandleResolutions) == 0 {
+		return fmt.Errorf("'candle_resolutions' is empty")
+	}
+	if cfg.CacheUpdateInterval <= 0 {
+		return fmt.Errorf("'cache_update_interval' must be positive")
+	}
+	if cfg.CacheRefreshInterval <= 0 {
+		return fmt.Errorf("'cache_refresh_interval' must be positive")
+	}
+	if cfg.CacheMaxAge < cfg.CacheUpdateInterval || cfg.CacheMaxAge < cfg.CacheRefreshInterval {
+		return fmt.Errorf("'cache_max_age' must not be less than 'cache_update_interval' and 'cache_refresh_interval'")
+	}
+	if cfg.TransformerMaxLag <= 0 {
+		return fmt.Errorf("'transformer_max_lag' must be positive")
+	}
+	if cfg.StreamKeepAlive <= 0 {
+		return fmt.Errorf("'stream_keep_alive' must be positive")
+	}
+	if cfg.StreamMaxTopics <= 0 {
+		return fmt.Errorf("'stream_max_topics' must be positive")
+	}
+	if cfg.LeaderLeaseTTL < time.Second {
+		return fmt.Errorf("'leader_lease_ttl' must be at least 1s")
+	}
+	if err := cfg.Admin.Validate(); err != nil {
+		return fmt.Errorf("validate 'admin' field: %w", err)
+	}
 	if err := cfg.Store.Validate(); err != nil {
 		return fmt.Errorf("validate 'store' field: %w", err)
 	}
@@ -59,3 +120,25 @@ func (cfg ServerConfig) Validate() error {
 	}
 	return nil
 }
+
+var DefaultAdminConfig = AdminConfig{
+	AuditLogSize: 100,
+}
+
+// AdminConfig configures the admin API, which is disabled if no API key is set.
+type AdminConfig struct {
+	APIKeys      map[string]string `yaml:"api_keys"` // name of the key holder -> key
+	AuditLogSize int               `yaml:"audit_log_size"`
+}
+
+func (cfg AdminConfig) Validate() error {
+	for name, key := range cfg.APIKeys {
+		if len(key) < 16 {
+			return fmt.Errorf("api key of %q must be at least 16 characters", name)
+		}
+	}
+	if cfg.AuditLogSize <= 0 {
+		return fmt.Errorf("'audit_log_size' must be positive")
+	}
+	return nil
+}
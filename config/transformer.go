@@ -9,29 +9,129 @@ import (
 	"github.com/b-harvest/gravity-dex-backend/service/store"
 )
 
+const (
+	BlockDataSourceDir = "dir"
+	BlockDataSourceTar = "tar"
+	BlockDataSourceRPC = "rpc"
+)
+
+const (
+	BlockDataCompressionNone = ""
+	BlockDataCompressionGzip = "gzip"
+	BlockDataCompressionZstd = "zstd"
+)
+
+// Limits of a batch when transactions are used, so that committing a batch
+// stays well within MongoDB's default transaction lifetime of 60 seconds.
+const (
+	MaxTransactionBatchBlocks   = 1000
+	MaxTransactionBatchDuration = 30 * time.Second
+)
+
 var DefaultTransformerConfig = TransformerConfig{
+	BlockDataSource:          BlockDataSourceDir,
 	BlockDataFilename:        "%08d/%d.json",
+	BlockDataArchiveFilename: "%08d.tar",
 	BlockDataBucketSize:      10000,
 	BlockDataWaitingInterval: time.Second,
+	BlockDataDecoders:        4,
+	BlockDataPrefetchSize:    64,
+	MaxBatchBlocks:           1000,
+	MaxBatchDuration:         MaxTransactionBatchDuration,
+	StateSnapshotInterval:    10000,
+	StateSnapshotRetention:   24,
+	PoolSnapshotTimeInterval: time.Minute,
+	CandleResolutions:        []time.Duration{time.Minute, 5 * time.Minute, time.Hour, 24 * time.Hour},
 	Store:                    store.DefaultConfig,
 	MongoDB:                  DefaultMongoDBConfig,
+	Redis:                    RedisConfig{HeightChannel: DefaultRedisConfig.HeightChannel},
 	Log:                      zap.NewProductionConfig(),
 }
 
 type TransformerConfig struct {
-	BlockDataDir             string        `yaml:"block_data_dir"`
-	BlockDataFilename        string        `yaml:"block_data_filename"`
-	BlockDataBucketSize      int           `yaml:"block_data_bucket_size"`
-	BlockDataWaitingInterval time.Duration `yaml:"block_data_waiting_interval"`
-	IgnoredAddresses         []string      `yaml:"ignored_addresses"`
-	Store                    store.Config  `yaml:"store"`
-	MongoDB                  MongoDBConfig `yaml:"mongodb"`
-	Log                      zap.Config    `yaml:"log"`
+	BlockDataSource           string          `yaml:"block_data_source"`
+	BlockDataDir              string          `yaml:"block_data_dir"`
+	BlockDataFilename         string          `yaml:"block_data_filename"`
+	BlockDataArchiveFilename  string          `yaml:"block_data_archive_filename"`
+	BlockDataCompression      string          `yaml:"block_data_compression"`
+	RPCEndpoint               string          `yaml:"rpc_endpoint"`
+	BlockDataBucketSize       int             `yaml:"block_data_bucket_size"`
+	BlockDataWaitingInterval  time.Duration   `yaml:"block_data_waiting_interval"`
+	BlockDataDecoders         int             `yaml:"block_data_decoders"`
+	BlockDataPrefetchSize     int             `yaml:"block_data_prefetch_size"`
+	MaxBatchBlocks            int64           `yaml:"max_batch_blocks"`   // 0 means no limit
+	MaxBatchDuration          time.Duration   `yaml:"max_batch_duration"` // 0 means no limit
+	IgnoredAddresses          []string        `yaml:"ignored_addresses"`
+	UseTransaction            bool            `yaml:"use_transaction"`          // requires a replica set
+	StateSnapshotInterval     int64           `yaml:"state_snapshot_interval"`  // 0 disables state snapshots
+	StateSnapshotRetention    int             `yaml:"state_snapshot_retention"` // 0 retains every state snapshot
+	PoolSnapshotBlockInterval int64           `yaml:"pool_snapshot_block_interval"`
+	PoolSnapshotTimeInterval  time.Duration   `yaml:"pool_snapshot_time_interval"`
+	CandleResolutions         []time.Duration `yaml:"candle_resolutions"`
+	MetricsAddr               string          `yaml:"metrics_addr"` // empty disables the metrics server
+	Store                     store.Config    `yaml:"store"`
+	MongoDB                   MongoDBConfig   `yaml:"mongodb"`
+	Redis                     RedisConfig     `yaml:"redis"` // only uri and height_channel are used; empty uri disables notifications
+	Log                       zap.Config      `yaml:"log"`
 }
 
 func (cfg TransformerConfig) Validate() error {
-	if cfg.BlockDataDir == "" {
-		return fmt.Errorf("'block_data_dir' is required")
+	switch cfg.BlockDataSource {
+	case BlockDataSourceDir, BlockDataSourceTar:
+		if cfg.BlockDataDir == "" {
+			return fmt.Errorf("'block_data_dir' is required")
+		}
+		if cfg.BlockDataBucketSize <= 0 {
+			return fmt.Errorf("'block_data_bucket_size' must be positive")
+		}
+	case BlockDataSourceRPC:
+		if cfg.RPCEndpoint == "" {
+			return fmt.Errorf("'rpc_endpoint' is required")
+		}
+	default:
+		return fmt.Errorf("unknown block data source: %s", cfg.BlockDataSource)
+	}
+	if cfg.BlockDataDecoders <= 0 {
+		return fmt.Errorf("'block_data_decoders' must be positive")
+	}
+	if cfg.BlockDataPrefetchSize <= 0 {
+		return fmt.Errorf("'block_data_prefetch_size' must be positive")
+	}
+	if cfg.MaxBatchBlocks < 0 {
+		return fmt.Errorf("'max_batch_blocks' must not be negative")
+	}
+	if cfg.MaxBatchDuration < 0 {
+		return fmt.Errorf("'max_batch_duration' must not be negative")
+	}
+	if cfg.UseTransaction {
+		if cfg.MaxBatchBlocks == 0 || cfg.MaxBatchBlocks > MaxTransactionBatchBlocks {
+			return fmt.Errorf("'max_batch_blocks' must be positive and at most %d when 'use_transaction' is set", MaxTransactionBatchBlocks)
+		}
+		if cfg.MaxBatchDuration == 0 || cfg.MaxBatchDuration > MaxTransactionBatchDuration {
+			return fmt.Errorf("'max_batch_duration' must be positive and at most %s when 'use_transaction' is set", MaxTransactionBatchDuration)
+		}
+	}
+	switch cfg.BlockDataCompression {
+	case BlockDataCompressionNone, BlockDataCompressionGzip, BlockDataCompressionZstd:
+	default:
+		return fmt.Errorf("unknown block data compression: %s", cfg.BlockDataCompression)
+	}
+	if cfg.StateSnapshotInterval < 0 {
+		return fmt.Errorf("'state_snapshot_interval' must not be negative")
+	}
+	if cfg.StateSnapshotRetention < 0 {
+		return fmt.Errorf("'state_snapshot_retention' must not be negative")
+	}
+	if cfg.PoolSnapshotBlockInterval < 0 {
+		return fmt.Errorf("'pool_snapshot_block_interval' must not be negative")
+	}
+	if cfg.PoolSnapshotTimeInterval < 0 {
+		return fmt.Errorf("'pool_snapshot_time_interval' must not be negative")
+	}
+	for _, r := range cfg.CandleResolutions {
+		if r < time.Second || r%time.Second != 0 {
+			return fmt.Errorf("'candle_resolutions' must be multiples of a second")
+		}
 	}
 	if err := cfg.Store.Validate(); err != nil {
 		return fmt.Errorf("validate 'store' field: %w", err)
@@ -46,3 +146,7 @@ func (cfg TransformerConfig) IgnoredAddressesSet() map[string]struct{} {
 	}
 	return s
 }
+
+func (cfg TransformerConfig) PoolSnapshotEnabled() bool {
+	return cfg.PoolSnapshotBlockInterval > 0 || cfg.PoolSnapshotTimeInterval > 0
+}
@@ -0,0 +1,524 @@
+// Package event decodes x/liquidity events into typed structs.
+package event
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	liquiditytypes "github.com/tendermint/liquidity/x/liquidity/types"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+)
+
+var ErrMissingAttribute = errors.New("missing attribute")
+
+// AttributeError is returned when an event has a missing or malformed attribute.
+type AttributeError struct {
+	EventType string
+	Key       string
+	Err       error
+}
+
+func (e *AttributeError) Error() string {
+	return fmt.Sprintf("%s event: attribute %q: %v", e.EventType, e.Key, e.Err)
+}
+
+func (e *AttributeError) Unwrap() error {
+	return e.Err
+}
+
+// Event is one of the typed events in this package.
+type Event interface {
+	EventType() string
+}
+
+// CreatePool is emitted when a pool is created.
+type CreatePool struct {
+	PoolID         uint64
+	PoolTypeID     uint32
+	PoolName       string
+	ReserveAccount string
+	DepositCoins   sdk.Coins
+	PoolCoinDenom  string
+}
+
+// DepositWithinBatch is emitted when a deposit request is put into a batch.
+type DepositWithinBatch struct {
+	PoolID       uint64
+	BatchIndex   uint64
+	MsgIndex     uint64
+	DepositCoins sdk.Coins
+}
+
+// WithdrawWithinBatch is emitted when a withdraw request is put into a batch.
+type WithdrawWithinBatch struct {
+	PoolID     uint64
+	BatchIndex uint64
+	MsgIndex   uint64
+	PoolCoin   sdk.Coin
+}
+
+// SwapWithinBatch is emitted when a swap request is put into a batch.
+type SwapWithinBatch struct {
+	PoolID          uint64
+	BatchIndex      uint64
+	MsgIndex        uint64
+	SwapTypeID      uint32
+	OfferCoin       sdk.Coin
+	OfferCoinFee    sdk.Coin
+	DemandCoinDenom string
+	OrderPrice      sdk.Dec
+}
+
+// DepositRefund is emitted at the end of a batch when a deposit request fails.
+// It has the same event type as DepositWithinBatch.
+type DepositRefund struct {
+	PoolID        uint64
+	BatchIndex    uint64
+	MsgIndex      uint64
+	Depositor     string
+	RefundedCoins sdk.Coins
+}
+
+// WithdrawRefund is emitted at the end of a batch when a withdraw request fails.
+// It has the same event type as WithdrawWithinBatch.
+type WithdrawRefund struct {
+	PoolID     uint64
+	BatchIndex uint64
+	MsgIndex   uint64
+	Withdrawer string
+	PoolCoin   sdk.Coin
+}
+
+// DepositToPool is emitted at the end of a batch when a deposit request succeeds.
+type DepositToPool struct {
+	PoolID        uint64
+	BatchIndex    uint64
+	MsgIndex      uint64
+	Depositor     string
+	AcceptedCoins sdk.Coins
+	RefundedCoins sdk.Coins
+	PoolCoin      sdk.Coin // minted pool coin
+}
+
+// WithdrawFromPool is emitted at the end of a batch when a withdraw request succeeds.
+type WithdrawFromPool struct {
+	PoolID         uint64
+	BatchIndex     uint64
+	MsgIndex       uint64
+	Withdrawer     string
+	PoolCoin       sdk.Coin // burned pool coin
+	WithdrawnCoins sdk.Coins
+}
+
+// SwapTransacted is emitted at the end of a batch when a swap request is matched.
+type SwapTransacted struct {
+	PoolID               uint64
+	BatchIndex           uint64
+	MsgIndex             uint64
+	SwapRequester        string
+	SwapTypeID           uint32
+	OfferCoin            sdk.Coin
+	OrderPrice           sdk.Dec
+	SwapPrice            sdk.Dec
+	TransactedCoinAmount sdk.Dec
+	RemainingOfferCoin   sdk.Coin
+	ExchangedOfferCoin   sdk.Coin
+	OfferCoinFee         sdk.Coin // truncated
+	ReservedOfferCoinFee sdk.Coin
+	OrderExpiryHeight    int64
+}
+
+func (CreatePool) EventType() string          { return liquiditytypes.EventTypeCreatePool }
+func (DepositWithinBatch) EventType() string  { return liquiditytypes.EventTypeDepositWithinBatch }
+func (WithdrawWithinBatch) EventType() string { return liquiditytypes.EventTypeWithdrawWithinBatch }
+func (SwapWithinBatch) EventType() string     { return liquiditytypes.EventTypeSwapWithinBatch }
+func (DepositRefund) EventType() string       { return liquiditytypes.EventTypeDepositWithinBatch }
+func (WithdrawRefund) EventType() string      { return liquiditytypes.EventTypeWithdrawWithinBatch }
+func (DepositToPool) EventType() string       { return liquiditytypes.EventTypeDepositToPool }
+func (WithdrawFromPool) EventType() string    { return liquiditytypes.EventTypeWithdrawFromPool }
+func (SwapTransacted) EventType() string      { return liquiditytypes.EventTypeSwapTransacted }
+
+// DemandCoin returns the coin the swap requester received for the coin,
+// which is either ExchangedOfferCoin or OfferCoinFee.
+func (evt SwapTransacted) DemandCoin(coin sdk.Coin, demandCoinDenom string) sdk.Coin {
+	if coin.Denom < demandCoinDenom {
+		return sdk.NewCoin(demandCoinDenom, coin.Amount.ToDec().Quo(evt.SwapPrice).TruncateInt())
+	}
+	return sdk.NewCoin(demandCoinDenom, coin.Amount.ToDec().Mul(evt.SwapPrice).TruncateInt())
+}
+
+// OppositeReserveCoinDenom returns the pool's other reserve coin denom than
+// the given one, e.g. the demand coin denom of a swap offering the given denom.
+func OppositeReserveCoinDenom(pool liquiditytypes.Pool, denom string) (string, bool) {
+	for _, d := range pool.ReserveCoinDenoms {
+		if d != denom {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// Decode decodes an x/liquidity event. It returns nil without an error
+// if the event is not an x/liquidity event.
+func Decode(evt abcitypes.Event) (Event, error) {
+	var e Event
+	var err error
+	switch evt.Type {
+	case liquiditytypes.EventTypeCreatePool:
+		e, err = DecodeCreatePool(evt)
+	case liquiditytypes.EventTypeDepositWithinBatch:
+		if _, ok := newAttributes(evt).m[liquiditytypes.AttributeValueSuccess]; ok {
+			e, err = DecodeDepositRefund(evt)
+		} else {
+			e, err = DecodeDepositWithinBatch(evt)
+		}
+	case liquiditytypes.EventTypeWithdrawWithinBatch:
+		if _, ok := newAttributes(evt).m[liquiditytypes.AttributeValueSuccess]; ok {
+			e, err = DecodeWithdrawRefund(evt)
+		} else {
+			e, err = DecodeWithdrawWithinBatch(evt)
+		}
+	case liquiditytypes.EventTypeSwapWithinBatch:
+		e, err = DecodeSwapWithinBatch(evt)
+	case liquiditytypes.EventTypeDepositToPool:
+		e, err = DecodeDepositToPool(evt)
+	case liquiditytypes.EventTypeWithdrawFromPool:
+		e, err = DecodeWithdrawFromPool(evt)
+	case liquiditytypes.EventTypeSwapTransacted:
+		e, err = DecodeSwapTransacted(evt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func DecodeCreatePool(evt abcitypes.Event) (*CreatePool, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeCreatePool)
+	if err != nil {
+		return nil, err
+	}
+	e := &CreatePool{
+		PoolID:         a.uint64(liquiditytypes.AttributeValuePoolId),
+		PoolTypeID:     a.uint32(liquiditytypes.AttributeValuePoolTypeId),
+		PoolName:       a.string(liquiditytypes.AttributeValuePoolName),
+		ReserveAccount: a.string(liquiditytypes.AttributeValueReserveAccount),
+		DepositCoins:   a.coins(liquiditytypes.AttributeValueDepositCoins),
+		PoolCoinDenom:  a.string(liquiditytypes.AttributeValuePoolCoinDenom),
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+func DecodeDepositWithinBatch(evt abcitypes.Event) (*DepositWithinBatch, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeDepositWithinBatch)
+	if err != nil {
+		return nil, err
+	}
+	e := &DepositWithinBatch{
+		PoolID:       a.uint64(liquiditytypes.AttributeValuePoolId),
+		BatchIndex:   a.uint64(liquiditytypes.AttributeValueBatchIndex),
+		MsgIndex:     a.uint64(liquiditytypes.AttributeValueMsgIndex),
+		DepositCoins: a.coins(liquiditytypes.AttributeValueDepositCoins),
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+func DecodeWithdrawWithinBatch(evt abcitypes.Event) (*WithdrawWithinBatch, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeWithdrawWithinBatch)
+	if err != nil {
+		return nil, err
+	}
+	e := &WithdrawWithinBatch{
+		PoolID:     a.uint64(liquiditytypes.AttributeValuePoolId),
+		BatchIndex: a.uint64(liquiditytypes.AttributeValueBatchIndex),
+		MsgIndex:   a.uint64(liquiditytypes.AttributeValueMsgIndex),
+		PoolCoin:   a.coin(liquiditytypes.AttributeValuePoolCoinDenom, liquiditytypes.AttributeValuePoolCoinAmount),
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+func DecodeSwapWithinBatch(evt abcitypes.Event) (*SwapWithinBatch, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeSwapWithinBatch)
+	if err != nil {
+		return nil, err
+	}
+	e := &SwapWithinBatch{
+		PoolID:          a.uint64(liquiditytypes.AttributeValuePoolId),
+		BatchIndex:      a.uint64(liquiditytypes.AttributeValueBatchIndex),
+		MsgIndex:        a.uint64(liquiditytypes.AttributeValueMsgIndex),
+		SwapTypeID:      a.uint32(liquiditytypes.AttributeValueSwapTypeId),
+		OfferCoin:       a.coin(liquiditytypes.AttributeValueOfferCoinDenom, liquiditytypes.AttributeValueOfferCoinAmount),
+		OfferCoinFee:    a.coin(liquiditytypes.AttributeValueOfferCoinDenom, liquiditytypes.AttributeValueOfferCoinFeeAmount),
+		DemandCoinDenom: a.string(liquiditytypes.AttributeValueDemandCoinDenom),
+		OrderPrice:      a.dec(liquiditytypes.AttributeValueOrderPrice),
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+func DecodeDepositRefund(evt abcitypes.Event) (*DepositRefund, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeDepositWithinBatch)
+	if err != nil {
+		return nil, err
+	}
+	e := &DepositRefund{
+		PoolID:        a.uint64(liquiditytypes.AttributeValuePoolId),
+		BatchIndex:    a.uint64(liquiditytypes.AttributeValueBatchIndex),
+		MsgIndex:      a.uint64(liquiditytypes.AttributeValueMsgIndex),
+		Depositor:     a.string(liquiditytypes.AttributeValueDepositor),
+		RefundedCoins: a.coins(liquiditytypes.AttributeValueRefundedCoins),
+	}
+	a.success(false)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+func DecodeWithdrawRefund(evt abcitypes.Event) (*WithdrawRefund, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeWithdrawWithinBatch)
+	if err != nil {
+		return nil, err
+	}
+	e := &WithdrawRefund{
+		PoolID:     a.uint64(liquiditytypes.AttributeValuePoolId),
+		BatchIndex: a.uint64(liquiditytypes.AttributeValueBatchIndex),
+		MsgIndex:   a.uint64(liquiditytypes.AttributeValueMsgIndex),
+		Withdrawer: a.string(liquiditytypes.AttributeValueWithdrawer),
+		PoolCoin:   a.coin(liquiditytypes.AttributeValuePoolCoinDenom, liquiditytypes.AttributeValuePoolCoinAmount),
+	}
+	a.success(false)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+func DecodeDepositToPool(evt abcitypes.Event) (*DepositToPool, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeDepositToPool)
+	if err != nil {
+		return nil, err
+	}
+	e := &DepositToPool{
+		PoolID:        a.uint64(liquiditytypes.AttributeValuePoolId),
+		BatchIndex:    a.uint64(liquiditytypes.AttributeValueBatchIndex),
+		MsgIndex:      a.uint64(liquiditytypes.AttributeValueMsgIndex),
+		Depositor:     a.string(liquiditytypes.AttributeValueDepositor),
+		AcceptedCoins: a.coins(liquiditytypes.AttributeValueAcceptedCoins),
+		RefundedCoins: a.coins(liquiditytypes.AttributeValueRefundedCoins),
+		PoolCoin:      a.coin(liquiditytypes.AttributeValuePoolCoinDenom, liquiditytypes.AttributeValuePoolCoinAmount),
+	}
+	a.success(true)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+func DecodeWithdrawFromPool(evt abcitypes.Event) (*WithdrawFromPool, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeWithdrawFromPool)
+	if err != nil {
+		return nil, err
+	}
+	e := &WithdrawFromPool{
+		PoolID:         a.uint64(liquiditytypes.AttributeValuePoolId),
+		BatchIndex:     a.uint64(liquiditytypes.AttributeValueBatchIndex),
+		MsgIndex:       a.uint64(liquiditytypes.AttributeValueMsgIndex),
+		Withdrawer:     a.string(liquiditytypes.AttributeValueWithdrawer),
+		PoolCoin:       a.coin(liquiditytypes.AttributeValuePoolCoinDenom, liquiditytypes.AttributeValuePoolCoinAmount),
+		WithdrawnCoins: a.coins(liquiditytypes.AttributeValueWithdrawCoins),
+	}
+	a.success(true)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+func DecodeSwapTransacted(evt abcitypes.Event) (*SwapTransacted, error) {
+	a, err := newTypedAttributes(evt, liquiditytypes.EventTypeSwapTransacted)
+	if err != nil {
+		return nil, err
+	}
+	const denomKey = liquiditytypes.AttributeValueOfferCoinDenom
+	e := &SwapTransacted{
+		PoolID:               a.uint64(liquiditytypes.AttributeValuePoolId),
+		BatchIndex:           a.uint64(liquiditytypes.AttributeValueBatchIndex),
+		MsgIndex:             a.uint64(liquiditytypes.AttributeValueMsgIndex),
+		SwapRequester:        a.string(liquiditytypes.AttributeValueSwapRequester),
+		SwapTypeID:           a.uint32(liquiditytypes.AttributeValueSwapTypeId),
+		OfferCoin:            a.coin(denomKey, liquiditytypes.AttributeValueOfferCoinAmount),
+		OrderPrice:           a.dec(liquiditytypes.AttributeValueOrderPrice),
+		SwapPrice:            a.dec(liquiditytypes.AttributeValueSwapPrice),
+		TransactedCoinAmount: a.dec(liquiditytypes.AttributeValueTransactedCoinAmount),
+		RemainingOfferCoin:   a.coin(denomKey, liquiditytypes.AttributeValueRemainingOfferCoinAmount),
+		ExchangedOfferCoin:   a.coin(denomKey, liquiditytypes.AttributeValueExchangedOfferCoinAmount),
+		OfferCoinFee:         a.decCoin(denomKey, liquiditytypes.AttributeValueOfferCoinFeeAmount),
+		ReservedOfferCoinFee: a.coin(denomKey, liquiditytypes.AttributeValueReservedOfferCoinFeeAmount),
+		OrderExpiryHeight:    a.int64(liquiditytypes.AttributeValueOrderExpiryHeight),
+	}
+	a.success(true)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return e, nil
+}
+
+// attributes parses attributes of an event, and keeps the first error.
+type attributes struct {
+	eventType string
+	m         map[string]string
+	err       error
+}
+
+func newAttributes(evt abcitypes.Event) *attributes {
+	a := &attributes{eventType: evt.Type, m: make(map[string]string)}
+	for _, attr := range evt.Attributes {
+		a.m[string(attr.Key)] = string(attr.Value)
+	}
+	return a
+}
+
+func newTypedAttributes(evt abcitypes.Event, eventType string) (*attributes, error) {
+	if evt.Type != eventType {
+		return nil, fmt.Errorf("expected %s event, got %s", eventType, evt.Type)
+	}
+	return newAttributes(evt), nil
+}
+
+func (a *attributes) fail(key string, err error) {
+	if a.err == nil {
+		a.err = &AttributeError{EventType: a.eventType, Key: key, Err: err}
+	}
+}
+
+func (a *attributes) string(key string) string {
+	v, ok := a.m[key]
+	if !ok {
+		a.fail(key, ErrMissingAttribute)
+	}
+	return v
+}
+
+func (a *attributes) uint64(key string) uint64 {
+	v, ok := a.m[key]
+	if !ok {
+		a.fail(key, ErrMissingAttribute)
+		return 0
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		a.fail(key, err)
+	}
+	return n
+}
+
+func (a *attributes) uint32(key string) uint32 {
+	v, ok := a.m[key]
+	if !ok {
+		a.fail(key, ErrMissingAttribute)
+		return 0
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		a.fail(key, err)
+	}
+	return uint32(n)
+}
+
+func (a *attributes) int64(key string) int64 {
+	v, ok := a.m[key]
+	if !ok {
+		a.fail(key, ErrMissingAttribute)
+		return 0
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		a.fail(key, err)
+	}
+	return n
+}
+
+func (a *attributes) dec(key string) sdk.Dec {
+	v, ok := a.m[key]
+	if !ok {
+		a.fail(key, ErrMissingAttribute)
+		return sdk.Dec{}
+	}
+	d, err := sdk.NewDecFromStr(v)
+	if err != nil {
+		a.fail(key, err)
+	}
+	return d
+}
+
+func (a *attributes) coins(key string) sdk.Coins {
+	v, ok := a.m[key]
+	if !ok {
+		a.fail(key, ErrMissingAttribute)
+		return nil
+	}
+	coins, err := sdk.ParseCoinsNormalized(v)
+	if err != nil {
+		a.fail(key, err)
+	}
+	return coins
+}
+
+func (a *attributes) coin(denomKey, amountKey string) sdk.Coin {
+	denom := a.string(denomKey)
+	v, ok := a.m[amountKey]
+	if !ok {
+		a.fail(amountKey, ErrMissingAttribute)
+		return sdk.Coin{}
+	}
+	amt, ok := sdk.NewIntFromString(v)
+	if !ok {
+		a.fail(amountKey, fmt.Errorf("invalid integer: %q", v))
+		return sdk.Coin{}
+	}
+	if err := sdk.ValidateDenom(denom); err != nil {
+		a.fail(denomKey, err)
+		return sdk.Coin{}
+	}
+	return sdk.Coin{Denom: denom, Amount: amt}
+}
+
+// decCoin parses a coin with a decimal amount, and truncates it.
+func (a *attributes) decCoin(denomKey, amountKey string) sdk.Coin {
+	denom := a.string(denomKey)
+	amt := a.dec(amountKey)
+	if amt.IsNil() {
+		return sdk.Coin{}
+	}
+	if err := sdk.ValidateDenom(denom); err != nil {
+		a.fail(denomKey, err)
+		return sdk.Coin{}
+	}
+	return sdk.Coin{Denom: denom, Amount: amt.TruncateInt()}
+}
+
+func (a *attributes) success(expected bool) {
+	v := a.string(liquiditytypes.AttributeValueSuccess)
+	if a.err != nil {
+		return
+	}
+	switch {
+	case v == liquiditytypes.Success && expected, v == liquiditytypes.Failure && !expected:
+	default:
+		a.fail(liquiditytypes.AttributeValueSuccess, fmt.Errorf("unexpected value: %q", v))
+	}
+}
@@ -0,0 +1,467 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/require"
+	liquiditytypes "github.com/tendermint/liquidity/x/liquidity/types"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+)
+
+const (
+	testPoolReserveAccount = "cosmos1jmhkafh94jpgakr735r70t32sxq9wzkayzs9we"
+	testAddr1              = "cosmos1qyqszqgpqyqszqgpqyqszqgpqyqszqgpjnp7du"
+	testAddr2              = "cosmos1qgpqyqszqgpqyqszqgpqyqszqgpqyqszrh8mx2"
+	testAddr3              = "cosmos1qvpsxqcrqvpsxqcrqvpsxqcrqvpsxqcrz8x6vt"
+)
+
+const (
+	testAddr          = "cosmos1qqqsyqcyq5rqwzqfpg9scrgwpugpzysn7hzdtn"
+	testPoolCoinDenom = "pool96EF6EA6E5AC828ED87E8D07E7AE2A8180570ADD212117B2DA6F0B75D17A6295"
+)
+
+func newEvent(typ string, kvs ...string) abcitypes.Event {
+	evt := abcitypes.Event{Type: typ}
+	for i := 0; i < len(kvs); i += 2 {
+		evt.Attributes = append(evt.Attributes, abcitypes.EventAttribute{Key: []byte(kvs[i]), Value: []byte(kvs[i+1])})
+	}
+	return evt
+}
+
+func swapTransactedEvent(kvs ...string) abcitypes.Event {
+	return newEvent(liquiditytypes.EventTypeSwapTransacted, append([]string{
+		liquiditytypes.AttributeValuePoolId, "1",
+		liquiditytypes.AttributeValueBatchIndex, "5",
+		liquiditytypes.AttributeValueMsgIndex, "7",
+		liquiditytypes.AttributeValueSwapRequester, testAddr,
+		liquiditytypes.AttributeValueSwapTypeId, "1",
+		liquiditytypes.AttributeValueOfferCoinDenom, "uatom",
+		liquiditytypes.AttributeValueOfferCoinAmount, "1000000",
+		liquiditytypes.AttributeValueOrderPrice, "2.000000000000000000",
+		liquiditytypes.AttributeValueSwapPrice, "2.000000000000000000",
+		liquiditytypes.AttributeValueTransactedCoinAmount, "1000000.000000000000000000",
+		liquiditytypes.AttributeValueRemainingOfferCoinAmount, "0",
+		liquiditytypes.AttributeValueExchangedOfferCoinAmount, "1000000",
+		liquiditytypes.AttributeValueOfferCoinFeeAmount, "1500.500000000000000000",
+		liquiditytypes.AttributeValueReservedOfferCoinFeeAmount, "0",
+		liquiditytypes.AttributeValueOrderExpiryHeight, "100",
+		liquiditytypes.AttributeValueSuccess, liquiditytypes.Success,
+	}, kvs...)...)
+}
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		evt      abcitypes.Event
+		expected Event
+	}{
+		{
+			"create pool",
+			newEvent(liquiditytypes.EventTypeCreatePool,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValuePoolTypeId, "1",
+				liquiditytypes.AttributeValuePoolName, "uatom/uusd/1",
+				liquiditytypes.AttributeValueReserveAccount, testAddr,
+				liquiditytypes.AttributeValueDepositCoins, "1000uatom,2000uusd",
+				liquiditytypes.AttributeValuePoolCoinDenom, testPoolCoinDenom),
+			&CreatePool{
+				PoolID:         1,
+				PoolTypeID:     1,
+				PoolName:       "uatom/uusd/1",
+				ReserveAccount: testAddr,
+				DepositCoins:   sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000), sdk.NewInt64Coin("uusd", 2000)),
+				PoolCoinDenom:  testPoolCoinDenom,
+			},
+		},
+		{
+			"deposit within batch",
+			newEvent(liquiditytypes.EventTypeDepositWithinBatch,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueMsgIndex, "2",
+				liquiditytypes.AttributeValueDepositCoins, "1000uatom,2000uusd"),
+			&DepositWithinBatch{
+				PoolID:       1,
+				BatchIndex:   5,
+				MsgIndex:     2,
+				DepositCoins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000), sdk.NewInt64Coin("uusd", 2000)),
+			},
+		},
+		{
+			"deposit refund",
+			newEvent(liquiditytypes.EventTypeDepositWithinBatch,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueMsgIndex, "2",
+				liquiditytypes.AttributeValueDepositor, testAddr,
+				liquiditytypes.AttributeValueAcceptedCoins, "",
+				liquiditytypes.AttributeValueRefundedCoins, "1000uatom,2000uusd",
+				liquiditytypes.AttributeValueSuccess, liquiditytypes.Failure),
+			&DepositRefund{
+				PoolID:        1,
+				BatchIndex:    5,
+				MsgIndex:      2,
+				Depositor:     testAddr,
+				RefundedCoins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000), sdk.NewInt64Coin("uusd", 2000)),
+			},
+		},
+		{
+			"withdraw within batch",
+			newEvent(liquiditytypes.EventTypeWithdrawWithinBatch,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueMsgIndex, "3",
+				liquiditytypes.AttributeValuePoolCoinDenom, testPoolCoinDenom,
+				liquiditytypes.AttributeValuePoolCoinAmount, "500"),
+			&WithdrawWithinBatch{
+				PoolID:     1,
+				BatchIndex: 5,
+				MsgIndex:   3,
+				PoolCoin:   sdk.NewInt64Coin(testPoolCoinDenom, 500),
+			},
+		},
+		{
+			"withdraw refund",
+			newEvent(liquiditytypes.EventTypeWithdrawWithinBatch,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueMsgIndex, "3",
+				liquiditytypes.AttributeValueWithdrawer, testAddr,
+				liquiditytypes.AttributeValuePoolCoinDenom, testPoolCoinDenom,
+				liquiditytypes.AttributeValuePoolCoinAmount, "500",
+				liquiditytypes.AttributeValueWithdrawCoins, "",
+				liquiditytypes.AttributeValueSuccess, liquiditytypes.Failure),
+			&WithdrawRefund{
+				PoolID:     1,
+				BatchIndex: 5,
+				MsgIndex:   3,
+				Withdrawer: testAddr,
+				PoolCoin:   sdk.NewInt64Coin(testPoolCoinDenom, 500),
+			},
+		},
+		{
+			"swap within batch",
+			newEvent(liquiditytypes.EventTypeSwapWithinBatch,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueMsgIndex, "7",
+				liquiditytypes.AttributeValueSwapTypeId, "1",
+				liquiditytypes.AttributeValueOfferCoinDenom, "uatom",
+				liquiditytypes.AttributeValueOfferCoinAmount, "1000000",
+				liquiditytypes.AttributeValueOfferCoinFeeAmount, "1500",
+				liquiditytypes.AttributeValueDemandCoinDenom, "uusd",
+				liquiditytypes.AttributeValueOrderPrice, "2.000000000000000000"),
+			&SwapWithinBatch{
+				PoolID:          1,
+				BatchIndex:      5,
+				MsgIndex:        7,
+				SwapTypeID:      1,
+				OfferCoin:       sdk.NewInt64Coin("uatom", 1000000),
+				OfferCoinFee:    sdk.NewInt64Coin("uatom", 1500),
+				DemandCoinDenom: "uusd",
+				OrderPrice:      sdk.NewDec(2),
+			},
+		},
+		{
+			"deposit to pool",
+			newEvent(liquiditytypes.EventTypeDepositToPool,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueMsgIndex, "2",
+				liquiditytypes.AttributeValueDepositor, testAddr,
+				liquiditytypes.AttributeValueAcceptedCoins, "1000uatom,2000uusd",
+				liquiditytypes.AttributeValueRefundedCoins, "",
+				liquiditytypes.AttributeValuePoolCoinDenom, testPoolCoinDenom,
+				liquiditytypes.AttributeValuePoolCoinAmount, "500",
+				liquiditytypes.AttributeValueSuccess, liquiditytypes.Success),
+			&DepositToPool{
+				PoolID:        1,
+				BatchIndex:    5,
+				MsgIndex:      2,
+				Depositor:     testAddr,
+				AcceptedCoins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000), sdk.NewInt64Coin("uusd", 2000)),
+				PoolCoin:      sdk.NewInt64Coin(testPoolCoinDenom, 500),
+			},
+		},
+		{
+			"withdraw from pool",
+			newEvent(liquiditytypes.EventTypeWithdrawFromPool,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueMsgIndex, "3",
+				liquiditytypes.AttributeValueWithdrawer, testAddr,
+				liquiditytypes.AttributeValuePoolCoinDenom, testPoolCoinDenom,
+				liquiditytypes.AttributeValuePoolCoinAmount, "500",
+				liquiditytypes.AttributeValueWithdrawCoins, "999uatom,1998uusd",
+				liquiditytypes.AttributeValueSuccess, liquiditytypes.Success),
+			&WithdrawFromPool{
+				PoolID:         1,
+				BatchIndex:     5,
+				MsgIndex:       3,
+				Withdrawer:     testAddr,
+				PoolCoin:       sdk.NewInt64Coin(testPoolCoinDenom, 500),
+				WithdrawnCoins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 999), sdk.NewInt64Coin("uusd", 1998)),
+			},
+		},
+		{
+			"swap transacted",
+			swapTransactedEvent(),
+			&SwapTransacted{
+				PoolID:               1,
+				BatchIndex:           5,
+				MsgIndex:             7,
+				SwapRequester:        testAddr,
+				SwapTypeID:           1,
+				OfferCoin:            sdk.NewInt64Coin("uatom", 1000000),
+				OrderPrice:           sdk.NewDec(2),
+				SwapPrice:            sdk.NewDec(2),
+				TransactedCoinAmount: sdk.NewDec(1000000),
+				RemainingOfferCoin:   sdk.NewInt64Coin("uatom", 0),
+				ExchangedOfferCoin:   sdk.NewInt64Coin("uatom", 1000000),
+				OfferCoinFee:         sdk.NewInt64Coin("uatom", 1500),
+				ReservedOfferCoinFee: sdk.NewInt64Coin("uatom", 0),
+				OrderExpiryHeight:    100,
+			},
+		},
+		{
+			"not a liquidity event",
+			newEvent("transfer", "recipient", testAddr, "amount", "1000uatom"),
+			nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := Decode(tc.evt)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, e)
+		})
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		evt     abcitypes.Event
+		key     string
+		missing bool
+	}{
+		{
+			"missing attribute",
+			newEvent(liquiditytypes.EventTypeDepositWithinBatch,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueDepositCoins, "1000uatom"),
+			liquiditytypes.AttributeValueMsgIndex,
+			true,
+		},
+		{
+			"malformed integer",
+			swapTransactedEvent(liquiditytypes.AttributeValuePoolId, "one"),
+			liquiditytypes.AttributeValuePoolId,
+			false,
+		},
+		{
+			"malformed dec",
+			swapTransactedEvent(liquiditytypes.AttributeValueSwapPrice, "2.x"),
+			liquiditytypes.AttributeValueSwapPrice,
+			false,
+		},
+		{
+			"malformed coins",
+			newEvent(liquiditytypes.EventTypeDepositWithinBatch,
+				liquiditytypes.AttributeValuePoolId, "1",
+				liquiditytypes.AttributeValueBatchIndex, "5",
+				liquiditytypes.AttributeValueMsgIndex, "2",
+				liquiditytypes.AttributeValueDepositCoins, "1000"),
+			liquiditytypes.AttributeValueDepositCoins,
+			false,
+		},
+		{
+			"unexpected success value",
+			swapTransactedEvent(liquiditytypes.AttributeValueSuccess, liquiditytypes.Failure),
+			liquiditytypes.AttributeValueSuccess,
+			false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := Decode(tc.evt)
+			require.Nil(t, e)
+			var attrErr *AttributeError
+			require.True(t, errors.As(err, &attrErr))
+			require.Equal(t, tc.evt.Type, attrErr.EventType)
+			require.Equal(t, tc.key, attrErr.Key)
+			require.Equal(t, tc.missing, errors.Is(err, ErrMissingAttribute))
+		})
+	}
+}
+
+func TestDecodeSwapTransacted_WrongType(t *testing.T) {
+	_, err := DecodeSwapTransacted(newEvent(liquiditytypes.EventTypeDepositToPool))
+	require.Error(t, err)
+}
+
+func TestSwapTransacted_DemandCoin(t *testing.T) {
+	e, err := DecodeSwapTransacted(swapTransactedEvent())
+	require.NoError(t, err)
+	// uatom < uusd, so the swap price is in uatom per uusd.
+	require.Equal(t, sdk.NewInt64Coin("uusd", 500000), e.DemandCoin(e.ExchangedOfferCoin, "uusd"))
+	require.Equal(t, sdk.NewInt64Coin("uusd", 750), e.DemandCoin(e.OfferCoinFee, "uusd"))
+	// uusd > uatom, so the amount is multiplied by the swap price.
+	require.Equal(t, sdk.NewInt64Coin("uatom", 2000000), e.DemandCoin(sdk.NewInt64Coin("uusd", 1000000), "uatom"))
+}
+
+// testdata/events.json holds x/liquidity events emitted by the liquidity module
+// (v1.2.4, the version the backend is built against) when creating a pool
+// in one block, and depositing, withdrawing and swapping in the next one.
+func loadTestEvents(t *testing.T) []abcitypes.Event {
+	b, err := os.ReadFile("testdata/events.json")
+	require.NoError(t, err)
+	var evts []abcitypes.Event
+	require.NoError(t, json.Unmarshal(b, &evts))
+	return evts
+}
+
+func TestDecode_Testdata(t *testing.T) {
+	evts := loadTestEvents(t)
+	for i, expected := range []Event{
+		&CreatePool{
+			PoolID:         1,
+			PoolTypeID:     1,
+			PoolName:       "uatom/uusd/1",
+			ReserveAccount: testPoolReserveAccount,
+			DepositCoins:   sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000000), sdk.NewInt64Coin("uusd", 2000000)),
+			PoolCoinDenom:  testPoolCoinDenom,
+		},
+		&DepositWithinBatch{
+			PoolID:       1,
+			BatchIndex:   1,
+			MsgIndex:     1,
+			DepositCoins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 100000), sdk.NewInt64Coin("uusd", 300000)),
+		},
+		&WithdrawWithinBatch{
+			PoolID:     1,
+			BatchIndex: 1,
+			MsgIndex:   1,
+			PoolCoin:   sdk.NewInt64Coin(testPoolCoinDenom, 100000),
+		},
+		&SwapWithinBatch{
+			PoolID:          1,
+			BatchIndex:      1,
+			MsgIndex:        1,
+			SwapTypeID:      1,
+			OfferCoin:       sdk.NewInt64Coin("uatom", 10000),
+			OfferCoinFee:    sdk.NewInt64Coin("uatom", 15),
+			DemandCoinDenom: "uusd",
+			OrderPrice:      sdk.MustNewDecFromStr("0.55"),
+		},
+		&SwapWithinBatch{
+			PoolID:          1,
+			BatchIndex:      1,
+			MsgIndex:        2,
+			SwapTypeID:      1,
+			OfferCoin:       sdk.NewInt64Coin("uusd", 30000),
+			OfferCoinFee:    sdk.NewInt64Coin("uusd", 45),
+			DemandCoinDenom: "uatom",
+			OrderPrice:      sdk.MustNewDecFromStr("0.45"),
+		},
+		&SwapTransacted{
+			PoolID:               1,
+			BatchIndex:           1,
+			MsgIndex:             1,
+			SwapRequester:        testAddr2,
+			SwapTypeID:           1,
+			OfferCoin:            sdk.NewInt64Coin("uatom", 10000),
+			OrderPrice:           sdk.MustNewDecFromStr("0.55"),
+			SwapPrice:            sdk.MustNewDecFromStr("0.495145631067961165"),
+			TransactedCoinAmount: sdk.MustNewDecFromStr("10000"),
+			RemainingOfferCoin:   sdk.NewInt64Coin("uatom", 0),
+			ExchangedOfferCoin:   sdk.NewInt64Coin("uatom", 10000),
+			OfferCoinFee:         sdk.NewInt64Coin("uatom", 15),
+			ReservedOfferCoinFee: sdk.NewInt64Coin("uatom", 0),
+			OrderExpiryHeight:    2,
+		},
+		&SwapTransacted{
+			PoolID:               1,
+			BatchIndex:           1,
+			MsgIndex:             2,
+			SwapRequester:        testAddr3,
+			SwapTypeID:           1,
+			OfferCoin:            sdk.NewInt64Coin("uusd", 30000),
+			OrderPrice:           sdk.MustNewDecFromStr("0.45"),
+			SwapPrice:            sdk.MustNewDecFromStr("0.495145631067961165"),
+			TransactedCoinAmount: sdk.MustNewDecFromStr("30000"),
+			RemainingOfferCoin:   sdk.NewInt64Coin("uusd", 0),
+			ExchangedOfferCoin:   sdk.NewInt64Coin("uusd", 30000),
+			OfferCoinFee:         sdk.NewInt64Coin("uusd", 45),
+			ReservedOfferCoinFee: sdk.NewInt64Coin("uusd", 0),
+			OrderExpiryHeight:    2,
+		},
+		&DepositToPool{
+			PoolID:        1,
+			BatchIndex:    1,
+			MsgIndex:      1,
+			Depositor:     testAddr2,
+			AcceptedCoins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 100000), sdk.NewInt64Coin("uusd", 201960)),
+			RefundedCoins: sdk.NewCoins(sdk.NewInt64Coin("uusd", 98040)),
+			PoolCoin:      sdk.NewInt64Coin(testPoolCoinDenom, 100483),
+		},
+		&WithdrawFromPool{
+			PoolID:         1,
+			BatchIndex:     1,
+			MsgIndex:       1,
+			Withdrawer:     testAddr1,
+			PoolCoin:       sdk.NewInt64Coin(testPoolCoinDenom, 100000),
+			WithdrawnCoins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 99219), sdk.NewInt64Coin("uusd", 200385)),
+		},
+	} {
+		require.Less(t, i, len(evts))
+		t.Run(evts[i].Type, func(t *testing.T) {
+			e, err := Decode(evts[i])
+			require.NoError(t, err)
+			require.Equal(t, expected, e)
+		})
+	}
+}
+
+func TestSwapTransacted_DemandCoin_Testdata(t *testing.T) {
+	evts := loadTestEvents(t)
+	pool := liquiditytypes.Pool{Id: 1, ReserveCoinDenoms: []string{"uatom", "uusd"}}
+	for _, tc := range []struct {
+		msgIndex uint64
+		expected sdk.Coin
+	}{
+		{1, sdk.NewInt64Coin("uusd", 20196)},
+		{2, sdk.NewInt64Coin("uatom", 14854)},
+	} {
+		var e *SwapTransacted
+		for _, evt := range evts {
+			if evt.Type != liquiditytypes.EventTypeSwapTransacted {
+				continue
+			}
+			st, err := DecodeSwapTransacted(evt)
+			require.NoError(t, err)
+			if st.MsgIndex == tc.msgIndex {
+				e = st
+			}
+		}
+		require.NotNil(t, e)
+		demandCoinDenom, ok := OppositeReserveCoinDenom(pool, e.OfferCoin.Denom)
+		require.True(t, ok)
+		require.Equal(t, tc.expected, e.DemandCoin(e.ExchangedOfferCoin, demandCoinDenom))
+	}
+}
+
+func TestOppositeReserveCoinDenom(t *testing.T) {
+	pool := liquiditytypes.Pool{ReserveCoinDenoms: []string{"uatom", "uusd"}}
+	denom, ok := OppositeReserveCoinDenom(pool, "uatom")
+	require.True(t, ok)
+	require.Equal(t, "uusd", denom)
+	denom, ok = OppositeReserveCoinDenom(pool, "uusd")
+	require.True(t, ok)
+	require.Equal(t, "uatom", denom)
+	_, ok = OppositeReserveCoinDenom(liquiditytypes.Pool{}, "uatom")
+	require.False(t, ok)
+}
@@ -6,7 +6,9 @@ require (
 	github.com/cosmos/cosmos-sdk v0.42.4
 	github.com/gomodule/redigo v1.8.4
 	github.com/json-iterator/go v1.1.10
+	github.com/klauspost/compress v1.9.5
 	github.com/labstack/echo/v4 v4.2.2
+	github.com/prometheus/client_golang v1.8.0
 	github.com/spf13/cobra v1.1.3
 	github.com/stretchr/testify v1.7.0
 	github.com/tendermint/liquidity v1.2.4
@@ -3,17 +3,18 @@ package schema
 import "time"
 
 type AccountCache struct {
-	BlockHeight   int64                    `json:"H"`
-	Address       string                   `json:"A"`
-	Username      string                   `json:"U"`
-	Ranking       int                      `json:"R"`
-	TotalScore    float64                  `json:"S"`
-	ActionScore   float64                  `json:"AS"`
-	TradingScore  float64                  `json:"T"`
-	IsValid       bool                     `json:"V"`
-	DepositStatus AccountCacheActionStatus `json:"D"`
-	SwapStatus    AccountCacheActionStatus `json:"SS"`
-	UpdatedAt     time.Time                `json:"UA"`
+	BlockHeight    int64                    `json:"H"`
+	Address        string                   `json:"A"`
+	Username       string                   `json:"U"`
+	Ranking        int                      `json:"R"`
+	TotalScore     float64                  `json:"S"`
+	ActionScore    float64                  `json:"AS"`
+	TradingScore   float64                  `json:"T"`
+	IsValid        bool                     `json:"V"`
+	DepositStatus  AccountCacheActionStatus `json:"D"`
+	SwapStatus     AccountCacheActionStatus `json:"SS"`
+	WithdrawStatus AccountCacheActionStatus `json:"W"`
+	UpdatedAt      time.Time                `json:"UA"`
 }
 
 type AccountCacheActionStatus struct {
@@ -21,10 +22,14 @@ type AccountCacheActionStatus struct {
 	NumDifferentPoolsByDate map[string]int `json:"B"`
 }
 
+// ScoreBoardCache holds the metadata of the score board.
+// The accounts are cached separately as a list in ranking order,
+// where valid accounts come first.
 type ScoreBoardCache struct {
-	BlockHeight int64          `json:"H"`
-	Accounts    []AccountCache `json:"A"`
-	UpdatedAt   time.Time      `json:"U"`
+	BlockHeight      int64     `json:"H"`
+	NumAccounts      int       `json:"N"`
+	NumValidAccounts int       `json:"NV"`
+	UpdatedAt        time.Time `json:"U"`
 }
 
 type PoolsCache struct {
@@ -44,10 +49,19 @@ type PoolsCachePool struct {
 
 type PoolsCacheCoin struct {
 	Denom       string  `json:"denom"`
-	Amount      int64   `json:"amount"`
+	Amount      Int     `json:"amount"`
 	GlobalPrice float64 `json:"globalPrice"`
 }
 
+// BlockHeightUpdate is published when the latest block height of the transformer,
+// or of the server caches, has advanced.
+// Invalidated is set when the data has changed without a new block,
+// e.g. by moderation, so the caches must be rebuilt anyway.
+type BlockHeightUpdate struct {
+	BlockHeight int64 `json:"blockHeight"`
+	Invalidated bool  `json:"invalidated,omitempty"`
+}
+
 type PricesCache struct {
 	BlockHeight int64              `json:"blockHeight"`
 	Prices      map[string]float64 `json:"prices"`
@@ -0,0 +1,171 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Int is an arbitrary-precision integer used for coin amounts.
+// The zero value is 0, and Ints are never modified in place.
+// It is stored as a decimal string in the database, and encoded as a JSON string
+// so that clients do not lose precision parsing large amounts as numbers.
+// Amounts stored as numbers by older versions are decoded as well.
+type Int struct {
+	i *big.Int
+}
+
+func NewInt(n int64) Int {
+	return Int{big.NewInt(n)}
+}
+
+func NewIntFromBigInt(i *big.Int) Int {
+	if i == nil {
+		return Int{}
+	}
+	return Int{new(big.Int).Set(i)}
+}
+
+func NewIntFromSDK(i sdk.Int) Int {
+	return NewIntFromBigInt(i.BigInt())
+}
+
+func ParseInt(s string) (Int, error) {
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return Int{}, fmt.Errorf("invalid integer: %q", s)
+	}
+	return Int{i}, nil
+}
+
+func (i Int) bigInt() *big.Int {
+	if i.i == nil {
+		return new(big.Int)
+	}
+	return i.i
+}
+
+func (i Int) BigInt() *big.Int {
+	return new(big.Int).Set(i.bigInt())
+}
+
+func (i Int) SDK() sdk.Int {
+	return sdk.NewIntFromBigInt(i.bigInt())
+}
+
+func (i Int) Add(j Int) Int {
+	return Int{new(big.Int).Add(i.bigInt(), j.bigInt())}
+}
+
+func (i Int) Sub(j Int) Int {
+	return Int{new(big.Int).Sub(i.bigInt(), j.bigInt())}
+}
+
+func (i Int) Quo(n int64) Int {
+	return Int{new(big.Int).Quo(i.bigInt(), big.NewInt(n))}
+}
+
+func (i Int) Cmp(j Int) int {
+	return i.bigInt().Cmp(j.bigInt())
+}
+
+func (i Int) Sign() int {
+	return i.bigInt().Sign()
+}
+
+func (i Int) IsZero() bool {
+	return i.Sign() == 0
+}
+
+func (i Int) Float64() float64 {
+	f, _ := new(big.Float).SetInt(i.bigInt()).Float64()
+	return f
+}
+
+func (i Int) String() string {
+	return i.bigInt().String()
+}
+
+func (i Int) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.String, bsoncore.AppendString(nil, i.String()), nil
+}
+
+func (i *Int) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	v := bsoncore.Value{Type: t, Data: data}
+	switch t {
+	case bsontype.String:
+		s, ok := v.StringValueOK()
+		if !ok {
+			return fmt.Errorf("invalid string value")
+		}
+		j, err := ParseInt(s)
+		if err != nil {
+			return err
+		}
+		*i = j
+	case bsontype.Int64:
+		*i = NewInt(v.Int64())
+	case bsontype.Int32:
+		*i = NewInt(int64(v.Int32()))
+	case bsontype.Double:
+		bf := new(big.Float).SetFloat64(v.Double())
+		bi, _ := bf.Int(nil)
+		*i = Int{bi}
+	case bsontype.Decimal128:
+		bi, exp, err := v.Decimal128().BigInt()
+		if err != nil {
+			return err
+		}
+		for ; exp > 0; exp-- {
+			bi.Mul(bi, big.NewInt(10))
+		}
+		for ; exp < 0; exp++ {
+			bi.Quo(bi, big.NewInt(10))
+		}
+		*i = Int{bi}
+	case bsontype.Null:
+		*i = Int{}
+	default:
+		return fmt.Errorf("cannot decode %s into an Int", t)
+	}
+	return nil
+}
+
+func (i Int) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(i.String())), nil
+}
+
+func (i *Int) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*i = Int{}
+		return nil
+	}
+	s := string(data)
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	j, err := ParseInt(s)
+	if err != nil {
+		return err
+	}
+	*i = j
+	return nil
+}
+
+func (i Int) GobEncode() ([]byte, error) {
+	return i.bigInt().GobEncode()
+}
+
+func (i *Int) GobDecode(data []byte) error {
+	bi := new(big.Int)
+	if err := bi.GobDecode(data); err != nil {
+		return err
+	}
+	*i = Int{bi}
+	return nil
+}
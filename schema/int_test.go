@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInt_BSON(t *testing.T) {
+	amount, err := ParseInt("123456789012345678901234567890")
+	require.NoError(t, err)
+
+	bz, err := bson.Marshal(Balance{Coins: []Coin{{Denom: "weth", Amount: amount}}})
+	require.NoError(t, err)
+	var raw bson.M
+	require.NoError(t, bson.Unmarshal(bz, &raw))
+	require.Equal(t, "123456789012345678901234567890", raw["coins"].(bson.A)[0].(bson.M)["amount"])
+	var b Balance
+	require.NoError(t, bson.Unmarshal(bz, &b))
+	require.Equal(t, amount.String(), b.Coins[0].Amount.String())
+
+	bz, err = bson.Marshal(PoolStatus{SwapVolume: CoinMap{"weth": amount}})
+	require.NoError(t, err)
+	var st PoolStatus
+	require.NoError(t, bson.Unmarshal(bz, &st))
+	require.Equal(t, amount.String(), st.SwapVolume["weth"].String())
+}
+
+func TestInt_BSONLegacy(t *testing.T) {
+	d, err := primitive.ParseDecimal128("1.5E+3")
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		v        interface{}
+		expected string
+	}{
+		{int64(1000000), "1000000"},
+		{int32(-42), "-42"},
+		{float64(2500), "2500"},
+		{d, "1500"},
+		{"77", "77"},
+	} {
+		bz, err := bson.Marshal(bson.M{"denom": "uatom", "amount": tc.v})
+		require.NoError(t, err)
+		var c Coin
+		require.NoError(t, bson.Unmarshal(bz, &c))
+		require.Equal(t, tc.expected, c.Amount.String())
+	}
+}
+
+func TestInt_JSON(t *testing.T) {
+	amount, err := ParseInt("123456789012345678901234567890")
+	require.NoError(t, err)
+	bz, err := json.Marshal(PoolsCacheCoin{Denom: "weth", Amount: amount})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"denom":"weth","amount":"123456789012345678901234567890","globalPrice":0}`, string(bz))
+	var c PoolsCacheCoin
+	require.NoError(t, json.Unmarshal(bz, &c))
+	require.Equal(t, amount.String(), c.Amount.String())
+	// Amounts encoded as numbers by older versions are decoded as well.
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":42}`), &c))
+	require.Equal(t, "42", c.Amount.String())
+}
+
+func TestInt_Gob(t *testing.T) {
+	cm := CoinMap{"weth": NewInt(-5), "uatom": NewInt(10)}
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(cm))
+	var cm2 CoinMap
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&cm2))
+	require.Equal(t, "-5", cm2["weth"].String())
+	require.Equal(t, "10", cm2["uatom"].String())
+}
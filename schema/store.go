@@ -1,37 +1,72 @@
 package schema
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"time"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
-	CheckpointBlockHeightKey = "blockHeight"
-	CheckpointTimestampKey   = "timestamp"
+	CheckpointBlockHeightKey        = "blockHeight"
+	CheckpointTimestampKey          = "timestamp"
+	CheckpointPendingBlockHeightKey = "pendingBlockHeight"
+	CheckpointPendingSinceKey       = "pendingSince"
+	CheckpointRolledBackFromKey     = "rolledBackFrom"
 )
 
 type Checkpoint struct {
 	BlockHeight int64     `bson:"blockHeight"`
 	Timestamp   time.Time `bson:"timestamp"`
+	// PendingBlockHeight is the last block height of a commit made without
+	// a transaction which has not finished yet, and PendingSince is the time
+	// of its first block.
+	PendingBlockHeight int64     `bson:"pendingBlockHeight,omitempty"`
+	PendingSince       time.Time `bson:"pendingSince,omitempty"`
+	// RolledBackFrom is the block height before the last rollback, until the
+	// transformer replays the blocks up to it. Balances, supplies and pools
+	// are not rolled back, so they are ahead of the other state until then.
+	RolledBackFrom int64 `bson:"rolledBackFrom,omitempty"`
+}
+
+// Replaying reports whether the transformer has not replayed the blocks
+// rolled back yet.
+func (cp Checkpoint) Replaying() bool {
+	return cp.RolledBackFrom > cp.BlockHeight
+}
+
+const (
+	StateSnapshotBlockHeightKey = "blockHeight"
+	StateSnapshotTimestampKey   = "timestamp"
+)
+
+// StateSnapshot marks a block height whose account and pool statuses
+// are retained, so the state can be rolled back to it.
+type StateSnapshot struct {
+	BlockHeight int64     `bson:"blockHeight"`
+	Timestamp   time.Time `bson:"timestamp"`
 }
 
 const (
-	AccountAddressKey   = "address"
-	AccountUsernameKey  = "username"
-	AccountIsBlockedKey = "isBlocked"
-	AccountBlockedAtKey = "blockedAt"
-	AccountCreatedAtKey = "createdAt"
-	AccountStatusKey    = "status"
-	AccountBalanceKey   = "balance"
+	AccountAddressKey     = "address"
+	AccountUsernameKey    = "username"
+	AccountIsBlockedKey   = "isBlocked"
+	AccountBlockedAtKey   = "blockedAt"
+	AccountBlockReasonKey = "blockReason"
+	AccountCreatedAtKey   = "createdAt"
+	AccountStatusKey      = "status"
+	AccountBalanceKey     = "balance"
 )
 
 type Account struct {
-	Address   string     `bson:"address"`
-	Username  string     `bson:"username"`
-	IsBlocked bool       `bson:"isBlocked"`
-	BlockedAt *time.Time `bson:"blockedAt,omitempty"`
-	CreatedAt time.Time  `bson:"createdAt"`
+	Address     string     `bson:"address"`
+	Username    string     `bson:"username"`
+	IsBlocked   bool       `bson:"isBlocked"`
+	BlockedAt   *time.Time `bson:"blockedAt,omitempty"`
+	BlockReason string     `bson:"blockReason,omitempty"`
+	CreatedAt   time.Time  `bson:"createdAt"`
 
 	Status  *AccountStatus `bson:"status"`
 	Balance *Balance       `bson:"balance"`
@@ -51,6 +86,13 @@ func (acc Account) SwapStatus() AccountActionStatus {
 	return AccountActionStatus{}
 }
 
+func (acc Account) WithdrawStatus() AccountActionStatus {
+	if acc.Status != nil {
+		return acc.Status.Withdrawals
+	}
+	return AccountActionStatus{}
+}
+
 func (acc Account) Coins() []Coin {
 	if acc.Balance != nil {
 		return acc.Balance.Coins
@@ -63,6 +105,7 @@ const (
 	AccountStatusAddressKey     = "address"
 	AccountStatusDepositsKey    = "deposits"
 	AccountStatusSwapsKey       = "swaps"
+	AccountStatusWithdrawalsKey = "withdrawals"
 )
 
 type AccountStatus struct {
@@ -70,6 +113,7 @@ type AccountStatus struct {
 	Address     string              `bson:"address"`
 	Deposits    AccountActionStatus `bson:"deposits"`
 	Swaps       AccountActionStatus `bson:"swaps"`
+	Withdrawals AccountActionStatus `bson:"withdrawals"`
 }
 
 type AccountActionStatus struct {
@@ -120,6 +164,46 @@ func (s *AccountActionStatus) IncreaseCount(poolID uint64, date string, amount i
 	c[poolID] += amount
 }
 
+const (
+	AccountEventBlockHeightKey = "blockHeight"
+	AccountEventIndexKey       = "index"
+	AccountEventAddressKey     = "address"
+	AccountEventTypeKey        = "type"
+	AccountEventPoolIDKey      = "poolId"
+	AccountEventTimestampKey   = "timestamp"
+	AccountEventCoinsKey       = "coins"
+	AccountEventSwapPriceKey   = "swapPrice"
+	AccountEventFeesKey        = "fees"
+)
+
+type AccountEventType string
+
+const (
+	AccountEventTypeDeposit  = AccountEventType("deposit")
+	AccountEventTypeWithdraw = AccountEventType("withdraw")
+	AccountEventTypeSwap     = AccountEventType("swap")
+)
+
+func (t AccountEventType) IsValid() bool {
+	switch t {
+	case AccountEventTypeDeposit, AccountEventTypeWithdraw, AccountEventTypeSwap:
+		return true
+	}
+	return false
+}
+
+type AccountEvent struct {
+	BlockHeight int64            `bson:"blockHeight"`
+	Index       int              `bson:"index"`
+	Address     string           `bson:"address"`
+	Type        AccountEventType `bson:"type"`
+	PoolID      uint64           `bson:"poolId"`
+	Timestamp   time.Time        `bson:"timestamp"`
+	Coins       []Coin           `bson:"coins"`
+	SwapPrice   string           `bson:"swapPrice,omitempty"`
+	Fees        []Coin           `bson:"fees,omitempty"`
+}
+
 const (
 	BalanceBlockHeightKey = "blockHeight"
 	BalanceAddressKey     = "address"
@@ -134,11 +218,11 @@ type Balance struct {
 
 type Coin struct {
 	Denom  string `bson:"denom"`
-	Amount int64  `bson:"amount"`
+	Amount Int    `bson:"amount"`
 }
 
 func CoinFromSDK(coin sdk.Coin) Coin {
-	return Coin{Denom: coin.Denom, Amount: coin.Amount.Int64()}
+	return Coin{Denom: coin.Denom, Amount: NewIntFromSDK(coin.Amount)}
 }
 
 func CoinsFromSDK(coins sdk.Coins) []Coin {
@@ -202,23 +286,114 @@ func (p Pool) ReserveCoins() []Coin {
 	return cs
 }
 
-func (p Pool) PoolCoinAmount() int64 {
+func (p Pool) PoolCoinAmount() Int {
 	if p.PoolCoinSupply != nil {
 		return p.PoolCoinSupply.Amount
 	}
-	return 0
+	return Int{}
 }
 
 const (
 	PoolStatusBlockHeightKey    = "blockHeight"
 	PoolStatusIDKey             = "id"
 	PoolStatusSwapFeeVolumesKey = "swapFeeVolumes"
+	PoolStatusSwapVolumeKey     = "swapVolume"
 )
 
 type PoolStatus struct {
 	BlockHeight    int64   `bson:"blockHeight"`
 	ID             uint64  `bson:"id"`
 	SwapFeeVolumes Volumes `bson:"swapFeeVolumes"`
+	SwapVolume     CoinMap `bson:"swapVolume"` // accumulated since genesis
+}
+
+const (
+	PoolSnapshotBlockHeightKey  = "blockHeight"
+	PoolSnapshotIDKey           = "id"
+	PoolSnapshotTimestampKey    = "timestamp"
+	PoolSnapshotReserveCoinsKey = "reserveCoins"
+	PoolSnapshotPoolCoinKey     = "poolCoin"
+	PoolSnapshotPriceKey        = "price"
+	PoolSnapshotSwapVolumeKey   = "swapVolume"
+	PoolSnapshotPricesKey       = "prices"
+)
+
+type PoolSnapshot struct {
+	BlockHeight  int64     `bson:"blockHeight"`
+	ID           uint64    `bson:"id"`
+	Timestamp    time.Time `bson:"timestamp"`
+	ReserveCoins []Coin    `bson:"reserveCoins"`
+	PoolCoin     Coin      `bson:"poolCoin"`
+	Price        float64   `bson:"price"`
+	SwapVolume   CoinMap   `bson:"swapVolume"` // accumulated since genesis
+	// Prices are the USD prices of the reserve coins and the pool coin at the time
+	// of the snapshot. They are set later by the server, and missing for snapshots
+	// taken while the transformer was catching up until set from a price history.
+	Prices map[string]float64 `bson:"prices,omitempty"`
+}
+
+const (
+	PoolCandleIDKey         = "id"
+	PoolCandleResolutionKey = "resolution"
+	PoolCandleTimestampKey  = "timestamp"
+	PoolCandleOpenKey       = "open"
+	PoolCandleHighKey       = "high"
+	PoolCandleLowKey        = "low"
+	PoolCandleCloseKey      = "close"
+	PoolCandleVolumeXKey    = "volumeX"
+	PoolCandleVolumeYKey    = "volumeY"
+	PoolCandleNumSwapsKey   = "numSwaps"
+)
+
+// PoolCandle holds swap prices(reserve coin X / reserve coin Y) and
+// volumes of a pool during a time window.
+type PoolCandle struct {
+	ID         uint64    `bson:"id"`
+	Resolution int64     `bson:"resolution"` // in seconds
+	Timestamp  time.Time `bson:"timestamp"`
+	Open       float64   `bson:"open"`
+	High       float64   `bson:"high"`
+	Low        float64   `bson:"low"`
+	Close      float64   `bson:"close"`
+	VolumeX    Int       `bson:"volumeX"`
+	VolumeY    Int       `bson:"volumeY"`
+	NumSwaps   int       `bson:"numSwaps"`
+}
+
+// Merge merges a candle of the same window that comes after c.
+func (c *PoolCandle) Merge(c2 PoolCandle) {
+	if c2.NumSwaps == 0 {
+		return
+	}
+	if c.NumSwaps == 0 {
+		c.Open, c.High, c.Low = c2.Open, c2.High, c2.Low
+	}
+	if c2.High > c.High {
+		c.High = c2.High
+	}
+	if c2.Low < c.Low {
+		c.Low = c2.Low
+	}
+	c.Close = c2.Close
+	c.VolumeX = c.VolumeX.Add(c2.VolumeX)
+	c.VolumeY = c.VolumeY.Add(c2.VolumeY)
+	c.NumSwaps += c2.NumSwaps
+}
+
+func (c *PoolCandle) Update(price float64, volumeX, volumeY Int) {
+	if c.NumSwaps == 0 {
+		c.Open, c.High, c.Low = price, price, price
+	}
+	if price > c.High {
+		c.High = price
+	}
+	if price < c.Low {
+		c.Low = price
+	}
+	c.Close = price
+	c.VolumeX = c.VolumeX.Add(volumeX)
+	c.VolumeY = c.VolumeY.Add(volumeY)
+	c.NumSwaps++
 }
 
 const VolumeTimeUnit = time.Minute
@@ -268,21 +443,41 @@ func (v Volumes) RemoveOutdated(past time.Time) {
 	}
 }
 
-type CoinMap map[string]int64
+type CoinMap map[string]Int
+
+func MergeCoinMaps(cs ...CoinMap) CoinMap {
+	c := make(CoinMap)
+	for _, c2 := range cs {
+		c.Add(c2)
+	}
+	return c
+}
 
 func (c CoinMap) Add(c2 CoinMap) {
 	for denom, amount := range c2 {
-		c[denom] += amount
+		c[denom] = c[denom].Add(amount)
 	}
 }
 
+func (c CoinMap) Sub(c2 CoinMap) CoinMap {
+	res := MergeCoinMaps(c)
+	for denom, amount := range c2 {
+		res[denom] = res[denom].Sub(amount)
+	}
+	return res
+}
+
 const (
+	BannerIDKey        = "id"
 	BannerVisibleAtKey = "visibleAt"
 	BannerStartsAtKey  = "startsAt"
 	BannerEndsAtKey    = "endsAt"
 )
 
+// Banner is shown from VisibleAt with UpcomingText, and from StartsAt
+// with Text, until EndsAt.
 type Banner struct {
+	ID           string    `bson:"id"`
 	UpcomingText string    `bson:"upcomingText"`
 	Text         string    `bson:"text"`
 	URL          string    `bson:"url"`
@@ -290,3 +485,66 @@ type Banner struct {
 	StartsAt     time.Time `bson:"startsAt"`
 	EndsAt       time.Time `bson:"endsAt"`
 }
+
+func (b Banner) Validate() error {
+	if b.ID == "" {
+		return fmt.Errorf("id must be provided")
+	}
+	if b.Text == "" {
+		return fmt.Errorf("text must be provided")
+	}
+	if b.VisibleAt.After(b.StartsAt) {
+		return fmt.Errorf("visibleAt must not be after startsAt")
+	}
+	if !b.StartsAt.Before(b.EndsAt) {
+		return fmt.Errorf("startsAt must be before endsAt")
+	}
+	return nil
+}
+
+// DerivedID returns an id derived from the start time and the text, which is
+// given to banners without an id, imported by older versions.
+func (b Banner) DerivedID() string {
+	h := sha256.Sum256([]byte(b.Text))
+	return fmt.Sprintf("%s-%x", b.StartsAt.UTC().Format("20060102T150405Z"), h[:4])
+}
+
+// Overlaps reports whether the banners are visible at the same time.
+func (b Banner) Overlaps(other Banner) bool {
+	return b.VisibleAt.Before(other.EndsAt) && other.VisibleAt.Before(b.EndsAt)
+}
+
+const (
+	AuditLogIDKey        = "_id"
+	AuditLogActorKey     = "actor"
+	AuditLogActionKey    = "action"
+	AuditLogAddressKey   = "address"
+	AuditLogBannerIDKey  = "bannerId"
+	AuditLogCreatedAtKey = "createdAt"
+)
+
+type AuditLogAction string
+
+const (
+	AuditLogActionBlockAccount   = AuditLogAction("blockAccount")
+	AuditLogActionUnblockAccount = AuditLogAction("unblockAccount")
+	AuditLogActionRenameAccount  = AuditLogAction("renameAccount")
+	AuditLogActionSaveBanner     = AuditLogAction("saveBanner")
+	AuditLogActionDeleteBanner   = AuditLogAction("deleteBanner")
+)
+
+// AuditLog records an action taken through the admin API.
+// It is inserted as pending before the action is taken, and marked done
+// afterwards, so that there is no change without its log.
+type AuditLog struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Pending     bool               `bson:"pending,omitempty"` // the action may or may not have been taken
+	Actor       string             `bson:"actor"`
+	Action      AuditLogAction     `bson:"action"`
+	Address     string             `bson:"address,omitempty"`
+	BannerID    string             `bson:"bannerId,omitempty"`
+	Reason      string             `bson:"reason,omitempty"`
+	OldUsername string             `bson:"oldUsername,omitempty"`
+	NewUsername string             `bson:"newUsername,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt"`
+}
@@ -11,31 +11,31 @@ import (
 func TestMergeVolumes(t *testing.T) {
 	v1 := Volumes{
 		time.Date(2021, time.April, 30, 6, 0, 35, 0, time.UTC).Unix(): CoinMap{
-			"atom": 100,
+			"atom": NewInt(100),
 		},
 		time.Date(2021, time.April, 30, 6, 0, 42, 0, time.UTC).Unix(): CoinMap{
-			"atom": 200,
+			"atom": NewInt(200),
 		},
 		time.Date(2021, time.April, 30, 6, 1, 0, 0, time.UTC).Unix(): CoinMap{
-			"atom": 50,
-			"usd":  20,
+			"atom": NewInt(50),
+			"usd":  NewInt(20),
 		},
 	}
 	v2 := Volumes{
 		time.Date(2021, time.April, 30, 6, 0, 37, 0, time.UTC).Unix(): CoinMap{
-			"atom": 50,
+			"atom": NewInt(50),
 		},
 		time.Date(2021, time.April, 30, 6, 1, 30, 0, time.UTC).Unix(): CoinMap{
-			"usd": 70,
+			"usd": NewInt(70),
 		},
 	}
 	v := MergeVolumes(v1, v2)
 	t1 := time.Date(2021, time.April, 30, 6, 0, 0, 0, time.UTC).Truncate(VolumeTimeUnit).Unix()
 	t2 := time.Date(2021, time.April, 30, 6, 1, 0, 0, time.UTC).Truncate(VolumeTimeUnit).Unix()
-	assert.Equal(t, int64(350), v[t1]["atom"])
-	assert.Equal(t, int64(0), v[t1]["usd"])
-	assert.Equal(t, int64(50), v[t2]["atom"])
-	assert.Equal(t, int64(90), v[t2]["usd"])
+	assert.Equal(t, "350", v[t1]["atom"].String())
+	assert.Equal(t, "0", v[t1]["usd"].String())
+	assert.Equal(t, "50", v[t2]["atom"].String())
+	assert.Equal(t, "90", v[t2]["usd"].String())
 }
 
 func TestMergeNilVolumes(t *testing.T) {
@@ -47,17 +47,100 @@ func TestMergeNilVolumes(t *testing.T) {
 func TestVolumes_RemoveOutdated(t *testing.T) {
 	v := Volumes{
 		time.Date(2021, time.April, 30, 6, 0, 0, 0, time.UTC).Truncate(VolumeTimeUnit).Unix(): CoinMap{
-			"atom": 20,
-			"usd":  100,
+			"atom": NewInt(20),
+			"usd":  NewInt(100),
 		},
 		time.Date(2021, time.April, 30, 6, 1, 30, 0, time.UTC).Truncate(VolumeTimeUnit).Unix(): CoinMap{
-			"atom": 100,
-			"usd":  200,
+			"atom": NewInt(100),
+			"usd":  NewInt(200),
 		},
 		time.Date(2021, time.April, 30, 7, 0, 0, 0, time.UTC).Truncate(VolumeTimeUnit).Unix(): CoinMap{
-			"usd": 300,
+			"usd": NewInt(300),
 		},
 	}
 	v.RemoveOutdated(time.Date(2021, time.April, 30, 7, 2, 0, 0, time.UTC).Add(-time.Hour))
 	require.Len(t, v, 1)
 }
+
+func TestCoinMap_Sub(t *testing.T) {
+	c1 := CoinMap{"atom": NewInt(100), "usd": NewInt(50)}
+	c2 := CoinMap{"atom": NewInt(30), "luna": NewInt(10)}
+	c := c1.Sub(c2)
+	assert.Equal(t, "70", c["atom"].String())
+	assert.Equal(t, "50", c["usd"].String())
+	assert.Equal(t, "-10", c["luna"].String())
+	assert.Equal(t, "100", c1["atom"].String())
+}
+
+func TestPoolCandle_Update(t *testing.T) {
+	var c PoolCandle
+	c.Update(1.5, NewInt(100), NewInt(150))
+	c.Update(2.0, NewInt(10), NewInt(20))
+	c.Update(0.5, NewInt(40), NewInt(20))
+	c.Update(1.0, NewInt(1), NewInt(1))
+	assert.Equal(t, 1.5, c.Open)
+	assert.Equal(t, 2.0, c.High)
+	assert.Equal(t, 0.5, c.Low)
+	assert.Equal(t, 1.0, c.Close)
+	assert.Equal(t, "151", c.VolumeX.String())
+	assert.Equal(t, "191", c.VolumeY.String())
+	assert.Equal(t, 4, c.NumSwaps)
+}
+
+func TestBanner_Validate(t *testing.T) {
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		banner Banner
+		valid  bool
+	}{
+		{Banner{ID: "a", Text: "a", VisibleAt: t0, StartsAt: t0, EndsAt: t0.Add(time.Hour)}, true},
+		{Banner{ID: "a", Text: "a", VisibleAt: t0, StartsAt: t0.Add(time.Minute), EndsAt: t0.Add(time.Hour)}, true},
+		{Banner{Text: "a", VisibleAt: t0, StartsAt: t0, EndsAt: t0.Add(time.Hour)}, false},
+		{Banner{ID: "a", VisibleAt: t0, StartsAt: t0, EndsAt: t0.Add(time.Hour)}, false},
+		{Banner{ID: "a", Text: "a", VisibleAt: t0.Add(time.Minute), StartsAt: t0, EndsAt: t0.Add(time.Hour)}, false},
+		{Banner{ID: "a", Text: "a", VisibleAt: t0, StartsAt: t0, EndsAt: t0}, false},
+	} {
+		err := tc.banner.Validate()
+		if tc.valid {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err)
+		}
+	}
+}
+
+func TestBanner_DerivedID(t *testing.T) {
+	t0 := time.Date(2021, time.May, 4, 9, 0, 0, 0, time.UTC)
+	b := Banner{Text: "event 1", VisibleAt: t0.Add(-time.Hour), StartsAt: t0, EndsAt: t0.Add(time.Hour)}
+	id := b.DerivedID()
+	require.Regexp(t, `^20210504T090000Z-[0-9a-f]{8}$`, id)
+	// The id does not depend on the time zone or the other fields.
+	b2 := b
+	b2.StartsAt = t0.In(time.FixedZone("KST", 9*60*60))
+	b2.URL = "https://example.com"
+	require.Equal(t, id, b2.DerivedID())
+	b2.Text = "event 2"
+	require.NotEqual(t, id, b2.DerivedID())
+	b2 = b
+	b2.StartsAt = t0.Add(time.Second)
+	require.NotEqual(t, id, b2.DerivedID())
+}
+
+func TestBanner_Overlaps(t *testing.T) {
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	b := Banner{VisibleAt: t0, StartsAt: t0.Add(time.Hour), EndsAt: t0.Add(2 * time.Hour)}
+	for _, tc := range []struct {
+		visibleAt, endsAt time.Duration
+		overlaps          bool
+	}{
+		{-time.Hour, 0, false},
+		{-time.Hour, time.Minute, true},
+		{30 * time.Minute, 90 * time.Minute, true},
+		{-time.Hour, 3 * time.Hour, true},
+		{2 * time.Hour, 3 * time.Hour, false},
+	} {
+		other := Banner{VisibleAt: t0.Add(tc.visibleAt), StartsAt: t0.Add(tc.visibleAt), EndsAt: t0.Add(tc.endsAt)}
+		assert.Equal(t, tc.overlaps, b.Overlaps(other))
+		assert.Equal(t, tc.overlaps, other.Overlaps(b))
+	}
+}
@@ -3,17 +3,48 @@ package schema
 import "time"
 
 type GetStatusResponse struct {
-	LatestBlockHeight int64 `json:"latestBlockHeight"`
+	LatestBlockHeight int64  `json:"latestBlockHeight"`
+	InstanceID        string `json:"instanceId"`
+	Leader            string `json:"leader"`
+	IsLeader          bool   `json:"isLeader"`
 }
 
+type GetHealthResponse struct {
+	Status string `json:"status"`
+}
+
+type GetReadinessResponse struct {
+	Status string                      `json:"status"`
+	Checks []GetReadinessResponseCheck `json:"checks"`
+}
+
+type GetReadinessResponseCheck struct {
+	Name       string   `json:"name"`
+	Status     string   `json:"status"`
+	Error      string   `json:"error,omitempty"`
+	AgeSeconds *float64 `json:"ageSeconds,omitempty"`
+}
+
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded"
+)
+
 type GetScoreBoardRequest struct {
 	Address string `query:"address"`
+	Offset  int    `query:"offset"`
+	Limit   int    `query:"limit"`
+	Around  string `query:"around"`
+	Radius  int    `query:"radius"`
+	Valid   string `query:"valid"`
 }
 
 type GetScoreBoardResponse struct {
 	BlockHeight int64                          `json:"blockHeight"`
 	Me          *GetScoreBoardResponseAccount  `json:"me"`
 	Accounts    []GetScoreBoardResponseAccount `json:"accounts"`
+	Offset      int                            `json:"offset"`
+	Total       int                            `json:"total"`
 	UpdatedAt   time.Time                      `json:"updatedAt"`
 }
 
@@ -48,8 +79,9 @@ type GetActionStatusResponse struct {
 }
 
 type GetActionStatusResponseAccount struct {
-	Deposit GetActionStatusResponseStatus `json:"deposit"`
-	Swap    GetActionStatusResponseStatus `json:"swap"`
+	Deposit  GetActionStatusResponseStatus `json:"deposit"`
+	Swap     GetActionStatusResponseStatus `json:"swap"`
+	Withdraw GetActionStatusResponseStatus `json:"withdraw"`
 }
 
 type GetActionStatusResponseStatus struct {
@@ -58,8 +90,83 @@ type GetActionStatusResponseStatus struct {
 	MaxNumDifferentPoolsToday int `json:"maxNumDifferentPoolsToday"`
 }
 
+type GetAccountHistoryRequest struct {
+	Address string `param:"address"`
+	Type    string `query:"type"`
+	PoolID  uint64 `query:"poolId"`
+	Cursor  int64  `query:"cursor"`
+	Limit   int    `query:"limit"`
+}
+
+type GetAccountHistoryResponse struct {
+	Address    string                           `json:"address"`
+	Events     []GetAccountHistoryResponseEvent `json:"events"`
+	NextCursor *int64                           `json:"nextCursor"`
+}
+
+type GetAccountHistoryResponseEvent struct {
+	BlockHeight int64                           `json:"blockHeight"`
+	Timestamp   time.Time                       `json:"timestamp"`
+	Type        string                          `json:"type"`
+	PoolID      uint64                          `json:"poolId"`
+	Coins       []GetAccountHistoryResponseCoin `json:"coins"`
+	SwapPrice   string                          `json:"swapPrice,omitempty"`
+	Fees        []GetAccountHistoryResponseCoin `json:"fees,omitempty"`
+}
+
+type GetAccountHistoryResponseCoin struct {
+	Denom  string `json:"denom"`
+	Amount Int    `json:"amount"`
+}
+
 type GetPoolsResponse PoolsCache
 
+type GetPoolHistoryRequest struct {
+	ID       uint64 `param:"id"`
+	From     int64  `query:"from"`
+	To       int64  `query:"to"`
+	Interval string `query:"interval"`
+}
+
+type GetPoolHistoryResponse struct {
+	ID     uint64                        `json:"id"`
+	Points []GetPoolHistoryResponsePoint `json:"points"`
+}
+
+type GetPoolHistoryResponsePoint struct {
+	Timestamp        time.Time        `json:"timestamp"`
+	BlockHeight      int64            `json:"blockHeight"`
+	ReserveCoins     []PoolsCacheCoin `json:"reserveCoins"`
+	PoolCoin         PoolsCacheCoin   `json:"poolCoin"`
+	Price            float64          `json:"price"`
+	TotalValueLocked *float64         `json:"totalValueLocked"`
+	SwapVolume       *float64         `json:"swapVolume"`
+}
+
+type GetPoolCandlesRequest struct {
+	ID         uint64 `param:"id"`
+	Resolution string `query:"resolution"`
+	From       int64  `query:"from"`
+	To         int64  `query:"to"`
+}
+
+type GetPoolCandlesResponse struct {
+	ID         uint64                         `json:"id"`
+	Resolution string                         `json:"resolution"`
+	Candles    []GetPoolCandlesResponseCandle `json:"candles"`
+}
+
+type GetPoolCandlesResponseCandle struct {
+	Timestamp time.Time `json:"timestamp"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	VolumeX   Int       `json:"volumeX"`
+	VolumeY   Int       `json:"volumeY"`
+	NumSwaps  int       `json:"numSwaps"`
+}
+
 type GetPricesResponse PricesCache
 
 type GetBannerResponse struct {
@@ -80,3 +187,87 @@ const (
 	GetBannerResponseStateUpcoming = GetBannerResponseState("upcoming")
 	GetBannerResponseStateStarted  = GetBannerResponseState("started")
 )
+
+type StreamRequest struct {
+	Topics string `query:"topics"`
+}
+
+type StreamMessage struct {
+	Topic       string      `json:"topic"`
+	BlockHeight int64       `json:"blockHeight"`
+	Data        interface{} `json:"data"`
+}
+
+type AdminAccount struct {
+	Address     string     `json:"address"`
+	Username    string     `json:"username"`
+	IsBlocked   bool       `json:"isBlocked"`
+	BlockedAt   *time.Time `json:"blockedAt,omitempty"`
+	BlockReason string     `json:"blockReason,omitempty"`
+}
+
+type GetBlockedAccountsResponse struct {
+	Accounts []AdminAccount `json:"accounts"`
+}
+
+type BlockAccountRequest struct {
+	Address string `param:"address"`
+	Reason  string `json:"reason"`
+}
+
+type RenameAccountRequest struct {
+	Address  string `param:"address"`
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+}
+
+type GetAuditLogsRequest struct {
+	Address  string `query:"address"`
+	BannerID string `query:"bannerId"`
+	Limit    int    `query:"limit"`
+}
+
+type GetAuditLogsResponse struct {
+	Logs []GetAuditLogsResponseLog `json:"logs"`
+}
+
+type GetAuditLogsResponseLog struct {
+	Actor       string    `json:"actor"`
+	Action      string    `json:"action"`
+	Address     string    `json:"address,omitempty"`
+	BannerID    string    `json:"bannerId,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	OldUsername string    `json:"oldUsername,omitempty"`
+	NewUsername string    `json:"newUsername,omitempty"`
+	Pending     bool      `json:"pending,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type AdminBanner struct {
+	ID           string    `json:"id"`
+	UpcomingText string    `json:"upcomingText"`
+	Text         string    `json:"text"`
+	URL          string    `json:"url"`
+	VisibleAt    time.Time `json:"visibleAt"`
+	StartsAt     time.Time `json:"startsAt"`
+	EndsAt       time.Time `json:"endsAt"`
+}
+
+type GetBannersResponse struct {
+	Banners []AdminBanner `json:"banners"`
+}
+
+type PutBannerRequest struct {
+	ID           string    `param:"id"`
+	UpcomingText string    `json:"upcomingText"`
+	Text         string    `json:"text"`
+	URL          string    `json:"url"`
+	VisibleAt    time.Time `json:"visibleAt"`
+	StartsAt     time.Time `json:"startsAt"`
+	EndsAt       time.Time `json:"endsAt"`
+	AllowOverlap bool      `json:"allowOverlap"`
+}
+
+type DeleteBannerRequest struct {
+	ID string `param:"id"`
+}
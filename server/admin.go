@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+	"github.com/b-harvest/gravity-dex-backend/service/store"
+)
+
+// adminActorKey is the context key of the name of the admin API key holder.
+const adminActorKey = "adminActor"
+
+// registerAdminRoutes registers the admin API, if any API key is configured.
+func (s *Server) registerAdminRoutes() {
+	if len(s.cfg.Admin.APIKeys) == 0 {
+		return
+	}
+	g := s.Group("/admin", middleware.KeyAuth(s.validateAdminKey))
+	g.GET("/accounts/blocked", s.GetBlockedAccounts)
+	g.POST("/accounts/:address/block", s.BlockAccount)
+	g.POST("/accounts/:address/unblock", s.UnblockAccount)
+	g.PUT("/accounts/:address/username", s.RenameAccount)
+	g.GET("/banners", s.GetBanners)
+	g.PUT("/banners/:id", s.PutBanner)
+	g.DELETE("/banners/:id", s.DeleteBanner)
+	g.GET("/auditlogs", s.GetAuditLogs)
+}
+
+func (s *Server) validateAdminKey(key string, c echo.Context) (bool, error) {
+	for name, k := range s.cfg.Admin.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			c.Set(adminActorKey, name)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Server) GetBlockedAccounts(c echo.Context) error {
+	accs, err := s.ss.BlockedAccounts(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("get blocked accounts: %w", err)
+	}
+	resp := schema.GetBlockedAccountsResponse{Accounts: []schema.AdminAccount{}}
+	for _, acc := range accs {
+		resp.Accounts = append(resp.Accounts, newAdminAccount(acc))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) BlockAccount(c echo.Context) error {
+	return s.setAccountBlocked(c, true)
+}
+
+func (s *Server) UnblockAccount(c echo.Context) error {
+	return s.setAccountBlocked(c, false)
+}
+
+func (s *Server) setAccountBlocked(c echo.Context, blocked bool) error {
+	var req schema.BlockAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "reason must be provided")
+	}
+	action := schema.AuditLogActionBlockAccount
+	if !blocked {
+		action = schema.AuditLogActionUnblockAccount
+	}
+	ctx := c.Request().Context()
+	if err := s.ss.WithAuditLog(ctx, schema.AuditLog{
+		Actor:     c.Get(adminActorKey).(string),
+		Action:    action,
+		Address:   req.Address,
+		Reason:    req.Reason,
+		CreatedAt: time.Now(),
+	}, func(*schema.AuditLog) error {
+		return s.ss.SetAccountBlocked(ctx, req.Address, blocked, req.Reason, time.Now())
+	}); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("set account blocked: %w", err)
+		}
+		if _, err := s.ss.AccountByAddress(ctx, req.Address); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return echo.NewHTTPError(http.StatusNotFound, "account not found")
+			}
+			return fmt.Errorf("get account: %w", err)
+		}
+		if blocked {
+			return echo.NewHTTPError(http.StatusConflict, "account is already blocked")
+		}
+		return echo.NewHTTPError(http.StatusConflict, "account is not blocked")
+	}
+	return s.respondAdminAccount(c, req.Address)
+}
+
+func (s *Server) RenameAccount(c echo.Context) error {
+	var req schema.RenameAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "username must be provided")
+	}
+	ctx := c.Request().Context()
+	acc, err := s.ss.AccountByUsername(ctx, req.Username)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("get account by username: %w", err)
+		}
+	} else if acc.Address != req.Address {
+		return echo.NewHTTPError(http.StatusConflict, "username is already taken")
+	}
+	if err := s.ss.WithAuditLog(ctx, schema.AuditLog{
+		Actor:       c.Get(adminActorKey).(string),
+		Action:      schema.AuditLogActionRenameAccount,
+		Address:     req.Address,
+		Reason:      strings.TrimSpace(req.Reason),
+		NewUsername: req.Username,
+		CreatedAt:   time.Now(),
+	}, func(log *schema.AuditLog) error {
+		oldUsername, err := s.ss.SetAccountUsername(ctx, req.Address, req.Username)
+		if err != nil {
+			return err
+		}
+		log.OldUsername = oldUsername
+		return nil
+	}); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return echo.NewHTTPError(http.StatusNotFound, "account not found")
+		}
+		// Another account may have taken the username since the check above.
+		if mongo.IsDuplicateKeyError(err) {
+			return echo.NewHTTPError(http.StatusConflict, "username is already taken")
+		}
+		return fmt.Errorf("set account username: %w", err)
+	}
+	return s.respondAdminAccount(c, req.Address)
+}
+
+// respondAdminAccount invalidates the caches affected by a change of the account,
+// then responds with the account.
+func (s *Server) respondAdminAccount(c echo.Context, address string) error {
+	ctx := c.Request().Context()
+	if err := s.InvalidateAccountCaches(ctx, address); err != nil {
+		// The change has been made anyway, and the caches will be updated eventually.
+		s.logger.Error("failed to invalidate caches", zap.String("address", address), zap.Error(err))
+	}
+	acc, err := s.ss.AccountByAddress(ctx, address)
+	if err != nil {
+		return fmt.Errorf("get account: %w", err)
+	}
+	return c.JSON(http.StatusOK, newAdminAccount(acc))
+}
+
+func (s *Server) GetAuditLogs(c echo.Context) error {
+	var req schema.GetAuditLogsRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if req.Limit <= 0 || req.Limit > s.cfg.Admin.AuditLogSize {
+		req.Limit = s.cfg.Admin.AuditLogSize
+	}
+	logs, err := s.ss.AuditLogs(c.Request().Context(), req.Address, req.BannerID, req.Limit)
+	if err != nil {
+		return fmt.Errorf("get audit logs: %w", err)
+	}
+	resp := schema.GetAuditLogsResponse{Logs: []schema.GetAuditLogsResponseLog{}}
+	for _, log := range logs {
+		resp.Logs = append(resp.Logs, schema.GetAuditLogsResponseLog{
+			Actor:       log.Actor,
+			Action:      string(log.Action),
+			Address:     log.Address,
+			BannerID:    log.BannerID,
+			Reason:      log.Reason,
+			OldUsername: log.OldUsername,
+			NewUsername: log.NewUsername,
+			Pending:     log.Pending,
+			CreatedAt:   log.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) GetBanners(c echo.Context) error {
+	bs, err := s.ss.Banners(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("get banners: %w", err)
+	}
+	resp := schema.GetBannersResponse{Banners: []schema.AdminBanner{}}
+	for _, b := range bs {
+		resp.Banners = append(resp.Banners, newAdminBanner(b))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// PutBanner creates or replaces the banner with the id.
+func (s *Server) PutBanner(c echo.Context) error {
+	var req schema.PutBannerRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	b := schema.Banner{
+		ID:           req.ID,
+		UpcomingText: req.UpcomingText,
+		Text:         req.Text,
+		URL:          req.URL,
+		VisibleAt:    req.VisibleAt,
+		StartsAt:     req.StartsAt,
+		EndsAt:       req.EndsAt,
+	}
+	if err := b.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ctx := c.Request().Context()
+	var created bool
+	if err := s.ss.WithAuditLog(ctx, schema.AuditLog{
+		Actor:     c.Get(adminActorKey).(string),
+		Action:    schema.AuditLogActionSaveBanner,
+		BannerID:  b.ID,
+		CreatedAt: time.Now(),
+	}, func(*schema.AuditLog) error {
+		var err error
+		created, err = s.ss.SaveBanner(ctx, b, req.AllowOverlap)
+		return err
+	}); err != nil {
+		var overlapErr *store.BannerOverlapError
+		if errors.As(err, &overlapErr) {
+			return echo.NewHTTPError(http.StatusConflict, overlapErr.Error())
+		}
+		return fmt.Errorf("save banner: %w", err)
+	}
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+	return c.JSON(code, newAdminBanner(b))
+}
+
+func (s *Server) DeleteBanner(c echo.Context) error {
+	var req schema.DeleteBannerRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	if err := s.ss.WithAuditLog(ctx, schema.AuditLog{
+		Actor:     c.Get(adminActorKey).(string),
+		Action:    schema.AuditLogActionDeleteBanner,
+		BannerID:  req.ID,
+		CreatedAt: time.Now(),
+	}, func(*schema.AuditLog) error {
+		return s.ss.DeleteBanner(ctx, req.ID)
+	}); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return echo.NewHTTPError(http.StatusNotFound, "banner not found")
+		}
+		return fmt.Errorf("delete banner: %w", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func newAdminBanner(b schema.Banner) schema.AdminBanner {
+	return schema.AdminBanner{
+		ID:           b.ID,
+		UpcomingText: b.UpcomingText,
+		Text:         b.Text,
+		URL:          b.URL,
+		VisibleAt:    b.VisibleAt,
+		StartsAt:     b.StartsAt,
+		EndsAt:       b.EndsAt,
+	}
+}
+
+func newAdminAccount(acc schema.Account) schema.AdminAccount {
+	return schema.AdminAccount{
+		Address:     acc.Address,
+		Username:    acc.Username,
+		IsBlocked:   acc.IsBlocked,
+		BlockedAt:   acc.BlockedAt,
+		BlockReason: acc.BlockReason,
+	}
+}
+
+// InvalidateAccountCaches deletes the account's cache, and makes the leader
+// rebuild the rest of the caches, e.g. the score board, right away.
+func (s *Server) InvalidateAccountCaches(ctx context.Context, address string) error {
+	c, err := s.rp.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("get redis conn: %w", err)
+	}
+	defer c.Close()
+	if _, err := c.Do("DEL", s.cfg.Redis.AccountCacheKeyPrefix+address); err != nil {
+		return fmt.Errorf("delete account cache: %w", err)
+	}
+	blockHeight, err := s.ss.LatestBlockHeight(ctx)
+	if err != nil {
+		return fmt.Errorf("get latest block height: %w", err)
+	}
+	b, err := jsonit.Marshal(schema.BlockHeightUpdate{BlockHeight: blockHeight, Invalidated: true})
+	if err != nil {
+		return fmt.Errorf("marshal update: %w", err)
+	}
+	if _, err := c.Do("PUBLISH", s.cfg.Redis.HeightChannel, b); err != nil {
+		return fmt.Errorf("publish update: %w", err)
+	}
+	return nil
+}
@@ -4,39 +4,109 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
 )
 
+// poolSnapshotPriceMaxAge is how old pool snapshots can be to be priced
+// with the current prices.
+const poolSnapshotPriceMaxAge = 5 * time.Minute
+
+// RunBackgroundUpdater updates the caches as soon as the transformer
+// notifies a new block height, or every CacheUpdateInterval as a fallback.
 func (s *Server) RunBackgroundUpdater(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.runSubscriber(ctx, s.cfg.Redis.HeightChannel, func(update schema.BlockHeightUpdate) {
+		if update.Invalidated {
+			atomic.StoreInt32(&s.cachesInvalidated, 1)
+		}
+		s.notifyCacheUpdate()
+	})
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
-		s.logger.Debug("updating caches")
-		if err := s.UpdateCaches(ctx); err != nil {
-			if errors.Is(err, context.Canceled) {
-				return err
+		// Only the leader updates the caches, while the others serve reads.
+		if s.IsLeader() {
+			if err := s.UpdateCachesIfNeeded(ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				if errors.Is(err, errNotLeader) {
+					s.logger.Info("lost leadership while updating caches")
+				} else {
+					s.logger.Error("failed to update caches", zap.Error(err))
+				}
 			}
-			s.logger.Error("failed to update caches", zap.Error(err))
 		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-s.cacheUpdateNotified:
 		case <-time.After(s.cfg.CacheUpdateInterval):
 		}
 	}
 }
 
-func (s *Server) UpdateCaches(ctx context.Context) error {
-	blockHeight, err := s.ss.LatestBlockHeight(ctx)
+// notifyCacheUpdate wakes up the background updater without waiting for
+// CacheUpdateInterval.
+func (s *Server) notifyCacheUpdate() {
+	select {
+	case s.cacheUpdateNotified <- struct{}{}:
+	default:
+	}
+}
+
+// UpdateCachesIfNeeded updates the caches if the latest block height has changed,
+// if the caches have been invalidated, or if the caches are older than
+// CacheRefreshInterval, since prices change even without new blocks.
+// The caches are not updated while the transformer replays the blocks rolled
+// back, since balances and pools are still ahead of the other state.
+func (s *Server) UpdateCachesIfNeeded(ctx context.Context) error {
+	cp, err := s.ss.Checkpoint(ctx)
 	if err != nil {
-		return fmt.Errorf("get latest block height: %w", err)
+		return fmt.Errorf("get checkpoint: %w", err)
+	}
+	blockHeight := cp.BlockHeight
+	if cp.Replaying() {
+		s.logger.Info("skipping cache update while replaying blocks after a rollback",
+			zap.Int64("height", blockHeight), zap.Int64("rolledBackFrom", cp.RolledBackFrom))
+		return nil
+	}
+	invalidated := atomic.SwapInt32(&s.cachesInvalidated, 0) == 1
+	if s.cachesUpToDate(blockHeight, invalidated, time.Now()) {
+		s.logger.Debug("skipping cache update", zap.Int64("height", blockHeight))
+		return nil
+	}
+	s.logger.Debug("updating caches", zap.Int64("height", blockHeight), zap.Bool("invalidated", invalidated))
+	if err := observeCacheUpdate("all", func() error {
+		return s.UpdateCaches(ctx, blockHeight)
+	}); err != nil {
+		if invalidated {
+			atomic.StoreInt32(&s.cachesInvalidated, 1)
+		}
+		return err
 	}
+	cacheBlockHeight.Set(float64(blockHeight))
+	s.lastUpdatedBlockHeight = blockHeight
+	s.lastUpdatedAt = time.Now()
+	return nil
+}
+
+// cachesUpToDate reports whether the caches updated last can be kept at the time.
+func (s *Server) cachesUpToDate(blockHeight int64, invalidated bool, now time.Time) bool {
+	return !invalidated && blockHeight == s.lastUpdatedBlockHeight && now.Sub(s.lastUpdatedAt) < s.cfg.CacheRefreshInterval
+}
+
+func (s *Server) UpdateCaches(ctx context.Context, blockHeight int64) error {
 	pools, err := s.ss.Pools(ctx, blockHeight)
 	if err != nil {
 		return fmt.Errorf("get pools: %w", err)
@@ -45,24 +115,55 @@ func (s *Server) UpdateCaches(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("get price table: %w", err)
 	}
+	// Only recent snapshots are priced, since the prices are those of now.
+	if _, err := s.ss.SetPoolSnapshotPrices(ctx, time.Now().Add(-poolSnapshotPriceMaxAge), t); err != nil {
+		return fmt.Errorf("set pool snapshot prices: %w", err)
+	}
 	eg, ctx2 := errgroup.WithContext(ctx)
 	eg.Go(func() error {
-		if err := s.UpdateAccountsCache(ctx2, blockHeight, t); err != nil {
+		if err := observeCacheUpdate("accounts", func() error {
+			return s.UpdateAccountsCache(ctx2, blockHeight, t)
+		}); err != nil {
 			return fmt.Errorf("update accounts cache: %w", err)
 		}
 		return nil
 	})
 	eg.Go(func() error {
-		if err := s.UpdatePoolsCache(ctx2, blockHeight, pools, t); err != nil {
+		if err := observeCacheUpdate("pools", func() error {
+			return s.UpdatePoolsCache(ctx2, blockHeight, pools, t)
+		}); err != nil {
 			return fmt.Errorf("update pools cache: %w", err)
 		}
 		return nil
 	})
 	eg.Go(func() error {
-		if err := s.UpdatePricesCache(ctx2, blockHeight, t); err != nil {
+		if err := observeCacheUpdate("prices", func() error {
+			return s.UpdatePricesCache(ctx2, blockHeight, t)
+		}); err != nil {
 			return fmt.Errorf("update prices cache: %w", err)
 		}
 		return nil
 	})
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	// Compared by inequality, so that the caches of a rolled back state are published too.
+	if blockHeight != s.lastPublishedBlockHeight {
+		if err := s.PublishCacheUpdate(ctx, blockHeight); err != nil {
+			return fmt.Errorf("publish cache update: %w", err)
+		}
+		s.lastPublishedBlockHeight = blockHeight
+	}
+	return nil
+}
+
+// observeCacheUpdate records the duration and the failure of a cache update.
+func observeCacheUpdate(cache string, fn func() error) error {
+	started := time.Now()
+	err := fn()
+	cacheUpdateDuration.WithLabelValues(cache).Observe(time.Since(started).Seconds())
+	if err != nil {
+		cacheUpdateFailures.WithLabelValues(cache).Inc()
+	}
+	return err
 }
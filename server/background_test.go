@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+)
+
+func TestServer_CachesUpToDate(t *testing.T) {
+	cfg := config.DefaultServerConfig
+	cfg.CacheRefreshInterval = time.Minute
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	s := &Server{cfg: cfg, lastUpdatedBlockHeight: 100, lastUpdatedAt: t0}
+	for _, tc := range []struct {
+		name        string
+		blockHeight int64
+		invalidated bool
+		now         time.Time
+		upToDate    bool
+	}{
+		{"same block height", 100, false, t0.Add(30 * time.Second), true},
+		{"new block height", 101, false, t0.Add(30 * time.Second), false},
+		{"invalidated", 100, true, t0.Add(30 * time.Second), false},
+		{"refresh interval elapsed", 100, false, t0.Add(time.Minute), false},
+		{"rolled back", 99, false, t0.Add(30 * time.Second), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.upToDate, s.cachesUpToDate(tc.blockHeight, tc.invalidated, tc.now))
+		})
+	}
+
+	// Caches have never been updated.
+	s = &Server{cfg: cfg}
+	require.False(t, s.cachesUpToDate(100, false, t0))
+}
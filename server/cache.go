@@ -17,6 +17,8 @@ import (
 
 var jsonit = jsoniter.ConfigCompatibleWithStandardLibrary
 
+const scoreBoardPushBatchSize = 1000
+
 func (s *Server) UpdateAccountsCache(ctx context.Context, blockHeight int64, priceTable price.Table) error {
 	accs, err := s.scs.Scoreboard(ctx, blockHeight, priceTable)
 	if err != nil {
@@ -41,6 +43,10 @@ func (s *Server) UpdateAccountsCache(ctx context.Context, blockHeight int64, pri
 				NumDifferentPools:       acc.SwapStatus.NumDifferentPools,
 				NumDifferentPoolsByDate: acc.SwapStatus.NumDifferentPoolsByDate,
 			},
+			WithdrawStatus: schema.AccountCacheActionStatus{
+				NumDifferentPools:       acc.WithdrawStatus.NumDifferentPools,
+				NumDifferentPoolsByDate: acc.WithdrawStatus.NumDifferentPoolsByDate,
+			},
 			UpdatedAt: acc.UpdatedAt,
 		}
 		if err := s.SaveAccountCache(ctx, acc.Address, accCache); err != nil {
@@ -48,12 +54,19 @@ func (s *Server) UpdateAccountsCache(ctx context.Context, blockHeight int64, pri
 		}
 		accCaches = append(accCaches, accCache)
 	}
+	numValid := 0
+	for _, accCache := range accCaches {
+		if accCache.IsValid {
+			numValid++
+		}
+	}
 	sbCache := schema.ScoreBoardCache{
-		BlockHeight: blockHeight,
-		Accounts:    accCaches[:util.MinInt(s.cfg.ScoreBoardSize, len(accCaches))],
-		UpdatedAt:   time.Now(),
+		BlockHeight:      blockHeight,
+		NumAccounts:      len(accCaches),
+		NumValidAccounts: numValid,
+		UpdatedAt:        time.Now(),
 	}
-	if err := s.SaveScoreBoardCache(ctx, sbCache); err != nil {
+	if err := s.SaveScoreBoardCache(ctx, sbCache, accCaches); err != nil {
 		return fmt.Errorf("save cache: %w", err)
 	}
 	return nil
@@ -66,7 +79,7 @@ func (s *Server) UpdatePoolsCache(ctx context.Context, blockHeight int64, pools
 	}
 	tvl := 0.0
 	for _, p := range pools {
-		if p.PoolCoinAmount() == 0 {
+		if p.PoolCoinAmount().IsZero() {
 			continue
 		}
 		var reserveCoins []schema.PoolsCacheCoin
@@ -80,9 +93,9 @@ func (s *Server) UpdatePoolsCache(ctx context.Context, blockHeight int64, pools
 		cs := p.SwapFeeVolumes().TotalCoins()
 		feeValue := 0.0
 		for denom, amount := range cs {
-			feeValue += float64(amount) * priceTable[denom]
+			feeValue += amount.Float64() * priceTable[denom]
 		}
-		poolValue := priceTable[p.PoolCoinDenom] * float64(p.PoolCoinAmount())
+		poolValue := priceTable[p.PoolCoinDenom] * p.PoolCoinAmount().Float64()
 		cache.Pools = append(cache.Pools, schema.PoolsCachePool{
 			ID:           p.ID,
 			ReserveCoins: reserveCoins,
@@ -153,8 +166,86 @@ func (s *Server) SaveAccountCache(ctx context.Context, address string, cache sch
 	return s.SaveCache(ctx, s.cfg.Redis.AccountCacheKeyPrefix+address, cache)
 }
 
-func (s *Server) SaveScoreBoardCache(ctx context.Context, cache schema.ScoreBoardCache) error {
-	return s.SaveCache(ctx, s.cfg.Redis.ScoreBoardCacheKey, cache)
+// errNotLeader is returned when a cache is not saved since this server
+// does not hold the leader lease.
+var errNotLeader = errors.New("not the leader")
+
+// SaveScoreBoardCache replaces the score board metadata and accounts atomically,
+// only if this server still holds the leader lease, so that a server which has
+// just lost the lease does not overwrite the caches of the new leader.
+// accs must be sorted by ranking.
+func (s *Server) SaveScoreBoardCache(ctx context.Context, cache schema.ScoreBoardCache, accs []schema.AccountCache) error {
+	c, err := s.rp.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("get redis conn: %w", err)
+	}
+	defer c.Close()
+	b, err := jsonit.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("marshal cache: %w", err)
+	}
+	// Each write has its own temporary list, which expires in case the server
+	// dies before renaming it.
+	tmpKey := fmt.Sprintf("%s:tmp:%s:%d", s.cfg.Redis.ScoreBoardAccountsKey, s.instanceID, cache.BlockHeight)
+	if _, err := c.Do("DEL", tmpKey); err != nil {
+		return fmt.Errorf("delete temporary accounts: %w", err)
+	}
+	defer c.Do("DEL", tmpKey)
+	for i := 0; i < len(accs); i += scoreBoardPushBatchSize {
+		args := redis.Args{tmpKey}
+		for _, acc := range accs[i:util.MinInt(i+scoreBoardPushBatchSize, len(accs))] {
+			b, err := jsonit.Marshal(acc)
+			if err != nil {
+				return fmt.Errorf("marshal account cache: %w", err)
+			}
+			args = args.Add(b)
+		}
+		if _, err := c.Do("RPUSH", args...); err != nil {
+			return fmt.Errorf("push accounts: %w", err)
+		}
+	}
+	if len(accs) > 0 {
+		if _, err := c.Do("PEXPIRE", tmpKey, s.cfg.LeaderLeaseTTL.Milliseconds()); err != nil {
+			return fmt.Errorf("expire temporary accounts: %w", err)
+		}
+	}
+	// The transaction fails if the leader lease changes after it is checked.
+	if _, err := c.Do("WATCH", s.cfg.Redis.LeaderKey); err != nil {
+		return fmt.Errorf("watch leader key: %w", err)
+	}
+	leader, err := redis.String(c.Do("GET", s.cfg.Redis.LeaderKey))
+	if err != nil && !errors.Is(err, redis.ErrNil) {
+		c.Do("UNWATCH")
+		return fmt.Errorf("get leader: %w", err)
+	}
+	if leader != s.instanceID {
+		c.Do("UNWATCH")
+		return errNotLeader
+	}
+	if err := c.Send("MULTI"); err != nil {
+		return err
+	}
+	if err := c.Send("SET", s.cfg.Redis.ScoreBoardCacheKey, b); err != nil {
+		return err
+	}
+	if len(accs) > 0 {
+		if err := c.Send("RENAME", tmpKey, s.cfg.Redis.ScoreBoardAccountsKey); err != nil {
+			return err
+		}
+		err = c.Send("PERSIST", s.cfg.Redis.ScoreBoardAccountsKey)
+	} else {
+		err = c.Send("DEL", s.cfg.Redis.ScoreBoardAccountsKey)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := redis.Values(c.Do("EXEC")); err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return errNotLeader
+		}
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
 }
 
 func (s *Server) SavePoolsCache(ctx context.Context, cache schema.PoolsCache) error {
@@ -175,6 +266,29 @@ func (s *Server) LoadScoreBoardCache(ctx context.Context) (cache schema.ScoreBoa
 	return
 }
 
+// LoadScoreBoardAccounts loads the accounts in [start, end) of the ranking.
+func (s *Server) LoadScoreBoardAccounts(ctx context.Context, start, end int) ([]schema.AccountCache, error) {
+	if start >= end {
+		return nil, nil
+	}
+	c, err := s.rp.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get redis conn: %w", err)
+	}
+	defer c.Close()
+	bs, err := redis.ByteSlices(c.Do("LRANGE", s.cfg.Redis.ScoreBoardAccountsKey, start, end-1))
+	if err != nil {
+		return nil, fmt.Errorf("get accounts: %w", err)
+	}
+	accs := make([]schema.AccountCache, len(bs))
+	for i, b := range bs {
+		if err := jsonit.Unmarshal(b, &accs[i]); err != nil {
+			return nil, fmt.Errorf("unmarshal account cache: %w", err)
+		}
+	}
+	return accs, nil
+}
+
 func (s *Server) LoadPoolsCache(ctx context.Context) (cache schema.PoolsCache, err error) {
 	err = s.LoadCache(ctx, s.cfg.Redis.PoolsCacheKey, &cache)
 	return
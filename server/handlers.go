@@ -12,17 +12,27 @@ import (
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/mongo"
 
+	"github.com/b-harvest/gravity-dex-backend/metrics"
 	"github.com/b-harvest/gravity-dex-backend/schema"
+	"github.com/b-harvest/gravity-dex-backend/util"
 )
 
 func (s *Server) registerRoutes() {
 	s.GET("/status", s.GetStatus)
+	s.GET("/healthz", s.GetHealth)
+	s.GET("/readyz", s.GetReadiness)
+	s.GET("/metrics", metrics.EchoHandler())
 	s.GET("/scoreboard", s.GetScoreBoard)
 	s.GET("/scoreboard/search", s.SearchAccount)
 	s.GET("/actions", s.GetActionStatus)
+	s.GET("/accounts/:address/history", s.GetAccountHistory)
 	s.GET("/pools", s.GetPools)
+	s.GET("/pools/:id/history", s.GetPoolHistory)
+	s.GET("/pools/:id/candles", s.GetPoolCandles)
 	s.GET("/prices", s.GetPrices)
 	s.GET("/banner", s.GetBanner)
+	s.GET("/stream", s.Stream)
+	s.registerAdminRoutes()
 }
 
 func (s *Server) GetStatus(c echo.Context) error {
@@ -30,8 +40,15 @@ func (s *Server) GetStatus(c echo.Context) error {
 	if err != nil {
 		return fmt.Errorf("get latest block height: %w", err)
 	}
+	leader, err := s.Leader(c.Request().Context())
+	if err != nil {
+		return fmt.Errorf("get leader: %w", err)
+	}
 	return c.JSON(http.StatusOK, schema.GetStatusResponse{
 		LatestBlockHeight: blockHeight,
+		InstanceID:        s.instanceID,
+		Leader:            leader,
+		IsLeader:          s.IsLeader(),
 	})
 }
 
@@ -40,6 +57,18 @@ func (s *Server) GetScoreBoard(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return err
 	}
+	if req.Offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "offset must not be negative")
+	}
+	if req.Around != "" && req.Offset > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "around and offset cannot be used together")
+	}
+	if req.Limit <= 0 || req.Limit > s.cfg.ScoreBoardSize {
+		req.Limit = s.cfg.ScoreBoardSize
+	}
+	if req.Radius <= 0 || req.Radius > s.cfg.ScoreBoardMaxRadius {
+		req.Radius = s.cfg.ScoreBoardMaxRadius
+	}
 	var sbCache schema.ScoreBoardCache
 	if err := RetryLoadingCache(c.Request().Context(), func(ctx context.Context) error {
 		var err error
@@ -51,21 +80,39 @@ func (s *Server) GetScoreBoard(c echo.Context) error {
 		}
 		return fmt.Errorf("load score board cache: %w", err)
 	}
+	lo, hi, ok := scoreBoardRange(sbCache, req.Valid)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "valid must be either true or false")
+	}
+	var start, end int
+	if req.Around != "" {
+		accCache, err := s.LoadAccountCache(c.Request().Context(), req.Around)
+		if err != nil {
+			if errors.Is(err, redis.ErrNil) {
+				return echo.NewHTTPError(http.StatusNotFound, "account not found")
+			}
+			return fmt.Errorf("load account cache: %w", err)
+		}
+		start, end, ok = aroundRange(lo, hi, accCache.Ranking-1, req.Radius)
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "account not found")
+		}
+	} else {
+		start, end = pageRange(lo, hi, req.Offset, req.Limit)
+	}
+	accCaches, err := s.LoadScoreBoardAccounts(c.Request().Context(), start, end)
+	if err != nil {
+		return fmt.Errorf("load score board accounts: %w", err)
+	}
 	resp := schema.GetScoreBoardResponse{
 		BlockHeight: sbCache.BlockHeight,
 		Accounts:    []schema.GetScoreBoardResponseAccount{},
+		Offset:      start - lo,
+		Total:       hi - lo,
 		UpdatedAt:   sbCache.UpdatedAt,
 	}
-	for _, acc := range sbCache.Accounts {
-		resp.Accounts = append(resp.Accounts, schema.GetScoreBoardResponseAccount{
-			Ranking:      acc.Ranking,
-			Username:     acc.Username,
-			Address:      acc.Address,
-			TotalScore:   acc.TotalScore,
-			TradingScore: acc.TradingScore,
-			ActionScore:  acc.ActionScore,
-			IsValid:      acc.IsValid,
-		})
+	for _, acc := range accCaches {
+		resp.Accounts = append(resp.Accounts, newScoreBoardResponseAccount(acc))
 	}
 	if req.Address != "" {
 		accCache, err := s.LoadAccountCache(c.Request().Context(), req.Address)
@@ -74,20 +121,45 @@ func (s *Server) GetScoreBoard(c echo.Context) error {
 				return fmt.Errorf("load account cache: %w", err)
 			}
 		} else {
-			resp.Me = &schema.GetScoreBoardResponseAccount{
-				Ranking:      accCache.Ranking,
-				Username:     accCache.Username,
-				Address:      accCache.Address,
-				TotalScore:   accCache.TotalScore,
-				TradingScore: accCache.TradingScore,
-				ActionScore:  accCache.ActionScore,
-				IsValid:      accCache.IsValid,
-			}
+			me := newScoreBoardResponseAccount(accCache)
+			resp.Me = &me
 		}
 	}
 	return c.JSON(http.StatusOK, resp)
 }
 
+// scoreBoardRange returns the range of indexes in the score board of the accounts
+// matching the valid filter, which is either empty, "true" or "false".
+// Valid accounts come first in the ranking, so each filter is a contiguous range.
+func scoreBoardRange(sbCache schema.ScoreBoardCache, valid string) (lo, hi int, ok bool) {
+	switch valid {
+	case "":
+		return 0, sbCache.NumAccounts, true
+	case "true":
+		return 0, sbCache.NumValidAccounts, true
+	case "false":
+		return sbCache.NumValidAccounts, sbCache.NumAccounts, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// pageRange returns the range of the page at the offset from lo, within [lo, hi).
+func pageRange(lo, hi, offset, limit int) (start, end int) {
+	start = util.MinInt(lo+offset, hi)
+	end = util.MinInt(start+limit, hi)
+	return
+}
+
+// aroundRange returns the range of the accounts within radius from the index i,
+// within [lo, hi). It returns false if i is out of [lo, hi).
+func aroundRange(lo, hi, i, radius int) (start, end int, ok bool) {
+	if i < lo || i >= hi {
+		return 0, 0, false
+	}
+	return util.MaxInt(lo, i-radius), util.MinInt(hi, i+radius+1), true
+}
+
 func (s *Server) SearchAccount(c echo.Context) error {
 	var req schema.SearchAccountRequest
 	if err := c.Bind(&req); err != nil {
@@ -119,19 +191,28 @@ func (s *Server) SearchAccount(c echo.Context) error {
 		}
 		return fmt.Errorf("load account cache: %w", err)
 	}
-	return c.JSON(http.StatusOK, schema.SearchAccountResponse{
-		BlockHeight: accCache.BlockHeight,
-		Account: &schema.GetScoreBoardResponseAccount{
-			Ranking:      accCache.Ranking,
-			Username:     accCache.Username,
-			Address:      accCache.Address,
-			TotalScore:   accCache.TotalScore,
-			TradingScore: accCache.TradingScore,
-			ActionScore:  accCache.ActionScore,
-			IsValid:      accCache.IsValid,
-		},
-		UpdatedAt: accCache.UpdatedAt,
-	})
+	return c.JSON(http.StatusOK, newSearchAccountResponse(accCache))
+}
+
+func newScoreBoardResponseAccount(acc schema.AccountCache) schema.GetScoreBoardResponseAccount {
+	return schema.GetScoreBoardResponseAccount{
+		Ranking:      acc.Ranking,
+		Username:     acc.Username,
+		Address:      acc.Address,
+		TotalScore:   acc.TotalScore,
+		TradingScore: acc.TradingScore,
+		ActionScore:  acc.ActionScore,
+		IsValid:      acc.IsValid,
+	}
+}
+
+func newSearchAccountResponse(acc schema.AccountCache) schema.SearchAccountResponse {
+	respAcc := newScoreBoardResponseAccount(acc)
+	return schema.SearchAccountResponse{
+		BlockHeight: acc.BlockHeight,
+		Account:     &respAcc,
+		UpdatedAt:   acc.UpdatedAt,
+	}
 }
 
 func (s *Server) GetActionStatus(c echo.Context) error {
@@ -163,11 +244,65 @@ func (s *Server) GetActionStatus(c echo.Context) error {
 				NumDifferentPoolsToday:    accCache.SwapStatus.NumDifferentPoolsByDate[todayKey],
 				MaxNumDifferentPoolsToday: s.cfg.Score.MaxActionScorePerDay,
 			},
+			Withdraw: schema.GetActionStatusResponseStatus{
+				NumDifferentPools:         accCache.WithdrawStatus.NumDifferentPools,
+				NumDifferentPoolsToday:    accCache.WithdrawStatus.NumDifferentPoolsByDate[todayKey],
+				MaxNumDifferentPoolsToday: s.cfg.Score.MaxActionScorePerDay,
+			},
 		},
 		UpdatedAt: accCache.UpdatedAt,
 	})
 }
 
+func (s *Server) GetAccountHistory(c echo.Context) error {
+	var req schema.GetAccountHistoryRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	typ := schema.AccountEventType(req.Type)
+	if typ != "" && !typ.IsValid() {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid event type")
+	}
+	if req.Limit <= 0 || req.Limit > s.cfg.AccountHistorySize {
+		req.Limit = s.cfg.AccountHistorySize
+	}
+	events, hasMore, err := s.ss.AccountEvents(c.Request().Context(), req.Address, typ, req.PoolID, req.Cursor, req.Limit)
+	if err != nil {
+		return fmt.Errorf("get account events: %w", err)
+	}
+	resp := schema.GetAccountHistoryResponse{
+		Address: req.Address,
+		Events:  []schema.GetAccountHistoryResponseEvent{},
+	}
+	for _, evt := range events {
+		resp.Events = append(resp.Events, schema.GetAccountHistoryResponseEvent{
+			BlockHeight: evt.BlockHeight,
+			Timestamp:   evt.Timestamp,
+			Type:        string(evt.Type),
+			PoolID:      evt.PoolID,
+			Coins:       accountHistoryResponseCoins(evt.Coins),
+			SwapPrice:   evt.SwapPrice,
+			Fees:        accountHistoryResponseCoins(evt.Fees),
+		})
+	}
+	if hasMore && len(events) > 0 {
+		cursor := events[len(events)-1].BlockHeight
+		resp.NextCursor = &cursor
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func accountHistoryResponseCoins(coins []schema.Coin) []schema.GetAccountHistoryResponseCoin {
+	var res []schema.GetAccountHistoryResponseCoin
+	for _, c := range coins {
+		res = append(res, schema.GetAccountHistoryResponseCoin{
+			Denom:  c.Denom,
+			Amount: c.Amount,
+		})
+	}
+	return res
+}
+
 func (s *Server) GetPools(c echo.Context) error {
 	var cache schema.PoolsCache
 	if err := RetryLoadingCache(c.Request().Context(), func(ctx context.Context) error {
@@ -183,6 +318,152 @@ func (s *Server) GetPools(c echo.Context) error {
 	return c.JSON(http.StatusOK, schema.GetPoolsResponse(cache))
 }
 
+func (s *Server) GetPoolHistory(c echo.Context) error {
+	var req schema.GetPoolHistoryRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	to := time.Now()
+	if req.To > 0 {
+		to = time.Unix(req.To, 0)
+	}
+	from := to.Add(-24 * time.Hour)
+	if req.From > 0 {
+		from = time.Unix(req.From, 0)
+	}
+	if !from.Before(to) {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+	interval := time.Hour
+	if req.Interval != "" {
+		var err error
+		interval, err = util.ParseDuration(req.Interval)
+		if err != nil || interval < time.Minute {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid interval")
+		}
+	}
+	if to.Sub(from)/interval > time.Duration(s.cfg.PoolHistoryMaxSize) {
+		return echo.NewHTTPError(http.StatusBadRequest, "too many data points")
+	}
+	snapshots, err := s.ss.PoolSnapshots(c.Request().Context(), req.ID, from.UTC(), to.UTC())
+	if err != nil {
+		return fmt.Errorf("get pool snapshots: %w", err)
+	}
+	return c.JSON(http.StatusOK, schema.GetPoolHistoryResponse{
+		ID:     req.ID,
+		Points: poolHistoryPoints(snapshots, from, interval),
+	})
+}
+
+// poolHistoryPoints groups the snapshots by interval and takes the last snapshot
+// of each group. Snapshots before from are only used to calculate swap volumes.
+// Values in USD are calculated with the prices of the last snapshot, if it has any.
+func poolHistoryPoints(snapshots []schema.PoolSnapshot, from time.Time, interval time.Duration) []schema.GetPoolHistoryResponsePoint {
+	points := []schema.GetPoolHistoryResponsePoint{}
+	var prev *schema.PoolSnapshot
+	i := 0
+	if len(snapshots) > 0 && snapshots[0].Timestamp.Before(from) {
+		prev = &snapshots[0]
+		i = 1
+	}
+	for i < len(snapshots) {
+		bucket := from.Add(snapshots[i].Timestamp.Sub(from) / interval * interval)
+		if prev == nil {
+			prev = &snapshots[i]
+		}
+		j := i
+		for j+1 < len(snapshots) && snapshots[j+1].Timestamp.Before(bucket.Add(interval)) {
+			j++
+		}
+		last := snapshots[j]
+		priceTable := last.Prices
+		var reserveCoins []schema.PoolsCacheCoin
+		tvl := 0.0
+		for _, rc := range last.ReserveCoins {
+			reserveCoins = append(reserveCoins, schema.PoolsCacheCoin{
+				Denom:       rc.Denom,
+				Amount:      rc.Amount,
+				GlobalPrice: priceTable[rc.Denom],
+			})
+			tvl += rc.Amount.Float64() * priceTable[rc.Denom]
+		}
+		volume := 0.0
+		for denom, amount := range last.SwapVolume.Sub(prev.SwapVolume) {
+			volume += amount.Float64() * priceTable[denom]
+		}
+		volume /= 2 // both offer and demand coins are accumulated
+		point := schema.GetPoolHistoryResponsePoint{
+			Timestamp:    bucket.UTC(),
+			BlockHeight:  last.BlockHeight,
+			ReserveCoins: reserveCoins,
+			PoolCoin: schema.PoolsCacheCoin{
+				Denom:       last.PoolCoin.Denom,
+				Amount:      last.PoolCoin.Amount,
+				GlobalPrice: priceTable[last.PoolCoin.Denom],
+			},
+			Price: last.Price,
+		}
+		if priceTable != nil {
+			point.TotalValueLocked = &tvl
+			point.SwapVolume = &volume
+		}
+		points = append(points, point)
+		prev = &snapshots[j]
+		i = j + 1
+	}
+	return points
+}
+
+func (s *Server) GetPoolCandles(c echo.Context) error {
+	var req schema.GetPoolCandlesRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if req.Resolution == "" {
+		req.Resolution = "1h"
+	}
+	resolution, err := util.ParseDuration(req.Resolution)
+	if err != nil || !util.DurationInSlice(resolution, s.cfg.CandleResolutions) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid resolution")
+	}
+	to := time.Now()
+	if req.To > 0 {
+		to = time.Unix(req.To, 0)
+	}
+	from := to.Add(-time.Duration(s.cfg.PoolHistoryMaxSize) * resolution)
+	if req.From > 0 {
+		from = time.Unix(req.From, 0)
+	}
+	if !from.Before(to) {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+	if to.Sub(from)/resolution > time.Duration(s.cfg.PoolHistoryMaxSize) {
+		return echo.NewHTTPError(http.StatusBadRequest, "too many data points")
+	}
+	candles, err := s.ss.PoolCandles(c.Request().Context(), req.ID, resolution, from.UTC(), to.UTC())
+	if err != nil {
+		return fmt.Errorf("get pool candles: %w", err)
+	}
+	resp := schema.GetPoolCandlesResponse{
+		ID:         req.ID,
+		Resolution: req.Resolution,
+		Candles:    []schema.GetPoolCandlesResponseCandle{},
+	}
+	for _, c := range candles {
+		resp.Candles = append(resp.Candles, schema.GetPoolCandlesResponseCandle{
+			Timestamp: c.Timestamp.UTC(),
+			Open:      c.Open,
+			High:      c.High,
+			Low:       c.Low,
+			Close:     c.Close,
+			VolumeX:   c.VolumeX,
+			VolumeY:   c.VolumeY,
+			NumSwaps:  c.NumSwaps,
+		})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
 func (s *Server) GetPrices(c echo.Context) error {
 	var cache schema.PricesCache
 	if err := RetryLoadingCache(c.Request().Context(), func(ctx context.Context) error {
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+)
+
+func TestPoolHistoryPoints(t *testing.T) {
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	newSnapshot := func(blockHeight int64, offset time.Duration, volume int64, prices map[string]float64) schema.PoolSnapshot {
+		return schema.PoolSnapshot{
+			BlockHeight: blockHeight,
+			Timestamp:   t0.Add(offset),
+			ReserveCoins: []schema.Coin{
+				{Denom: "uatom", Amount: schema.NewInt(100)},
+				{Denom: "uusd", Amount: schema.NewInt(1000)},
+			},
+			PoolCoin:   schema.Coin{Denom: "pool1", Amount: schema.NewInt(10)},
+			SwapVolume: schema.CoinMap{"uatom": schema.NewInt(volume), "uusd": schema.NewInt(volume * 10)},
+			Prices:     prices,
+		}
+	}
+	snapshots := []schema.PoolSnapshot{
+		newSnapshot(1, -time.Minute, 0, nil), // before from
+		newSnapshot(2, 10*time.Minute, 10, map[string]float64{"uatom": 20, "uusd": 1}),
+		newSnapshot(3, 50*time.Minute, 20, map[string]float64{"uatom": 10, "uusd": 1}),
+		newSnapshot(4, 70*time.Minute, 30, nil),
+	}
+	points := poolHistoryPoints(snapshots, t0, time.Hour)
+	require.Len(t, points, 2)
+
+	// The first point takes the last snapshot of the interval, valued with its own prices.
+	require.Equal(t, t0, points[0].Timestamp)
+	require.EqualValues(t, 3, points[0].BlockHeight)
+	require.Equal(t, 10.0, points[0].ReserveCoins[0].GlobalPrice)
+	require.NotNil(t, points[0].TotalValueLocked)
+	require.InDelta(t, 100*10+1000*1, *points[0].TotalValueLocked, 1e-9)
+	require.NotNil(t, points[0].SwapVolume)
+	require.InDelta(t, (20*10+200*1)/2, *points[0].SwapVolume, 1e-9)
+
+	// A snapshot without prices has no values in USD.
+	require.Equal(t, t0.Add(time.Hour), points[1].Timestamp)
+	require.EqualValues(t, 4, points[1].BlockHeight)
+	require.Nil(t, points[1].TotalValueLocked)
+	require.Nil(t, points[1].SwapVolume)
+}
+
+func TestScoreBoardRange(t *testing.T) {
+	sbCache := schema.ScoreBoardCache{NumAccounts: 10, NumValidAccounts: 7}
+	for _, tc := range []struct {
+		valid  string
+		lo, hi int
+		ok     bool
+	}{
+		{"", 0, 10, true},
+		{"true", 0, 7, true},
+		{"false", 7, 10, true},
+		{"yes", 0, 0, false},
+	} {
+		lo, hi, ok := scoreBoardRange(sbCache, tc.valid)
+		require.Equal(t, tc.ok, ok, tc.valid)
+		require.Equal(t, tc.lo, lo, tc.valid)
+		require.Equal(t, tc.hi, hi, tc.valid)
+	}
+}
+
+func TestPageRange(t *testing.T) {
+	for _, tc := range []struct {
+		name                  string
+		lo, hi, offset, limit int
+		start, end            int
+	}{
+		{"first page", 0, 10, 0, 3, 0, 3},
+		{"middle page", 0, 10, 3, 3, 3, 6},
+		{"last partial page", 0, 10, 9, 3, 9, 10},
+		{"offset past the end", 0, 10, 20, 3, 10, 10},
+		{"offset from lo", 7, 10, 1, 5, 8, 10},
+		{"empty range", 7, 7, 0, 5, 7, 7},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start, end := pageRange(tc.lo, tc.hi, tc.offset, tc.limit)
+			require.Equal(t, tc.start, start)
+			require.Equal(t, tc.end, end)
+		})
+	}
+}
+
+func TestAroundRange(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		lo, hi, i, radius int
+		start, end        int
+		ok                bool
+	}{
+		{"middle", 0, 10, 5, 2, 3, 8, true},
+		{"near the top", 0, 10, 1, 2, 0, 4, true},
+		{"near the bottom", 0, 10, 9, 2, 7, 10, true},
+		{"zero radius", 0, 10, 5, 0, 5, 6, true},
+		{"clamped to lo", 7, 10, 8, 5, 7, 10, true},
+		{"before lo", 7, 10, 6, 2, 0, 0, false},
+		{"at hi", 0, 7, 7, 2, 0, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start, end, ok := aroundRange(tc.lo, tc.hi, tc.i, tc.radius)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.start, start)
+			require.Equal(t, tc.end, end)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+)
+
+const readinessCheckTimeout = 3 * time.Second
+
+// readinessCheck returns the age of the checked data, if any.
+type readinessCheck struct {
+	name string
+	fn   func(ctx context.Context) (*time.Duration, error)
+}
+
+func (s *Server) GetHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, schema.GetHealthResponse{Status: schema.HealthStatusOK})
+}
+
+// GetReadiness checks the dependencies and the freshness of the data served,
+// and responds with 503 if any of them is degraded.
+func (s *Server) GetReadiness(c echo.Context) error {
+	checks := []readinessCheck{
+		{"mongodb", func(ctx context.Context) (*time.Duration, error) {
+			return nil, s.ss.Database().Client().Ping(ctx, nil)
+		}},
+		{"redis", func(ctx context.Context) (*time.Duration, error) {
+			conn, err := s.rp.GetContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer conn.Close()
+			_, err = conn.Do("PING")
+			return nil, err
+		}},
+		{"scoreboardCache", func(ctx context.Context) (*time.Duration, error) {
+			cache, err := s.LoadScoreBoardCache(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return checkAge(cache.UpdatedAt, s.cfg.CacheMaxAge)
+		}},
+		{"poolsCache", func(ctx context.Context) (*time.Duration, error) {
+			cache, err := s.LoadPoolsCache(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return checkAge(cache.UpdatedAt, s.cfg.CacheMaxAge)
+		}},
+		{"pricesCache", func(ctx context.Context) (*time.Duration, error) {
+			cache, err := s.LoadPricesCache(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return checkAge(cache.UpdatedAt, s.cfg.CacheMaxAge)
+		}},
+		{"transformer", func(ctx context.Context) (*time.Duration, error) {
+			cp, err := s.ss.Checkpoint(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if cp.BlockHeight == 0 {
+				return nil, fmt.Errorf("no block has been transformed")
+			}
+			if cp.Replaying() {
+				return nil, fmt.Errorf("replaying blocks up to %d after a rollback", cp.RolledBackFrom)
+			}
+			return checkAge(cp.Timestamp, s.cfg.TransformerMaxLag)
+		}},
+	}
+	resp := runReadinessChecks(c.Request().Context(), checks)
+	code := http.StatusOK
+	if resp.Status != schema.HealthStatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	return c.JSON(code, resp)
+}
+
+// runReadinessChecks runs the checks concurrently, each with a timeout.
+// The overall status is degraded if any of them fails.
+func runReadinessChecks(ctx context.Context, checks []readinessCheck) schema.GetReadinessResponse {
+	resp := schema.GetReadinessResponse{
+		Status: schema.HealthStatusOK,
+		Checks: make([]schema.GetReadinessResponseCheck, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		i, check := i, check
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+			defer cancel()
+			age, err := check.fn(ctx)
+			res := schema.GetReadinessResponseCheck{
+				Name:   check.name,
+				Status: schema.HealthStatusOK,
+			}
+			if age != nil {
+				secs := age.Seconds()
+				res.AgeSeconds = &secs
+			}
+			if err != nil {
+				res.Status = schema.HealthStatusDegraded
+				res.Error = err.Error()
+			}
+			resp.Checks[i] = res
+		}()
+	}
+	wg.Wait()
+	for _, check := range resp.Checks {
+		if check.Status != schema.HealthStatusOK {
+			resp.Status = schema.HealthStatusDegraded
+		}
+	}
+	return resp
+}
+
+func checkAge(t time.Time, maxAge time.Duration) (*time.Duration, error) {
+	age := time.Since(t)
+	if age > maxAge {
+		return &age, fmt.Errorf("older than %s", maxAge)
+	}
+	return &age, nil
+}
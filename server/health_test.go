@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+)
+
+func TestCheckAge(t *testing.T) {
+	age, err := checkAge(time.Now().Add(-time.Minute), time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, age)
+	require.InDelta(t, time.Minute.Seconds(), age.Seconds(), 1)
+
+	age, err = checkAge(time.Now().Add(-2*time.Hour), time.Hour)
+	require.EqualError(t, err, "older than 1h0m0s")
+	require.NotNil(t, age)
+	require.InDelta(t, (2 * time.Hour).Seconds(), age.Seconds(), 1)
+}
+
+func TestRunReadinessChecks(t *testing.T) {
+	pass := func(ctx context.Context) (*time.Duration, error) {
+		return nil, nil
+	}
+	fresh := func(ctx context.Context) (*time.Duration, error) {
+		return checkAge(time.Now().Add(-time.Second), time.Minute)
+	}
+	stale := func(ctx context.Context) (*time.Duration, error) {
+		return checkAge(time.Now().Add(-time.Hour), time.Minute)
+	}
+	failing := func(ctx context.Context) (*time.Duration, error) {
+		return nil, errors.New("connection refused")
+	}
+	timedOut := func(ctx context.Context) (*time.Duration, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > readinessCheckTimeout {
+			return nil, errors.New("no timeout")
+		}
+		return nil, nil
+	}
+
+	resp := runReadinessChecks(context.Background(), []readinessCheck{
+		{"a", pass},
+		{"b", fresh},
+		{"c", timedOut},
+	})
+	require.Equal(t, schema.HealthStatusOK, resp.Status)
+	require.Len(t, resp.Checks, 3)
+	for i, name := range []string{"a", "b", "c"} {
+		require.Equal(t, name, resp.Checks[i].Name)
+		require.Equal(t, schema.HealthStatusOK, resp.Checks[i].Status)
+		require.Empty(t, resp.Checks[i].Error)
+	}
+	require.Nil(t, resp.Checks[0].AgeSeconds)
+	require.NotNil(t, resp.Checks[1].AgeSeconds)
+
+	resp = runReadinessChecks(context.Background(), []readinessCheck{
+		{"a", pass},
+		{"b", stale},
+		{"c", failing},
+	})
+	require.Equal(t, schema.HealthStatusDegraded, resp.Status)
+	require.Equal(t, schema.HealthStatusOK, resp.Checks[0].Status)
+	require.Equal(t, schema.HealthStatusDegraded, resp.Checks[1].Status)
+	require.Equal(t, "older than 1m0s", resp.Checks[1].Error)
+	require.NotNil(t, resp.Checks[1].AgeSeconds)
+	require.InDelta(t, time.Hour.Seconds(), *resp.Checks[1].AgeSeconds, 1)
+	require.Equal(t, schema.HealthStatusDegraded, resp.Checks[2].Status)
+	require.Equal(t, "connection refused", resp.Checks[2].Error)
+	require.Nil(t, resp.Checks[2].AgeSeconds)
+}
+
+func TestServer_GetHealth(t *testing.T) {
+	s := &Server{}
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), rec)
+	require.NoError(t, s.GetHealth(c))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp schema.GetHealthResponse
+	require.NoError(t, jsonit.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, schema.HealthStatusOK, resp.Status)
+}
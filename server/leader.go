@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+var (
+	renewLeaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseLeaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// IsLeader reports whether this server holds the leader lease, and thus
+// is responsible for updating the caches.
+func (s *Server) IsLeader() bool {
+	return atomic.LoadInt32(&s.isLeader) == 1
+}
+
+func (s *Server) setLeader(isLeader bool) {
+	var v int32
+	if isLeader {
+		v = 1
+	}
+	leaderGauge.Set(float64(v))
+	if atomic.SwapInt32(&s.isLeader, v) != v {
+		if isLeader {
+			s.logger.Info("became leader", zap.String("instance", s.instanceID))
+			// The background updater may have skipped its last iteration
+			// while this server was not the leader yet.
+			s.notifyCacheUpdate()
+		} else {
+			s.logger.Info("lost leadership", zap.String("instance", s.instanceID))
+		}
+	}
+}
+
+// RunLeaderElection keeps trying to acquire, or renew, the leader lease
+// until the context is done. The lease is released on return so that
+// another server can take over immediately.
+func (s *Server) RunLeaderElection(ctx context.Context) error {
+	defer func() {
+		if !s.IsLeader() {
+			return
+		}
+		s.setLeader(false)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.releaseLeaderLease(ctx); err != nil {
+			s.logger.Error("failed to release leader lease", zap.Error(err))
+		}
+	}()
+	ticker := time.NewTicker(s.cfg.LeaderLeaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		isLeader, err := s.acquireLeaderLease(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			s.logger.Error("failed to acquire leader lease", zap.Error(err))
+		}
+		s.setLeader(isLeader)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// acquireLeaderLease renews the lease if this server holds it,
+// or acquires it if nobody does.
+func (s *Server) acquireLeaderLease(ctx context.Context) (bool, error) {
+	c, err := s.rp.GetContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get redis conn: %w", err)
+	}
+	defer c.Close()
+	ttl := s.cfg.LeaderLeaseTTL.Milliseconds()
+	renewed, err := redis.Bool(renewLeaseScript.Do(c, s.cfg.Redis.LeaderKey, s.instanceID, ttl))
+	if err != nil {
+		return false, fmt.Errorf("renew lease: %w", err)
+	}
+	if renewed {
+		return true, nil
+	}
+	if _, err := redis.String(c.Do("SET", s.cfg.Redis.LeaderKey, s.instanceID, "NX", "PX", ttl)); err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return false, nil
+		}
+		return false, fmt.Errorf("set lease: %w", err)
+	}
+	return true, nil
+}
+
+func (s *Server) releaseLeaderLease(ctx context.Context) error {
+	c, err := s.rp.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("get redis conn: %w", err)
+	}
+	defer c.Close()
+	_, err = releaseLeaseScript.Do(c, s.cfg.Redis.LeaderKey, s.instanceID)
+	return err
+}
+
+// Leader returns the instance id of the current leader, or an empty string
+// if there is no leader.
+func (s *Server) Leader(ctx context.Context) (string, error) {
+	c, err := s.rp.GetContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get redis conn: %w", err)
+	}
+	defer c.Close()
+	leader, err := redis.String(c.Do("GET", s.cfg.Redis.LeaderKey))
+	if err != nil && !errors.Is(err, redis.ErrNil) {
+		return "", err
+	}
+	return leader, nil
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/schema"
+)
+
+// newTestRedisPool returns a pool connected to GDEX_TEST_REDIS_URI,
+// or skips the test if redis is not available.
+func newTestRedisPool(t *testing.T) *redis.Pool {
+	uri := os.Getenv("GDEX_TEST_REDIS_URI")
+	if uri == "" {
+		uri = "redis://localhost"
+	}
+	rp := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(uri, redis.DialConnectTimeout(3*time.Second))
+		},
+	}
+	t.Cleanup(func() { rp.Close() })
+	c := rp.Get()
+	defer c.Close()
+	if _, err := c.Do("PING"); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+	return rp
+}
+
+// newTestServers returns servers sharing a leader key which is deleted
+// after the test.
+func newTestServers(t *testing.T, n int) []*Server {
+	rp := newTestRedisPool(t)
+	cfg := config.DefaultServerConfig
+	cfg.Redis.LeaderKey = fmt.Sprintf("gdex-test:leader:%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		c := rp.Get()
+		defer c.Close()
+		c.Do("DEL", cfg.Redis.LeaderKey)
+	})
+	var ss []*Server
+	for i := 0; i < n; i++ {
+		ss = append(ss, &Server{
+			cfg:                 cfg,
+			rp:                  rp,
+			logger:              zap.NewNop(),
+			instanceID:          fmt.Sprintf("instance-%d", i),
+			cacheUpdateNotified: make(chan struct{}, 1),
+		})
+	}
+	return ss
+}
+
+func TestServer_LeaderLease(t *testing.T) {
+	ss := newTestServers(t, 2)
+	a, b := ss[0], ss[1]
+	ctx := context.Background()
+
+	isLeader, err := a.acquireLeaderLease(ctx)
+	require.NoError(t, err)
+	require.True(t, isLeader)
+	isLeader, err = b.acquireLeaderLease(ctx)
+	require.NoError(t, err)
+	require.False(t, isLeader)
+	leader, err := b.Leader(ctx)
+	require.NoError(t, err)
+	require.Equal(t, a.instanceID, leader)
+
+	// Renewing the lease extends its TTL.
+	c := a.rp.Get()
+	defer c.Close()
+	_, err = c.Do("PEXPIRE", a.cfg.Redis.LeaderKey, 1000)
+	require.NoError(t, err)
+	isLeader, err = a.acquireLeaderLease(ctx)
+	require.NoError(t, err)
+	require.True(t, isLeader)
+	ttl, err := redis.Int64(c.Do("PTTL", a.cfg.Redis.LeaderKey))
+	require.NoError(t, err)
+	require.Greater(t, ttl, int64(1000))
+
+	// Only the holder can release the lease.
+	require.NoError(t, b.releaseLeaderLease(ctx))
+	leader, err = b.Leader(ctx)
+	require.NoError(t, err)
+	require.Equal(t, a.instanceID, leader)
+	require.NoError(t, a.releaseLeaderLease(ctx))
+	leader, err = b.Leader(ctx)
+	require.NoError(t, err)
+	require.Empty(t, leader)
+
+	isLeader, err = b.acquireLeaderLease(ctx)
+	require.NoError(t, err)
+	require.True(t, isLeader)
+}
+
+func TestServer_RunLeaderElection(t *testing.T) {
+	ss := newTestServers(t, 1)
+	s := ss[0]
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.RunLeaderElection(ctx)
+	}()
+	require.Eventually(t, s.IsLeader, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-s.cacheUpdateNotified:
+	default:
+		t.Fatal("becoming the leader must notify the background updater")
+	}
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.False(t, s.IsLeader())
+	leader, err := s.Leader(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, leader)
+}
+
+func TestServer_SetLeader(t *testing.T) {
+	s := &Server{logger: zap.NewNop(), cacheUpdateNotified: make(chan struct{}, 1)}
+	s.setLeader(true)
+	require.True(t, s.IsLeader())
+	require.Len(t, s.cacheUpdateNotified, 1)
+	<-s.cacheUpdateNotified
+	// Staying the leader does not notify again.
+	s.setLeader(true)
+	require.Len(t, s.cacheUpdateNotified, 0)
+	s.setLeader(false)
+	require.False(t, s.IsLeader())
+	require.Len(t, s.cacheUpdateNotified, 0)
+}
+
+func TestServer_SaveScoreBoardCache(t *testing.T) {
+	ss := newTestServers(t, 2)
+	a, b := ss[0], ss[1]
+	ctx := context.Background()
+	prefix := fmt.Sprintf("gdex-test:scoreboard:%d", time.Now().UnixNano())
+	for _, s := range ss {
+		s.cfg.Redis.ScoreBoardCacheKey = prefix
+		s.cfg.Redis.ScoreBoardAccountsKey = prefix + ":accounts"
+	}
+	c := a.rp.Get()
+	defer c.Close()
+	t.Cleanup(func() {
+		c.Do("DEL", prefix, prefix+":accounts")
+	})
+	accs := []schema.AccountCache{{Address: "cosmos1a", Ranking: 1}, {Address: "cosmos1b", Ranking: 2}}
+
+	isLeader, err := a.acquireLeaderLease(ctx)
+	require.NoError(t, err)
+	require.True(t, isLeader)
+	require.NoError(t, a.SaveScoreBoardCache(ctx, schema.ScoreBoardCache{BlockHeight: 10, NumAccounts: 2}, accs))
+	err = b.SaveScoreBoardCache(ctx, schema.ScoreBoardCache{BlockHeight: 11}, accs[:1])
+	require.ErrorIs(t, err, errNotLeader)
+
+	n, err := redis.Int(c.Do("LLEN", prefix+":accounts"))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	ttl, err := redis.Int(c.Do("PTTL", prefix+":accounts"))
+	require.NoError(t, err)
+	require.Equal(t, -1, ttl)
+	cache, err := a.LoadScoreBoardCache(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, cache.BlockHeight)
+	// Temporary lists are removed whether the write succeeds or not.
+	keys, err := redis.Strings(c.Do("KEYS", prefix+":accounts:tmp:*"))
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/b-harvest/gravity-dex-backend/metrics"
+)
+
+var (
+	cacheUpdateDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "server",
+		Name:      "cache_update_duration_seconds",
+		Help:      "Duration of cache updates by cache.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"cache"})
+	cacheUpdateFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "server",
+		Name:      "cache_update_failures_total",
+		Help:      "Number of failed cache updates by cache.",
+	}, []string{"cache"})
+	cacheBlockHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "server",
+		Name:      "cache_block_height",
+		Help:      "Block height of the caches last updated by this server.",
+	})
+	leaderGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "server",
+		Name:      "is_leader",
+		Help:      "Whether this server is the leader updating the caches.",
+	})
+)
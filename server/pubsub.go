@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+)
+
+// runSubscriber calls handle for each block height update published to
+// the channel, until the context is done. It resubscribes when the
+// connection is lost, so updates published meanwhile are missed.
+func (s *Server) runSubscriber(ctx context.Context, channel string, handle func(schema.BlockHeightUpdate)) error {
+	for {
+		if err := s.receiveBlockHeightUpdates(ctx, channel, handle); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.logger.Error("failed to receive block height updates", zap.String("channel", channel), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Server) receiveBlockHeightUpdates(ctx context.Context, channel string, handle func(schema.BlockHeightUpdate)) error {
+	c, err := s.rp.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("get redis conn: %w", err)
+	}
+	psc := redis.PubSubConn{Conn: c}
+	defer psc.Close()
+	if err := psc.Subscribe(channel); err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			psc.Unsubscribe()
+		case <-done:
+		}
+	}()
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			var update schema.BlockHeightUpdate
+			if err := jsonit.Unmarshal(v.Data, &update); err != nil {
+				s.logger.Warn("invalid block height update", zap.ByteString("data", v.Data), zap.Error(err))
+				continue
+			}
+			handle(update)
+		case redis.Subscription:
+			if v.Count == 0 {
+				return ctx.Err()
+			}
+		case error:
+			return v
+		}
+	}
+}
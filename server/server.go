@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/metrics"
 	"github.com/b-harvest/gravity-dex-backend/service/price"
 	"github.com/b-harvest/gravity-dex-backend/service/pricetable"
 	"github.com/b-harvest/gravity-dex-backend/service/score"
@@ -24,7 +25,16 @@ type Server struct {
 	pts    *pricetable.Service
 	scs    *score.Service
 	rp     *redis.Pool
+	hub    *streamHub
 	logger *zap.Logger
+
+	instanceID               string
+	isLeader                 int32
+	cacheUpdateNotified      chan struct{}
+	cachesInvalidated        int32
+	lastUpdatedBlockHeight   int64
+	lastUpdatedAt            time.Time
+	lastPublishedBlockHeight int64
 }
 
 func New(cfg config.ServerConfig, ss *store.Service, ps price.Service, pts *pricetable.Service, scs *score.Service, rp *redis.Pool, logger *zap.Logger) *Server {
@@ -33,14 +43,34 @@ func New(cfg config.ServerConfig, ss *store.Service, ps price.Service, pts *pric
 	e.HidePort = true
 	e.Debug = cfg.Debug
 	e.Use(middleware.Logger())
+	e.Use(metrics.EchoMiddleware())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
-	s := &Server{e, cfg, ss, ps, pts, scs, rp, logger}
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		instanceID = defaultInstanceID()
+	}
+	s := &Server{
+		Echo:   e,
+		cfg:    cfg,
+		ss:     ss,
+		ps:     ps,
+		pts:    pts,
+		scs:    scs,
+		rp:     rp,
+		hub:    newStreamHub(),
+		logger: logger,
+
+		instanceID:          instanceID,
+		cacheUpdateNotified: make(chan struct{}, 1),
+	}
 	s.registerRoutes()
 	return s
 }
 
 func (s *Server) ShutdownWithTimeout(timeout time.Duration) error {
+	// Streams never end by themselves, so disconnect them first.
+	s.hub.close()
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	return s.Shutdown(ctx)
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+	"github.com/b-harvest/gravity-dex-backend/util"
+)
+
+const (
+	StreamTopicScoreBoard    = "scoreboard"
+	StreamTopicPools         = "pools"
+	StreamTopicPrices        = "prices"
+	StreamTopicAccountPrefix = "account:"
+)
+
+// streamBufferSize is the number of messages buffered per subscriber.
+// A subscriber which falls behind more than this is disconnected.
+const streamBufferSize = 16
+
+type streamSubscriber struct {
+	topics map[string]struct{}
+	ch     chan schema.StreamMessage
+}
+
+// streamHub fans out stream messages to the subscribers connected to this server.
+type streamHub struct {
+	mux             sync.Mutex
+	subs            map[*streamSubscriber]struct{}
+	closed          bool
+	lastBlockHeight int64
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{subs: make(map[*streamSubscriber]struct{})}
+}
+
+func (h *streamHub) subscribe(topics []string) (*streamSubscriber, bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.closed {
+		return nil, false
+	}
+	sub := &streamSubscriber{
+		topics: make(map[string]struct{}),
+		ch:     make(chan schema.StreamMessage, streamBufferSize),
+	}
+	for _, topic := range topics {
+		sub.topics[topic] = struct{}{}
+	}
+	h.subs[sub] = struct{}{}
+	return sub, true
+}
+
+func (h *streamHub) unsubscribe(sub *streamSubscriber) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// close disconnects all subscribers and rejects new ones.
+func (h *streamHub) close() {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for sub := range h.subs {
+		close(sub.ch)
+	}
+	h.subs = make(map[*streamSubscriber]struct{})
+	h.closed = true
+}
+
+// changed reports whether the block height differs from the last one seen,
+// since every server may publish the same update.
+// A lower block height is a change too, as the state may have been rolled back.
+func (h *streamHub) changed(blockHeight int64) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if blockHeight == h.lastBlockHeight {
+		return false
+	}
+	h.lastBlockHeight = blockHeight
+	return true
+}
+
+// topics returns the topics subscribed by at least one subscriber.
+func (h *streamHub) topics() []string {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	set := make(map[string]struct{})
+	for sub := range h.subs {
+		for topic := range sub.topics {
+			set[topic] = struct{}{}
+		}
+	}
+	var topics []string
+	for topic := range set {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+func (h *streamHub) broadcast(msg schema.StreamMessage) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for sub := range h.subs {
+		if _, ok := sub.topics[msg.Topic]; !ok {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// PublishCacheUpdate notifies all servers that the caches have been updated.
+func (s *Server) PublishCacheUpdate(ctx context.Context, blockHeight int64) error {
+	c, err := s.rp.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("get redis conn: %w", err)
+	}
+	defer c.Close()
+	b, err := jsonit.Marshal(schema.BlockHeightUpdate{BlockHeight: blockHeight})
+	if err != nil {
+		return fmt.Errorf("marshal update: %w", err)
+	}
+	_, err = c.Do("PUBLISH", s.cfg.Redis.UpdatesChannel, b)
+	return err
+}
+
+// RunStreamHub receives cache updates from Redis and pushes them to
+// the stream subscribers, until the context is done.
+func (s *Server) RunStreamHub(ctx context.Context) error {
+	defer s.hub.close()
+	return s.runSubscriber(ctx, s.cfg.Redis.UpdatesChannel, func(update schema.BlockHeightUpdate) {
+		if s.hub.changed(update.BlockHeight) {
+			s.broadcastCacheUpdate(ctx, update.BlockHeight)
+		}
+	})
+}
+
+// broadcastCacheUpdate loads the caches once per subscribed topic and
+// pushes them to the subscribers.
+func (s *Server) broadcastCacheUpdate(ctx context.Context, blockHeight int64) {
+	for _, topic := range s.hub.topics() {
+		data, err := s.loadStreamTopic(ctx, topic)
+		if err != nil {
+			if !errors.Is(err, redis.ErrNil) {
+				s.logger.Error("failed to load stream topic", zap.String("topic", topic), zap.Error(err))
+			}
+			continue
+		}
+		s.hub.broadcast(schema.StreamMessage{
+			Topic:       topic,
+			BlockHeight: blockHeight,
+			Data:        data,
+		})
+	}
+}
+
+func (s *Server) loadStreamTopic(ctx context.Context, topic string) (interface{}, error) {
+	switch topic {
+	case StreamTopicScoreBoard:
+		sbCache, err := s.LoadScoreBoardCache(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load score board cache: %w", err)
+		}
+		accCaches, err := s.LoadScoreBoardAccounts(ctx, 0, util.MinInt(s.cfg.ScoreBoardSize, sbCache.NumAccounts))
+		if err != nil {
+			return nil, fmt.Errorf("load score board accounts: %w", err)
+		}
+		resp := schema.GetScoreBoardResponse{
+			BlockHeight: sbCache.BlockHeight,
+			Accounts:    []schema.GetScoreBoardResponseAccount{},
+			Total:       sbCache.NumAccounts,
+			UpdatedAt:   sbCache.UpdatedAt,
+		}
+		for _, acc := range accCaches {
+			resp.Accounts = append(resp.Accounts, newScoreBoardResponseAccount(acc))
+		}
+		return resp, nil
+	case StreamTopicPools:
+		cache, err := s.LoadPoolsCache(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load pools cache: %w", err)
+		}
+		return schema.GetPoolsResponse(cache), nil
+	case StreamTopicPrices:
+		cache, err := s.LoadPricesCache(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load prices cache: %w", err)
+		}
+		return schema.GetPricesResponse(cache), nil
+	default:
+		accCache, err := s.LoadAccountCache(ctx, strings.TrimPrefix(topic, StreamTopicAccountPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("load account cache: %w", err)
+		}
+		return newSearchAccountResponse(accCache), nil
+	}
+}
+
+func (s *Server) parseStreamTopics(str string) ([]string, error) {
+	var topics []string
+	for _, topic := range strings.Split(str, ",") {
+		topic = strings.TrimSpace(topic)
+		switch {
+		case topic == StreamTopicScoreBoard, topic == StreamTopicPools, topic == StreamTopicPrices:
+		case strings.HasPrefix(topic, StreamTopicAccountPrefix):
+			if !strings.HasPrefix(strings.TrimPrefix(topic, StreamTopicAccountPrefix), s.cfg.AddressPrefix) {
+				return nil, fmt.Errorf("invalid address in topic %q", topic)
+			}
+		default:
+			return nil, fmt.Errorf("unknown topic %q", topic)
+		}
+		if !util.StringInSlice(topic, topics) {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) > s.cfg.StreamMaxTopics {
+		return nil, fmt.Errorf("too many topics")
+	}
+	return topics, nil
+}
+
+// Stream pushes the subscribed topics as Server-Sent Events whenever the caches are updated.
+func (s *Server) Stream(c echo.Context) error {
+	var req schema.StreamRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if req.Topics == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "topics must be provided")
+	}
+	topics, err := s.parseStreamTopics(req.Topics)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	sub, ok := s.hub.subscribe(topics)
+	if !ok {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "server is shutting down")
+	}
+	defer s.hub.unsubscribe(sub)
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	ticker := time.NewTicker(s.cfg.StreamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			w.Flush()
+		case msg, ok := <-sub.ch:
+			if !ok {
+				return nil
+			}
+			b, err := jsonit.Marshal(msg)
+			if err != nil {
+				return fmt.Errorf("marshal message: %w", err)
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Topic, b); err != nil {
+				return nil
+			}
+			w.Flush()
+		}
+	}
+}
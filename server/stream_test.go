@@ -0,0 +1,123 @@
+package server
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/schema"
+)
+
+// receive returns the messages buffered for the subscriber, and whether
+// its channel is still open.
+func receive(sub *streamSubscriber) ([]schema.StreamMessage, bool) {
+	var msgs []schema.StreamMessage
+	for {
+		select {
+		case msg, ok := <-sub.ch:
+			if !ok {
+				return msgs, false
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs, true
+		}
+	}
+}
+
+func TestStreamHub_Broadcast(t *testing.T) {
+	h := newStreamHub()
+	sub1, ok := h.subscribe([]string{StreamTopicScoreBoard, StreamTopicPools})
+	require.True(t, ok)
+	sub2, ok := h.subscribe([]string{StreamTopicPools, StreamTopicPrices})
+	require.True(t, ok)
+
+	topics := h.topics()
+	sort.Strings(topics)
+	require.Equal(t, []string{StreamTopicPools, StreamTopicPrices, StreamTopicScoreBoard}, topics)
+
+	h.broadcast(schema.StreamMessage{Topic: StreamTopicScoreBoard, BlockHeight: 1})
+	h.broadcast(schema.StreamMessage{Topic: StreamTopicPools, BlockHeight: 1})
+	h.broadcast(schema.StreamMessage{Topic: "account:cosmos1a", BlockHeight: 1})
+
+	msgs, open := receive(sub1)
+	require.True(t, open)
+	require.Len(t, msgs, 2)
+	require.Equal(t, StreamTopicScoreBoard, msgs[0].Topic)
+	require.Equal(t, StreamTopicPools, msgs[1].Topic)
+	msgs, open = receive(sub2)
+	require.True(t, open)
+	require.Len(t, msgs, 1)
+	require.Equal(t, StreamTopicPools, msgs[0].Topic)
+
+	h.unsubscribe(sub1)
+	_, open = receive(sub1)
+	require.False(t, open)
+	h.unsubscribe(sub1) // unsubscribing twice is a no-op
+	topics = h.topics()
+	sort.Strings(topics)
+	require.Equal(t, []string{StreamTopicPools, StreamTopicPrices}, topics)
+}
+
+func TestStreamHub_SlowSubscriber(t *testing.T) {
+	h := newStreamHub()
+	slow, _ := h.subscribe([]string{StreamTopicPools})
+	fast, _ := h.subscribe([]string{StreamTopicPools})
+	for i := 0; i < streamBufferSize; i++ {
+		h.broadcast(schema.StreamMessage{Topic: StreamTopicPools, BlockHeight: int64(i + 1)})
+		msgs, open := receive(fast)
+		require.True(t, open)
+		require.Len(t, msgs, 1)
+	}
+	// The slow subscriber's buffer is full, so it is dropped on the next message.
+	h.broadcast(schema.StreamMessage{Topic: StreamTopicPools, BlockHeight: streamBufferSize + 1})
+	msgs, open := receive(slow)
+	require.False(t, open)
+	require.Len(t, msgs, streamBufferSize)
+	msgs, open = receive(fast)
+	require.True(t, open)
+	require.Len(t, msgs, 1)
+	require.Len(t, h.subs, 1)
+	h.unsubscribe(slow) // must not close the channel again
+}
+
+func TestStreamHub_Close(t *testing.T) {
+	h := newStreamHub()
+	sub, _ := h.subscribe([]string{StreamTopicPools})
+	h.close()
+	_, open := receive(sub)
+	require.False(t, open)
+	h.unsubscribe(sub)
+	_, ok := h.subscribe([]string{StreamTopicPools})
+	require.False(t, ok)
+}
+
+func TestStreamHub_Changed(t *testing.T) {
+	h := newStreamHub()
+	require.True(t, h.changed(10))
+	require.False(t, h.changed(10))
+	require.True(t, h.changed(11))
+	// A lower block height after a rollback is a change.
+	require.True(t, h.changed(9))
+	require.False(t, h.changed(9))
+	require.True(t, h.changed(10))
+}
+
+func TestServer_ParseStreamTopics(t *testing.T) {
+	cfg := config.DefaultServerConfig
+	cfg.StreamMaxTopics = 3
+	s := &Server{cfg: cfg}
+
+	topics, err := s.parseStreamTopics("pools, prices,pools,account:cosmos1a")
+	require.NoError(t, err)
+	require.Equal(t, []string{StreamTopicPools, StreamTopicPrices, "account:cosmos1a"}, topics)
+
+	_, err = s.parseStreamTopics("pools,unknown")
+	require.Error(t, err)
+	_, err = s.parseStreamTopics("account:terra1a")
+	require.Error(t, err)
+	_, err = s.parseStreamTopics("scoreboard,pools,prices,account:cosmos1a")
+	require.EqualError(t, err, "too many topics")
+}
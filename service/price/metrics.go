@@ -0,0 +1,38 @@
+package price
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/b-harvest/gravity-dex-backend/metrics"
+)
+
+var (
+	providerRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "price",
+		Name:      "provider_request_duration_seconds",
+		Help:      "Latency of price provider calls by provider.",
+	}, []string{"provider"})
+	providerRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "price",
+		Name:      "provider_request_errors_total",
+		Help:      "Number of failed price provider calls by provider.",
+	}, []string{"provider"})
+)
+
+func providerName(srv Service) string {
+	switch srv.(type) {
+	case *CyberNodeService:
+		return "cybernode"
+	case *RandomOracleService:
+		return "randomoracle"
+	case *FixerService:
+		return "fixer"
+	case *CoinMarketCapService:
+		return "coinmarketcap"
+	default:
+		return "unknown"
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -71,8 +72,12 @@ func (s *service) Prices(ctx context.Context, symbols ...string) (Table, error)
 		srv := srv
 		ss := ss
 		eg.Go(func() error {
+			provider := providerName(srv)
+			started := time.Now()
 			t, err := srv.Prices(ctx2, ss...)
+			providerRequestDuration.WithLabelValues(provider).Observe(time.Since(started).Seconds())
 			if err != nil {
+				providerRequestErrors.WithLabelValues(provider).Inc()
 				return err
 			}
 			mux.Lock()
@@ -0,0 +1,70 @@
+package pricetable
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// History holds recorded prices.
+// The price of a denom at a time is the last recorded price before the time.
+type History struct {
+	prices        map[string][]HistoryEntry
+	denomMetadata map[string]DenomMetadata
+}
+
+type HistoryEntry struct {
+	Time  time.Time `json:"time"`
+	Price float64   `json:"price"`
+}
+
+// LoadHistory loads a price history from a JSON file, which is an object
+// of price entries by symbols(display denoms), for example:
+//
+//	{"atom": [{"time": "2021-05-01T00:00:00Z", "price": 25.2}]}
+//
+// Prices of base denoms are derived from their display denoms' prices using denomMetadata.
+func LoadHistory(name string, denomMetadata map[string]DenomMetadata) (*History, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var prices map[string][]HistoryEntry
+	if err := jsoniter.NewDecoder(f).Decode(&prices); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	h := &History{
+		prices:        make(map[string][]HistoryEntry),
+		denomMetadata: denomMetadata,
+	}
+	for symbol, entries := range prices {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Time.Before(entries[j].Time)
+		})
+		h.prices[strings.ToLower(symbol)] = entries
+	}
+	return h, nil
+}
+
+func (h *History) Price(denom string, t time.Time) (float64, bool) {
+	symbol, scale := denom, 1.0
+	if _, ok := h.prices[symbol]; !ok {
+		if md, ok := h.denomMetadata[denom]; ok {
+			symbol, scale = md.Display, math.Pow10(-md.Exponent)
+		}
+	}
+	entries := h.prices[symbol]
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Time.After(t)
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return entries[i-1].Price * scale, true
+}
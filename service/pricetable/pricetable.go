@@ -90,7 +90,7 @@ func (c *Context) Price(denom string) (float64, error) {
 			p = mp.MinPrice + rand.Float64()*(mp.MaxPrice-mp.MinPrice)
 		case c.IsPoolCoinDenom(denom):
 			pool := c.pools[denom]
-			if pool.PoolCoinAmount() == 0 { // pool is inactive
+			if pool.PoolCoinAmount().IsZero() { // pool is inactive
 				p = 0
 				break
 			}
@@ -100,9 +100,9 @@ func (c *Context) Price(denom string) (float64, error) {
 				if err != nil {
 					return 0, err
 				}
-				sum += tp * float64(rc.Amount)
+				sum += tp * rc.Amount.Float64()
 			}
-			p = 1 / float64(pool.PoolCoinAmount()) * sum
+			p = 1 / pool.PoolCoinAmount().Float64() * sum
 		default:
 			md, ok := c.denomMetadata[denom]
 			if !ok {
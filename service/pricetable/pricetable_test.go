@@ -7,7 +7,6 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
-	"github.com/b-harvest/gravity-dex-backend/config"
 	"github.com/b-harvest/gravity-dex-backend/schema"
 	"github.com/b-harvest/gravity-dex-backend/service/price"
 )
@@ -15,10 +14,10 @@ import (
 func TestContext_Price(t *testing.T) {
 	ctx := &Context{
 		coinDenoms: []string{"atom", "luna", "usd"},
-		manualPrices: map[string]config.ManualPrice{
+		manualPrices: map[string]ManualPrice{
 			"usd": {MinPrice: 1.0, MaxPrice: 1.0},
 		},
-		denomMetadata: map[string]config.DenomMetadata{
+		denomMetadata: map[string]DenomMetadata{
 			"uusd":  {Display: "usd", Exponent: 6},
 			"uatom": {Display: "atom", Exponent: 6},
 			"uluna": {Display: "luna", Exponent: 6},
@@ -27,34 +26,58 @@ func TestContext_Price(t *testing.T) {
 			"atom": 20.0,
 			"luna": 10.0,
 		},
-		pools: map[string]*schema.PoolStatus{
+		pools: map[string]*schema.Pool{
 			"pool1": {
-				ReserveCoins: []schema.Coin{
-					{Denom: "uatom", Amount: 1000000},
-					{Denom: "uusd", Amount: 20000000},
+				ReserveCoinDenoms: []string{"uatom", "uusd"},
+				ReserveAccountBalance: &schema.Balance{
+					Coins: []schema.Coin{
+						{Denom: "uatom", Amount: schema.NewInt(1000000)},
+						{Denom: "uusd", Amount: schema.NewInt(20000000)},
+					},
+				},
+				PoolCoinDenom: "pool1",
+				PoolCoinSupply: &schema.Supply{
+					Coin: schema.Coin{Denom: "pool1", Amount: schema.NewInt(1000000)},
 				},
-				PoolCoin: schema.Coin{Denom: "pool1", Amount: 1000000},
 			},
 			"pool2": {
-				ReserveCoins: []schema.Coin{
-					{Denom: "uluna", Amount: 1000000},
-					{Denom: "uusd", Amount: 10000000},
+				ReserveCoinDenoms: []string{"uluna", "uusd"},
+				ReserveAccountBalance: &schema.Balance{
+					Coins: []schema.Coin{
+						{Denom: "uluna", Amount: schema.NewInt(1000000)},
+						{Denom: "uusd", Amount: schema.NewInt(10000000)},
+					},
+				},
+				PoolCoinDenom: "pool2",
+				PoolCoinSupply: &schema.Supply{
+					Coin: schema.Coin{Denom: "pool2", Amount: schema.NewInt(1000000)},
 				},
-				PoolCoin: schema.Coin{Denom: "pool2", Amount: 1000000},
 			},
 			"pool3": {
-				ReserveCoins: []schema.Coin{
-					{Denom: "uatom", Amount: 1000000},
-					{Denom: "uluna", Amount: 2000000},
+				ReserveCoinDenoms: []string{"uatom", "uluna"},
+				ReserveAccountBalance: &schema.Balance{
+					Coins: []schema.Coin{
+						{Denom: "uatom", Amount: schema.NewInt(1000000)},
+						{Denom: "uluna", Amount: schema.NewInt(2000000)},
+					},
+				},
+				PoolCoinDenom: "pool3",
+				PoolCoinSupply: &schema.Supply{
+					Coin: schema.Coin{Denom: "pool3", Amount: schema.NewInt(1000000)},
 				},
-				PoolCoin: schema.Coin{Denom: "pool3", Amount: 1000000},
 			},
 			"pool4": {
-				ReserveCoins: []schema.Coin{
-					{Denom: "pool1", Amount: 50000},
-					{Denom: "pool2", Amount: 100000},
+				ReserveCoinDenoms: []string{"pool1", "pool2"},
+				ReserveAccountBalance: &schema.Balance{
+					Coins: []schema.Coin{
+						{Denom: "pool1", Amount: schema.NewInt(50000)},
+						{Denom: "pool2", Amount: schema.NewInt(100000)},
+					},
+				},
+				PoolCoinDenom: "pool4",
+				PoolCoinSupply: &schema.Supply{
+					Coin: schema.Coin{Denom: "pool4", Amount: schema.NewInt(1000000)},
 				},
-				PoolCoin: schema.Coin{Denom: "pool4", Amount: 1000000},
 			},
 		},
 	}
@@ -9,6 +9,7 @@ type Config struct {
 	InitialBalancesValue float64  `yaml:"initial_balances_value"`
 	MaxActionScorePerDay int      `yaml:"max_action_score_per_day"`
 	TradingDates         []string `yaml:"trading_dates"`
+	WithdrawScoreWeight  float64  `yaml:"withdraw_score_weight"`
 }
 
 var DefaultConfig = Config{
@@ -36,5 +37,8 @@ func (cfg Config) Validate() error {
 	if cfg.TradingScoreRatio < 0 || cfg.TradingScoreRatio > 1 {
 		return fmt.Errorf("'trading_score_ratio' must be between 0~1")
 	}
+	if cfg.WithdrawScoreWeight < -1 || cfg.WithdrawScoreWeight > 1 {
+		return fmt.Errorf("'withdraw_score_weight' must be between -1~1")
+	}
 	return nil
 }
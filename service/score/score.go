@@ -18,16 +18,27 @@ func NewService(cfg Config, ss *store.Service) *Service {
 	return &Service{cfg: cfg, ss: ss}
 }
 
+// ActionScore scores the actions of the account out of 100.
+// A negative WithdrawScoreWeight penalizes withdrawals, without making the score negative.
 func (s *Service) ActionScore(acc schema.Account) (float64, bool, error) {
 	ds := acc.DepositStatus().NumDifferentPoolsByDate()
 	ss := acc.SwapStatus().NumDifferentPoolsByDate()
+	ws := acc.WithdrawStatus().NumDifferentPoolsByDate()
 	score := 0.0
 	for _, k := range s.cfg.TradingDates {
 		score += float64(util.MinInt(s.cfg.MaxActionScorePerDay, ds[k]))
 		score += float64(util.MinInt(s.cfg.MaxActionScorePerDay, ss[k]))
+		score += s.cfg.WithdrawScoreWeight * float64(util.MinInt(s.cfg.MaxActionScorePerDay, ws[k]))
 	}
-	score /= float64((2 * s.cfg.MaxActionScorePerDay) * len(s.cfg.TradingDates))
+	maxScorePerDay := 2.0
+	if s.cfg.WithdrawScoreWeight > 0 { // withdrawals can only raise the upper bound when they're rewarded
+		maxScorePerDay += s.cfg.WithdrawScoreWeight
+	}
+	score /= maxScorePerDay * float64(s.cfg.MaxActionScorePerDay*len(s.cfg.TradingDates))
 	score *= 100
+	if score < 0 {
+		score = 0
+	}
 	isValid := acc.DepositStatus().NumDifferentPools() >= 3 && acc.SwapStatus().NumDifferentPools() >= 3
 	return score, isValid, nil
 }
@@ -45,7 +56,7 @@ func (s *Service) TradingScore(acc schema.Account, priceTable price.Table) (floa
 		if !ok {
 			return 0, fmt.Errorf("no price for denom %q", c.Denom)
 		}
-		v += p * float64(c.Amount)
+		v += p * c.Amount.Float64()
 	}
 	return (v - s.cfg.InitialBalancesValue) / s.cfg.InitialBalancesValue * 100, nil
 }
@@ -0,0 +1,52 @@
+package score
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+)
+
+func newTestAccount(deposits, swaps, withdrawals int) schema.Account {
+	newStatus := func(n int) schema.AccountActionStatus {
+		s := schema.NewAccountActionStatus()
+		for i := 0; i < n; i++ {
+			s.IncreaseCount(uint64(i+1), "2021-05-04", 1)
+		}
+		return s
+	}
+	return schema.Account{
+		Status: &schema.AccountStatus{
+			Deposits:    newStatus(deposits),
+			Swaps:       newStatus(swaps),
+			Withdrawals: newStatus(withdrawals),
+		},
+	}
+}
+
+func TestService_ActionScore(t *testing.T) {
+	for _, tc := range []struct {
+		weight                       float64
+		deposits, swaps, withdrawals int
+		score                        float64
+	}{
+		{0, 3, 3, 3, 100},
+		{0, 3, 0, 3, 50},
+		{0.5, 3, 3, 3, 100},
+		{0.5, 3, 3, 0, 80},
+		{0.5, 5, 5, 5, 100}, // capped by MaxActionScorePerDay
+		{-0.5, 3, 3, 0, 100},
+		{-0.5, 3, 3, 3, 75},
+		{-1, 0, 1, 3, 0}, // clamped at 0
+	} {
+		cfg := DefaultConfig
+		cfg.TradingDates = []string{"2021-05-04"}
+		cfg.WithdrawScoreWeight = tc.weight
+		s := NewService(cfg, nil)
+		score, _, err := s.ActionScore(newTestAccount(tc.deposits, tc.swaps, tc.withdrawals))
+		require.NoError(t, err)
+		require.InDelta(t, tc.score, score, 1e-9, "weight=%v deposits=%d swaps=%d withdrawals=%d",
+			tc.weight, tc.deposits, tc.swaps, tc.withdrawals)
+	}
+}
@@ -11,17 +11,18 @@ import (
 )
 
 type Account struct {
-	BlockHeight   int64
-	Address       string
-	Username      string
-	Ranking       int
-	TotalScore    float64
-	ActionScore   float64
-	TradingScore  float64
-	IsValid       bool
-	DepositStatus AccountActionStatus
-	SwapStatus    AccountActionStatus
-	UpdatedAt     time.Time
+	BlockHeight    int64
+	Address        string
+	Username       string
+	Ranking        int
+	TotalScore     float64
+	ActionScore    float64
+	TradingScore   float64
+	IsValid        bool
+	DepositStatus  AccountActionStatus
+	SwapStatus     AccountActionStatus
+	WithdrawStatus AccountActionStatus
+	UpdatedAt      time.Time
 }
 
 type AccountActionStatus struct {
@@ -60,6 +61,10 @@ func (s *Service) Scoreboard(ctx context.Context, blockHeight int64, priceTable
 				NumDifferentPools:       acc.SwapStatus().NumDifferentPools(),
 				NumDifferentPoolsByDate: acc.SwapStatus().NumDifferentPoolsByDate(),
 			},
+			WithdrawStatus: AccountActionStatus{
+				NumDifferentPools:       acc.WithdrawStatus().NumDifferentPools(),
+				NumDifferentPoolsByDate: acc.WithdrawStatus().NumDifferentPoolsByDate(),
+			},
 			UpdatedAt: now,
 		})
 		return false, nil
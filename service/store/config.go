@@ -7,25 +7,35 @@ import (
 type Config struct {
 	DB                      string `yaml:"db"`
 	CheckpointCollection    string `yaml:"checkpoint_collection"`
+	StateSnapshotCollection string `yaml:"state_snapshot_collection"`
 	AccountCollection       string `yaml:"account_collection"`
 	AccountStatusCollection string `yaml:"account_status_collection"`
+	AccountEventCollection  string `yaml:"account_event_collection"`
 	PoolCollection          string `yaml:"pool_collection"`
 	PoolStatusCollection    string `yaml:"pool_status_collection"`
+	PoolSnapshotCollection  string `yaml:"pool_snapshot_collection"`
+	PoolCandleCollection    string `yaml:"pool_candle_collection"`
 	BalanceCollection       string `yaml:"balance_collection"`
 	SupplyCollection        string `yaml:"supply_collection"`
 	BannerCollection        string `yaml:"banner_collection"`
+	AuditLogCollection      string `yaml:"audit_log_collection"`
 }
 
 var DefaultConfig = Config{
 	DB:                      "gdex",
 	CheckpointCollection:    "checkpoint",
+	StateSnapshotCollection: "stateSnapshots",
 	AccountCollection:       "accounts",
 	AccountStatusCollection: "accountStatuses",
+	AccountEventCollection:  "accountEvents",
 	PoolCollection:          "pools",
 	PoolStatusCollection:    "poolStatuses",
+	PoolSnapshotCollection:  "poolSnapshots",
+	PoolCandleCollection:    "poolCandles",
 	BalanceCollection:       "balances",
 	SupplyCollection:        "supplies",
 	BannerCollection:        "banners",
+	AuditLogCollection:      "auditLogs",
 }
 
 func (cfg Config) Validate() error {
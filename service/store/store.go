@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -30,6 +33,10 @@ func (s *Service) CheckpointCollection() *mongo.Collection {
 	return s.Database().Collection(s.cfg.CheckpointCollection)
 }
 
+func (s *Service) StateSnapshotCollection() *mongo.Collection {
+	return s.Database().Collection(s.cfg.StateSnapshotCollection)
+}
+
 func (s *Service) AccountCollection() *mongo.Collection {
 	return s.Database().Collection(s.cfg.AccountCollection)
 }
@@ -38,6 +45,10 @@ func (s *Service) AccountStatusCollection() *mongo.Collection {
 	return s.Database().Collection(s.cfg.AccountStatusCollection)
 }
 
+func (s *Service) AccountEventCollection() *mongo.Collection {
+	return s.Database().Collection(s.cfg.AccountEventCollection)
+}
+
 func (s *Service) PoolCollection() *mongo.Collection {
 	return s.Database().Collection(s.cfg.PoolCollection)
 }
@@ -46,6 +57,14 @@ func (s *Service) PoolStatusCollection() *mongo.Collection {
 	return s.Database().Collection(s.cfg.PoolStatusCollection)
 }
 
+func (s *Service) PoolSnapshotCollection() *mongo.Collection {
+	return s.Database().Collection(s.cfg.PoolSnapshotCollection)
+}
+
+func (s *Service) PoolCandleCollection() *mongo.Collection {
+	return s.Database().Collection(s.cfg.PoolCandleCollection)
+}
+
 func (s *Service) BalanceCollection() *mongo.Collection {
 	return s.Database().Collection(s.cfg.BalanceCollection)
 }
@@ -58,26 +77,70 @@ func (s *Service) BannerCollection() *mongo.Collection {
 	return s.Database().Collection(s.cfg.BannerCollection)
 }
 
+func (s *Service) AuditLogCollection() *mongo.Collection {
+	return s.Database().Collection(s.cfg.AuditLogCollection)
+}
+
+const (
+	accountUsernameIndexName       = "username_unique"
+	legacyAccountUsernameIndexName = "username_1"
+)
+
+func isIndexNotFoundError(err error) bool {
+	var cmdErr mongo.CommandError
+	// NamespaceNotFound is returned if the collection does not exist yet.
+	return errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")
+}
+
+// EnsureDBIndexes creates the indexes if they do not exist.
+// It fails if two accounts have the same non-empty username.
 func (s *Service) EnsureDBIndexes(ctx context.Context) ([]string, error) {
 	var res []string
 	for _, x := range []struct {
 		coll *mongo.Collection
 		is   []mongo.IndexModel
 	}{
+		{s.CheckpointCollection(), []mongo.IndexModel{
+			{Keys: bson.D{{schema.CheckpointBlockHeightKey, 1}}},
+		}},
+		{s.StateSnapshotCollection(), []mongo.IndexModel{
+			{Keys: bson.D{{schema.StateSnapshotBlockHeightKey, 1}}},
+		}},
 		{s.AccountCollection(), []mongo.IndexModel{
 			{Keys: bson.D{{schema.AccountAddressKey, 1}}},
-			{Keys: bson.D{{schema.AccountUsernameKey, 1}}},
+			{
+				Keys: bson.D{{schema.AccountUsernameKey, 1}},
+				Options: options.Index().SetName(accountUsernameIndexName).SetUnique(true).
+					SetPartialFilterExpression(bson.M{schema.AccountUsernameKey: bson.M{"$gt": ""}}),
+			},
 		}},
 		{s.AccountStatusCollection(), []mongo.IndexModel{
 			{Keys: bson.D{{schema.AccountStatusAddressKey, 1}}},
 			{Keys: bson.D{{schema.AccountStatusBlockHeightKey, 1}}},
 			{Keys: bson.D{{schema.AccountStatusBlockHeightKey, 1}, {schema.AccountStatusAddressKey, 1}}},
 		}},
+		{s.AccountEventCollection(), []mongo.IndexModel{
+			{Keys: bson.D{{schema.AccountEventBlockHeightKey, 1}, {schema.AccountEventIndexKey, 1}}},
+			{Keys: bson.D{{schema.AccountEventAddressKey, 1}, {schema.AccountEventBlockHeightKey, -1}, {schema.AccountEventIndexKey, -1}}},
+			{Keys: bson.D{{schema.AccountEventAddressKey, 1}, {schema.AccountEventTypeKey, 1}, {schema.AccountEventBlockHeightKey, -1}}},
+			{Keys: bson.D{{schema.AccountEventAddressKey, 1}, {schema.AccountEventPoolIDKey, 1}, {schema.AccountEventBlockHeightKey, -1}}},
+		}},
+		{s.PoolCollection(), []mongo.IndexModel{
+			{Keys: bson.D{{schema.PoolIDKey, 1}}},
+		}},
 		{s.PoolStatusCollection(), []mongo.IndexModel{
 			{Keys: bson.D{{schema.PoolStatusIDKey, 1}}},
 			{Keys: bson.D{{schema.PoolStatusBlockHeightKey, 1}}},
 			{Keys: bson.D{{schema.PoolStatusBlockHeightKey, 1}, {schema.PoolStatusIDKey, 1}}},
 		}},
+		{s.PoolSnapshotCollection(), []mongo.IndexModel{
+			{Keys: bson.D{{schema.PoolSnapshotBlockHeightKey, 1}, {schema.PoolSnapshotIDKey, 1}}},
+			{Keys: bson.D{{schema.PoolSnapshotIDKey, 1}, {schema.PoolSnapshotTimestampKey, 1}}},
+			{Keys: bson.D{{schema.PoolSnapshotTimestampKey, 1}}},
+		}},
+		{s.PoolCandleCollection(), []mongo.IndexModel{
+			{Keys: bson.D{{schema.PoolCandleIDKey, 1}, {schema.PoolCandleResolutionKey, 1}, {schema.PoolCandleTimestampKey, 1}}},
+		}},
 		{s.BalanceCollection(), []mongo.IndexModel{
 			{Keys: bson.D{{schema.BalanceAddressKey, 1}}},
 		}},
@@ -85,13 +148,30 @@ func (s *Service) EnsureDBIndexes(ctx context.Context) ([]string, error) {
 			{Keys: bson.D{{schema.SupplyDenomKey, 1}}},
 		}},
 		{s.BannerCollection(), []mongo.IndexModel{
+			// Banners imported by older versions have no id.
+			{Keys: bson.D{{schema.BannerIDKey, 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
 			{Keys: bson.D{{schema.BannerVisibleAtKey, 1}}},
 			{Keys: bson.D{{schema.BannerStartsAtKey, 1}}},
 			{Keys: bson.D{{schema.BannerEndsAtKey, 1}}},
 		}},
+		{s.AuditLogCollection(), []mongo.IndexModel{
+			{Keys: bson.D{{schema.AuditLogCreatedAtKey, -1}}},
+			{Keys: bson.D{{schema.AuditLogAddressKey, 1}, {schema.AuditLogCreatedAtKey, -1}}},
+			{Keys: bson.D{{schema.AuditLogBannerIDKey, 1}, {schema.AuditLogCreatedAtKey, -1}}},
+		}},
 	} {
+		isAccountColl := x.coll.Name() == s.cfg.AccountCollection
+		if isAccountColl {
+			// Older versions created a non-unique index on usernames.
+			if _, err := x.coll.Indexes().DropOne(ctx, legacyAccountUsernameIndexName); err != nil && !isIndexNotFoundError(err) {
+				return res, fmt.Errorf("drop legacy username index: %w", err)
+			}
+		}
 		names, err := x.coll.Indexes().CreateMany(ctx, x.is)
 		if err != nil {
+			if isAccountColl && mongo.IsDuplicateKeyError(err) {
+				return res, fmt.Errorf("create account indexes, run `gdex migrate usernames` to list duplicate usernames: %w", err)
+			}
 			return res, err
 		}
 		res = append(res, names...)
@@ -99,17 +179,193 @@ func (s *Service) EnsureDBIndexes(ctx context.Context) ([]string, error) {
 	return res, nil
 }
 
+// SupportsTransactions reports whether the server supports transactions,
+// which requires a replica set or a sharded cluster.
+func (s *Service) SupportsTransactions(ctx context.Context) (bool, error) {
+	var res struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := s.Database().RunCommand(ctx, bson.M{"isMaster": 1}).Decode(&res); err != nil {
+		return false, fmt.Errorf("run isMaster: %w", err)
+	}
+	return res.SetName != "" || res.Msg == "isdbgrid", nil
+}
+
+// WithTransaction runs fn in a transaction, retrying it on transient errors.
+// Collections must exist before fn writes to them, which is ensured by EnsureDBIndexes.
+func (s *Service) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	sess, err := s.mc.StartSession()
+	if err != nil {
+		return fmt.Errorf("start session: %w", err)
+	}
+	defer sess.EndSession(ctx)
+	if _, err := sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MigrateBanners gives the banners without an id, imported by older versions,
+// ids derived from them by schema.Banner.DerivedID, and returns the number
+// of banners migrated.
+// A banner identical to one which already has the derived id, e.g. imported
+// twice, is deleted, and a different banner with the same derived id is given
+// the id with a sequence number appended.
+func (s *Service) MigrateBanners(ctx context.Context) (int64, error) {
+	cur, err := s.BannerCollection().Find(ctx, bson.M{
+		schema.BannerIDKey: bson.M{
+			"$in": bson.A{nil, ""},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("find banners: %w", err)
+	}
+	defer cur.Close(ctx)
+	var n int64
+	for cur.Next(ctx) {
+		var b schema.Banner
+		if err := cur.Decode(&b); err != nil {
+			return n, fmt.Errorf("decode banner: %w", err)
+		}
+		filter := bson.M{"_id": cur.Current.Lookup("_id")}
+		id, dup, err := s.bannerMigrationID(ctx, b)
+		if err != nil {
+			return n, fmt.Errorf("derive id of banner starting at %s: %w", b.StartsAt.Format(time.RFC3339), err)
+		}
+		if dup {
+			if _, err := s.BannerCollection().DeleteOne(ctx, filter); err != nil {
+				return n, fmt.Errorf("delete duplicate banner %q: %w", id, err)
+			}
+		} else if _, err := s.BannerCollection().UpdateOne(ctx, filter, bson.M{
+			"$set": bson.M{
+				schema.BannerIDKey: id,
+			},
+		}); err != nil {
+			return n, fmt.Errorf("set id of banner starting at %s: %w", b.StartsAt.Format(time.RFC3339), err)
+		}
+		n++
+	}
+	if err := cur.Err(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// bannerMigrationID returns the id to give the banner without an id,
+// and whether a banner identical to it already has the id.
+func (s *Service) bannerMigrationID(ctx context.Context, b schema.Banner) (string, bool, error) {
+	id := b.DerivedID()
+	for seq := 2; ; seq++ {
+		other, err := s.BannerByID(ctx, id)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return id, false, nil
+		} else if err != nil {
+			return "", false, err
+		}
+		if sameBanner(b, other) {
+			return id, true, nil
+		}
+		id = fmt.Sprintf("%s-%d", b.DerivedID(), seq)
+	}
+}
+
+// sameBanner reports whether the banners have the same contents, regardless of their ids.
+func sameBanner(a, b schema.Banner) bool {
+	return a.UpcomingText == b.UpcomingText && a.Text == b.Text && a.URL == b.URL &&
+		a.VisibleAt.Equal(b.VisibleAt) && a.StartsAt.Equal(b.StartsAt) && a.EndsAt.Equal(b.EndsAt)
+}
+
+// MigrateAmounts rewrites coin amounts stored as numbers by older versions
+// as decimal strings, and returns the number of documents rewritten.
+func (s *Service) MigrateAmounts(ctx context.Context) (int64, error) {
+	var total int64
+	for _, x := range []struct {
+		name   string
+		coll   *mongo.Collection
+		newDoc func() interface{}
+	}{
+		{"balances", s.BalanceCollection(), func() interface{} { return &schema.Balance{} }},
+		{"supplies", s.SupplyCollection(), func() interface{} { return &schema.Supply{} }},
+		{"account events", s.AccountEventCollection(), func() interface{} { return &schema.AccountEvent{} }},
+		{"pool statuses", s.PoolStatusCollection(), func() interface{} { return &schema.PoolStatus{} }},
+		{"pool snapshots", s.PoolSnapshotCollection(), func() interface{} { return &schema.PoolSnapshot{} }},
+		{"pool candles", s.PoolCandleCollection(), func() interface{} { return &schema.PoolCandle{} }},
+	} {
+		n, err := migrateDocuments(ctx, x.coll, x.newDoc)
+		if err != nil {
+			return total, fmt.Errorf("migrate %s: %w", x.name, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// migrateDocuments re-encodes every document in the collection through newDoc's type.
+func migrateDocuments(ctx context.Context, coll *mongo.Collection, newDoc func() interface{}) (int64, error) {
+	const batchSize = 1000
+	cur, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	var n int64
+	var writes []mongo.WriteModel
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		res, err := coll.BulkWrite(ctx, writes)
+		if err != nil {
+			return fmt.Errorf("bulk write: %w", err)
+		}
+		n += res.ModifiedCount
+		writes = nil
+		return nil
+	}
+	for cur.Next(ctx) {
+		doc := newDoc()
+		if err := cur.Decode(doc); err != nil {
+			return n, fmt.Errorf("decode: %w", err)
+		}
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": cur.Current.Lookup("_id")}).
+			SetReplacement(doc))
+		if len(writes) >= batchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
 func (s *Service) LatestBlockHeight(ctx context.Context) (int64, error) {
+	cp, err := s.Checkpoint(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return cp.BlockHeight, nil
+}
+
+// Checkpoint returns the checkpoint, which is zero if the transformer has not
+// committed any block yet.
+func (s *Service) Checkpoint(ctx context.Context) (schema.Checkpoint, error) {
 	var cp schema.Checkpoint
 	if err := s.CheckpointCollection().FindOne(ctx, bson.M{
 		schema.CheckpointBlockHeightKey: bson.M{"$exists": true},
 	}).Decode(&cp); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return 0, nil
+			return schema.Checkpoint{}, nil
 		}
-		return 0, err
+		return schema.Checkpoint{}, err
 	}
-	return cp.BlockHeight, nil
+	return cp, nil
 }
 
 func (s *Service) SetLatestBlockHeight(ctx context.Context, height int64) error {
@@ -120,13 +376,263 @@ func (s *Service) SetLatestBlockHeight(ctx context.Context, height int64) error
 			schema.CheckpointBlockHeightKey: height,
 			schema.CheckpointTimestampKey:   time.Now(),
 		},
+		"$unset": bson.M{
+			schema.CheckpointPendingBlockHeightKey: "",
+			schema.CheckpointPendingSinceKey:       "",
+		},
 	}, options.Update().SetUpsert(true)); err != nil {
 		return err
 	}
+	if _, err := s.CheckpointCollection().UpdateOne(ctx, bson.M{
+		schema.CheckpointRolledBackFromKey: bson.M{"$lte": height},
+	}, bson.M{
+		"$unset": bson.M{
+			schema.CheckpointRolledBackFromKey: "",
+		},
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (s *Service) DeleteOutdatedAccountStatuses(ctx context.Context, currentBlockHeight int64) error {
+// SetPendingCommit marks a commit of the blocks from the time up to the block
+// height as started, until SetLatestBlockHeight marks it as finished.
+func (s *Service) SetPendingCommit(ctx context.Context, height int64, since time.Time) error {
+	if _, err := s.CheckpointCollection().UpdateOne(ctx, bson.M{
+		schema.CheckpointBlockHeightKey: bson.M{"$exists": true},
+	}, bson.M{
+		"$set": bson.M{
+			schema.CheckpointPendingBlockHeightKey: height,
+			schema.CheckpointPendingSinceKey:       since,
+		},
+		"$setOnInsert": bson.M{
+			schema.CheckpointBlockHeightKey: int64(0),
+		},
+	}, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RollbackPendingCommit discards the writes of a commit which has not finished,
+// and reports whether there was one.
+// Since block times only increase, nothing before the commit's first block
+// was written by it.
+func (s *Service) RollbackPendingCommit(ctx context.Context) (bool, error) {
+	cp, err := s.Checkpoint(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get checkpoint: %w", err)
+	}
+	if cp.PendingBlockHeight == 0 {
+		return false, nil
+	}
+	if err := s.Rollback(ctx, schema.StateSnapshot{
+		BlockHeight: cp.BlockHeight,
+		Timestamp:   cp.PendingSince.Add(-time.Nanosecond),
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Service) StateSnapshotBlockHeights(ctx context.Context) ([]int64, error) {
+	cur, err := s.StateSnapshotCollection().Find(ctx, bson.M{},
+		options.Find().SetSort(bson.M{schema.StateSnapshotBlockHeightKey: 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	hs := []int64{}
+	for cur.Next(ctx) {
+		var snapshot schema.StateSnapshot
+		if err := cur.Decode(&snapshot); err != nil {
+			return nil, fmt.Errorf("decode state snapshot: %w", err)
+		}
+		hs = append(hs, snapshot.BlockHeight)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, fmt.Errorf("iterate state snapshots: %w", err)
+	}
+	return hs, nil
+}
+
+// LatestStateSnapshot returns the latest state snapshot taken at or below
+// the block height, or nil if there is none.
+func (s *Service) LatestStateSnapshot(ctx context.Context, maxBlockHeight int64) (*schema.StateSnapshot, error) {
+	var snapshot schema.StateSnapshot
+	if err := s.StateSnapshotCollection().FindOne(ctx, bson.M{
+		schema.StateSnapshotBlockHeightKey: bson.M{"$lte": maxBlockHeight},
+	}, options.FindOne().SetSort(bson.M{schema.StateSnapshotBlockHeightKey: -1})).Decode(&snapshot); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &snapshot, nil
+}
+
+// AddStateSnapshot records the snapshot and forgets the oldest ones
+// beyond retention. Zero retention keeps every snapshot.
+func (s *Service) AddStateSnapshot(ctx context.Context, snapshot schema.StateSnapshot, retention int) error {
+	if _, err := s.StateSnapshotCollection().ReplaceOne(ctx, bson.M{
+		schema.StateSnapshotBlockHeightKey: snapshot.BlockHeight,
+	}, snapshot, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("replace state snapshot: %w", err)
+	}
+	if retention <= 0 {
+		return nil
+	}
+	hs, err := s.StateSnapshotBlockHeights(ctx)
+	if err != nil {
+		return fmt.Errorf("get state snapshot block heights: %w", err)
+	}
+	if len(hs) <= retention {
+		return nil
+	}
+	if _, err := s.StateSnapshotCollection().DeleteMany(ctx, bson.M{
+		schema.StateSnapshotBlockHeightKey: bson.M{"$lte": hs[len(hs)-retention-1]},
+	}); err != nil {
+		return fmt.Errorf("delete state snapshots: %w", err)
+	}
+	return nil
+}
+
+// Rollback discards everything the transformer wrote after the snapshot
+// and resets the checkpoint to the snapshot's block height.
+// Candles overlapping the snapshot's timestamp are discarded as a whole,
+// since they can't be split into before and after the snapshot.
+// Balances, supplies and pools only have their latest state, so they are kept
+// as they are, and the checkpoint records the block height they are at
+// until the transformer replays up to it.
+func (s *Service) Rollback(ctx context.Context, snapshot schema.StateSnapshot) error {
+	h := snapshot.BlockHeight
+	cp, err := s.Checkpoint(ctx)
+	if err != nil {
+		return fmt.Errorf("get checkpoint: %w", err)
+	}
+	rolledBackFrom := cp.BlockHeight
+	for _, x := range []int64{cp.PendingBlockHeight, cp.RolledBackFrom} {
+		if x > rolledBackFrom {
+			rolledBackFrom = x
+		}
+	}
+	for _, x := range []struct {
+		name   string
+		coll   *mongo.Collection
+		filter bson.M
+	}{
+		{"account statuses", s.AccountStatusCollection(), bson.M{schema.AccountStatusBlockHeightKey: bson.M{"$gt": h}}},
+		{"pool statuses", s.PoolStatusCollection(), bson.M{schema.PoolStatusBlockHeightKey: bson.M{"$gt": h}}},
+		{"account events", s.AccountEventCollection(), bson.M{schema.AccountEventBlockHeightKey: bson.M{"$gt": h}}},
+		{"pool snapshots", s.PoolSnapshotCollection(), bson.M{schema.PoolSnapshotBlockHeightKey: bson.M{"$gt": h}}},
+		{"pool candles", s.PoolCandleCollection(), bson.M{schema.PoolCandleTimestampKey: bson.M{"$gt": snapshot.Timestamp}}},
+		{"state snapshots", s.StateSnapshotCollection(), bson.M{schema.StateSnapshotBlockHeightKey: bson.M{"$gt": h}}},
+	} {
+		if _, err := x.coll.DeleteMany(ctx, x.filter); err != nil {
+			return fmt.Errorf("delete %s: %w", x.name, err)
+		}
+	}
+	if err := s.rebuildOpenPoolCandles(ctx, snapshot); err != nil {
+		return fmt.Errorf("rebuild pool candles: %w", err)
+	}
+	if err := s.SetLatestBlockHeight(ctx, h); err != nil {
+		return fmt.Errorf("set latest block height: %w", err)
+	}
+	if rolledBackFrom > h {
+		if _, err := s.CheckpointCollection().UpdateOne(ctx, bson.M{
+			schema.CheckpointBlockHeightKey: bson.M{"$exists": true},
+		}, bson.M{
+			"$set": bson.M{
+				schema.CheckpointRolledBackFromKey: rolledBackFrom,
+			},
+		}); err != nil {
+			return fmt.Errorf("set rolled back block height: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebuildOpenPoolCandles rebuilds candles whose window contains the snapshot's
+// timestamp from the swap events at or below the snapshot's block height,
+// since those candles may include swaps after the snapshot.
+// Candles without such swaps are deleted.
+func (s *Service) rebuildOpenPoolCandles(ctx context.Context, snapshot schema.StateSnapshot) error {
+	cur, err := s.PoolCandleCollection().Find(ctx, bson.M{
+		schema.PoolCandleTimestampKey: bson.M{"$lte": snapshot.Timestamp},
+		"$expr": bson.M{
+			"$gt": bson.A{
+				bson.M{"$add": bson.A{"$" + schema.PoolCandleTimestampKey, bson.M{"$multiply": bson.A{"$" + schema.PoolCandleResolutionKey, 1000}}}},
+				snapshot.Timestamp,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("find pool candles: %w", err)
+	}
+	var candles []schema.PoolCandle
+	if err := cur.All(ctx, &candles); err != nil {
+		return fmt.Errorf("decode pool candles: %w", err)
+	}
+	reserveCoinDenomsByPoolID := make(map[uint64][]string)
+	for _, c := range candles {
+		denoms, ok := reserveCoinDenomsByPoolID[c.ID]
+		if !ok {
+			// The pool may not have been written by an unfinished commit.
+			var pool schema.Pool
+			if err := s.PoolCollection().FindOne(ctx, bson.M{schema.PoolIDKey: c.ID}).Decode(&pool); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				return fmt.Errorf("find pool %d: %w", c.ID, err)
+			}
+			denoms = pool.ReserveCoinDenoms
+			reserveCoinDenomsByPoolID[c.ID] = denoms
+		}
+		cur, err := s.AccountEventCollection().Find(ctx, bson.M{
+			schema.AccountEventBlockHeightKey: bson.M{"$lte": snapshot.BlockHeight},
+			schema.AccountEventTypeKey:        schema.AccountEventTypeSwap,
+			schema.AccountEventPoolIDKey:      c.ID,
+			schema.AccountEventTimestampKey:   bson.M{"$gte": c.Timestamp},
+		}, options.Find().SetSort(bson.D{
+			{schema.AccountEventBlockHeightKey, 1},
+			{schema.AccountEventIndexKey, 1},
+		}))
+		if err != nil {
+			return fmt.Errorf("find swap events: %w", err)
+		}
+		var events []schema.AccountEvent
+		if err := cur.All(ctx, &events); err != nil {
+			return fmt.Errorf("decode swap events: %w", err)
+		}
+		candle := schema.PoolCandle{ID: c.ID, Resolution: c.Resolution, Timestamp: c.Timestamp}
+		for _, evt := range events {
+			price, err := strconv.ParseFloat(evt.SwapPrice, 64)
+			if err != nil {
+				return fmt.Errorf("parse swap price: %w", err)
+			}
+			offerCoin, demandCoin := evt.Coins[0], evt.Coins[1]
+			volumeX, volumeY := offerCoin.Amount, demandCoin.Amount
+			if len(denoms) > 0 && offerCoin.Denom != denoms[0] {
+				volumeX, volumeY = volumeY, volumeX
+			}
+			candle.Update(price, volumeX, volumeY)
+		}
+		filter := bson.M{
+			schema.PoolCandleIDKey:         c.ID,
+			schema.PoolCandleResolutionKey: c.Resolution,
+			schema.PoolCandleTimestampKey:  c.Timestamp,
+		}
+		if candle.NumSwaps == 0 {
+			if _, err := s.PoolCandleCollection().DeleteOne(ctx, filter); err != nil {
+				return fmt.Errorf("delete pool candle: %w", err)
+			}
+			continue
+		}
+		if _, err := s.PoolCandleCollection().ReplaceOne(ctx, filter, candle); err != nil {
+			return fmt.Errorf("replace pool candle: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) DeleteOutdatedAccountStatuses(ctx context.Context, currentBlockHeight int64, retainedBlockHeights []int64) error {
 	if _, err := s.AccountStatusCollection().DeleteMany(ctx, bson.M{
 		"$or": bson.A{
 			bson.M{
@@ -136,13 +642,14 @@ func (s *Service) DeleteOutdatedAccountStatuses(ctx context.Context, currentBloc
 				schema.AccountStatusBlockHeightKey: bson.M{"$gt": currentBlockHeight + 1},
 			},
 		},
+		schema.AccountStatusBlockHeightKey: bson.M{"$nin": retainedBlockHeights},
 	}); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Service) DeleteOutdatedPoolStatuses(ctx context.Context, currentBlockHeight int64) error {
+func (s *Service) DeleteOutdatedPoolStatuses(ctx context.Context, currentBlockHeight int64, retainedBlockHeights []int64) error {
 	if _, err := s.PoolStatusCollection().DeleteMany(ctx, bson.M{
 		"$or": bson.A{
 			bson.M{
@@ -152,6 +659,7 @@ func (s *Service) DeleteOutdatedPoolStatuses(ctx context.Context, currentBlockHe
 				schema.PoolStatusBlockHeightKey: bson.M{"$gt": currentBlockHeight + 1},
 			},
 		},
+		schema.PoolStatusBlockHeightKey: bson.M{"$nin": retainedBlockHeights},
 	}); err != nil {
 		return err
 	}
@@ -180,6 +688,256 @@ func (s *Service) PoolStatus(ctx context.Context, blockHeight int64, id uint64)
 	return poolStatus, nil
 }
 
+// AccountEvents returns the account's events below beforeBlockHeight in descending order.
+// Events at the same block height are never split between pages, so the result
+// may contain more than limit events. hasMore reports whether older events may exist.
+func (s *Service) AccountEvents(ctx context.Context, address string, typ schema.AccountEventType, poolID uint64, beforeBlockHeight int64, limit int) (events []schema.AccountEvent, hasMore bool, err error) {
+	filter := bson.M{
+		schema.AccountEventAddressKey: address,
+	}
+	if typ != "" {
+		filter[schema.AccountEventTypeKey] = typ
+	}
+	if poolID != 0 {
+		filter[schema.AccountEventPoolIDKey] = poolID
+	}
+	if beforeBlockHeight > 0 {
+		filter[schema.AccountEventBlockHeightKey] = bson.M{"$lt": beforeBlockHeight}
+	}
+	events, err = s.findAccountEvents(ctx, filter, int64(limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(events) <= limit {
+		return events, false, nil
+	}
+	boundary := events[limit].BlockHeight
+	events = events[:limit]
+	for len(events) > 0 && events[len(events)-1].BlockHeight == boundary {
+		events = events[:len(events)-1]
+	}
+	if len(events) == 0 { // a single block has more events than limit
+		filter[schema.AccountEventBlockHeightKey] = boundary
+		events, err = s.findAccountEvents(ctx, filter, 0)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return events, true, nil
+}
+
+func (s *Service) findAccountEvents(ctx context.Context, filter bson.M, limit int64) ([]schema.AccountEvent, error) {
+	opts := options.Find().SetSort(bson.D{
+		{schema.AccountEventBlockHeightKey, -1},
+		{schema.AccountEventIndexKey, -1},
+	})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := s.AccountEventCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find account events: %w", err)
+	}
+	defer cur.Close(ctx)
+	var events []schema.AccountEvent
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("decode account events: %w", err)
+	}
+	return events, nil
+}
+
+func (s *Service) LatestPoolSnapshot(ctx context.Context) (*schema.PoolSnapshot, error) {
+	var snapshot schema.PoolSnapshot
+	if err := s.PoolSnapshotCollection().FindOne(ctx, bson.M{},
+		options.FindOne().SetSort(bson.M{schema.PoolSnapshotBlockHeightKey: -1})).Decode(&snapshot); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &snapshot, nil
+}
+
+// SetPoolSnapshotPrices sets the prices of snapshots taken since the given time
+// which have no prices yet, and returns the number of snapshots updated.
+func (s *Service) SetPoolSnapshotPrices(ctx context.Context, since time.Time, priceTable map[string]float64) (int, error) {
+	return s.setPoolSnapshotPrices(ctx, bson.M{
+		schema.PoolSnapshotTimestampKey: bson.M{"$gte": since},
+		schema.PoolSnapshotPricesKey:    bson.M{"$exists": false},
+	}, func(snapshot schema.PoolSnapshot) (map[string]float64, bool) {
+		prices := map[string]float64{
+			snapshot.PoolCoin.Denom: priceTable[snapshot.PoolCoin.Denom],
+		}
+		for _, rc := range snapshot.ReserveCoins {
+			prices[rc.Denom] = priceTable[rc.Denom]
+		}
+		return prices, true
+	})
+}
+
+// BackfillPoolSnapshotPrices sets the prices of all snapshots which have no prices
+// yet from the prices of the reserve coins at the time of the snapshots,
+// and returns the number of snapshots updated.
+// The pool coin's price is derived from the snapshot's reserve coins.
+// Snapshots with a reserve coin without a price are left as they are.
+func (s *Service) BackfillPoolSnapshotPrices(ctx context.Context, priceAt func(denom string, t time.Time) (float64, bool)) (int, error) {
+	return s.setPoolSnapshotPrices(ctx, bson.M{
+		schema.PoolSnapshotPricesKey: bson.M{"$exists": false},
+	}, func(snapshot schema.PoolSnapshot) (map[string]float64, bool) {
+		prices := make(map[string]float64)
+		sum := 0.0
+		for _, rc := range snapshot.ReserveCoins {
+			p, ok := priceAt(rc.Denom, snapshot.Timestamp)
+			if !ok {
+				return nil, false
+			}
+			prices[rc.Denom] = p
+			sum += p * rc.Amount.Float64()
+		}
+		prices[snapshot.PoolCoin.Denom] = 0
+		if amt := snapshot.PoolCoin.Amount.Float64(); amt > 0 {
+			prices[snapshot.PoolCoin.Denom] = sum / amt
+		}
+		return prices, true
+	})
+}
+
+func (s *Service) setPoolSnapshotPrices(ctx context.Context, filter bson.M, pricesOf func(snapshot schema.PoolSnapshot) (map[string]float64, bool)) (int, error) {
+	cur, err := s.PoolSnapshotCollection().Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("find pool snapshots: %w", err)
+	}
+	defer cur.Close(ctx)
+	var writes []mongo.WriteModel
+	for cur.Next(ctx) {
+		var snapshot schema.PoolSnapshot
+		if err := cur.Decode(&snapshot); err != nil {
+			return 0, fmt.Errorf("decode pool snapshot: %w", err)
+		}
+		prices, ok := pricesOf(snapshot)
+		if !ok {
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				schema.PoolSnapshotBlockHeightKey: snapshot.BlockHeight,
+				schema.PoolSnapshotIDKey:          snapshot.ID,
+			}).
+			SetUpdate(bson.M{
+				"$set": bson.M{
+					schema.PoolSnapshotPricesKey: prices,
+				},
+			}))
+	}
+	if err := cur.Err(); err != nil {
+		return 0, fmt.Errorf("iterate pool snapshots: %w", err)
+	}
+	if len(writes) == 0 {
+		return 0, nil
+	}
+	if _, err := s.PoolSnapshotCollection().BulkWrite(ctx, writes); err != nil {
+		return 0, fmt.Errorf("bulk write: %w", err)
+	}
+	return len(writes), nil
+}
+
+// PoolSnapshots returns the pool's snapshots taken in [from, to] in ascending order,
+// preceded by the last snapshot taken before from if there is one.
+func (s *Service) PoolSnapshots(ctx context.Context, id uint64, from, to time.Time) ([]schema.PoolSnapshot, error) {
+	var snapshots []schema.PoolSnapshot
+	var prev schema.PoolSnapshot
+	if err := s.PoolSnapshotCollection().FindOne(ctx, bson.M{
+		schema.PoolSnapshotIDKey:        id,
+		schema.PoolSnapshotTimestampKey: bson.M{"$lt": from},
+	}, options.FindOne().SetSort(bson.M{schema.PoolSnapshotTimestampKey: -1})).Decode(&prev); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("find previous pool snapshot: %w", err)
+		}
+	} else {
+		snapshots = append(snapshots, prev)
+	}
+	cur, err := s.PoolSnapshotCollection().Find(ctx, bson.M{
+		schema.PoolSnapshotIDKey: id,
+		schema.PoolSnapshotTimestampKey: bson.M{
+			"$gte": from,
+			"$lte": to,
+		},
+	}, options.Find().SetSort(bson.M{schema.PoolSnapshotTimestampKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("find pool snapshots: %w", err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var snapshot schema.PoolSnapshot
+		if err := cur.Decode(&snapshot); err != nil {
+			return nil, fmt.Errorf("decode pool snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, cur.Err()
+}
+
+func (s *Service) PoolCandle(ctx context.Context, id uint64, resolution int64, timestamp time.Time) (schema.PoolCandle, error) {
+	var candle schema.PoolCandle
+	if err := s.PoolCandleCollection().FindOne(ctx, bson.M{
+		schema.PoolCandleIDKey:         id,
+		schema.PoolCandleResolutionKey: resolution,
+		schema.PoolCandleTimestampKey:  timestamp,
+	}).Decode(&candle); err != nil {
+		return schema.PoolCandle{}, err
+	}
+	return candle, nil
+}
+
+func (s *Service) PoolCandles(ctx context.Context, id uint64, resolution time.Duration, from, to time.Time) ([]schema.PoolCandle, error) {
+	cur, err := s.PoolCandleCollection().Find(ctx, bson.M{
+		schema.PoolCandleIDKey:         id,
+		schema.PoolCandleResolutionKey: int64(resolution / time.Second),
+		schema.PoolCandleTimestampKey: bson.M{
+			"$gte": from,
+			"$lte": to,
+		},
+	}, options.Find().SetSort(bson.M{schema.PoolCandleTimestampKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("find pool candles: %w", err)
+	}
+	defer cur.Close(ctx)
+	var candles []schema.PoolCandle
+	if err := cur.All(ctx, &candles); err != nil {
+		return nil, fmt.Errorf("decode pool candles: %w", err)
+	}
+	return candles, nil
+}
+
+// DuplicateUsername is a username shared by several accounts.
+type DuplicateUsername struct {
+	Username  string   `bson:"_id"`
+	Addresses []string `bson:"addresses"`
+}
+
+// DuplicateUsernames returns the non-empty usernames shared by several accounts,
+// which must be renamed before the unique index on usernames can be created.
+func (s *Service) DuplicateUsernames(ctx context.Context) ([]DuplicateUsername, error) {
+	cur, err := s.AccountCollection().Aggregate(ctx, mongo.Pipeline{
+		{{"$match", bson.M{schema.AccountUsernameKey: bson.M{"$gt": ""}}}},
+		{{"$sort", bson.M{schema.AccountAddressKey: 1}}},
+		{{"$group", bson.M{
+			"_id":       "$" + schema.AccountUsernameKey,
+			"addresses": bson.M{"$push": "$" + schema.AccountAddressKey},
+		}}},
+		{{"$match", bson.M{"addresses.1": bson.M{"$exists": true}}}},
+		{{"$sort", bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var dups []DuplicateUsername
+	if err := cur.All(ctx, &dups); err != nil {
+		return nil, fmt.Errorf("decode duplicate usernames: %w", err)
+	}
+	return dups, nil
+}
+
 func (s *Service) AccountByUsername(ctx context.Context, username string) (schema.Account, error) {
 	var acc schema.Account
 	if err := s.AccountCollection().FindOne(ctx, bson.M{
@@ -190,6 +948,89 @@ func (s *Service) AccountByUsername(ctx context.Context, username string) (schem
 	return acc, nil
 }
 
+func (s *Service) AccountByAddress(ctx context.Context, address string) (schema.Account, error) {
+	var acc schema.Account
+	if err := s.AccountCollection().FindOne(ctx, bson.M{
+		schema.AccountAddressKey: address,
+	}).Decode(&acc); err != nil {
+		return schema.Account{}, err
+	}
+	return acc, nil
+}
+
+// BlockedAccounts returns the blocked accounts, most recently blocked first.
+func (s *Service) BlockedAccounts(ctx context.Context) ([]schema.Account, error) {
+	cur, err := s.AccountCollection().Find(ctx, bson.M{
+		schema.AccountIsBlockedKey: true,
+	}, options.Find().SetSort(bson.M{schema.AccountBlockedAtKey: -1}))
+	if err != nil {
+		return nil, fmt.Errorf("find accounts: %w", err)
+	}
+	defer cur.Close(ctx)
+	var accs []schema.Account
+	if err := cur.All(ctx, &accs); err != nil {
+		return nil, fmt.Errorf("decode accounts: %w", err)
+	}
+	return accs, nil
+}
+
+// SetAccountBlocked blocks or unblocks the account.
+// It returns mongo.ErrNoDocuments if there is no such account, or if the
+// account is already blocked or unblocked.
+func (s *Service) SetAccountBlocked(ctx context.Context, address string, blocked bool, reason string, now time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			schema.AccountIsBlockedKey:   true,
+			schema.AccountBlockedAtKey:   now,
+			schema.AccountBlockReasonKey: reason,
+		},
+	}
+	if !blocked {
+		update = bson.M{
+			"$set": bson.M{
+				schema.AccountIsBlockedKey: false,
+			},
+			"$unset": bson.M{
+				schema.AccountBlockedAtKey:   "",
+				schema.AccountBlockReasonKey: "",
+			},
+		}
+	}
+	filter := bson.M{
+		schema.AccountAddressKey: address,
+		schema.AccountIsBlockedKey: bson.M{
+			"$ne": true,
+		},
+	}
+	if !blocked {
+		filter[schema.AccountIsBlockedKey] = true
+	}
+	res, err := s.AccountCollection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetAccountUsername changes the username of the account, and returns
+// the old one.
+func (s *Service) SetAccountUsername(ctx context.Context, address, username string) (string, error) {
+	var acc schema.Account
+	if err := s.AccountCollection().FindOneAndUpdate(ctx, bson.M{
+		schema.AccountAddressKey: address,
+	}, bson.M{
+		"$set": bson.M{
+			schema.AccountUsernameKey: username,
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&acc); err != nil {
+		return "", err
+	}
+	return acc.Username, nil
+}
+
 func (s *Service) IterateAccounts(ctx context.Context, blockHeight int64, cb func(schema.Account) (stop bool, err error)) error {
 	cur, err := s.AccountCollection().Aggregate(ctx, bson.A{
 		bson.M{
@@ -326,3 +1167,188 @@ func (s *Service) Banner(ctx context.Context, now time.Time) (*schema.Banner, er
 	}
 	return &b, nil
 }
+
+// InsertAuditLog inserts the log and returns its id.
+func (s *Service) InsertAuditLog(ctx context.Context, log schema.AuditLog) (primitive.ObjectID, error) {
+	res, err := s.AuditLogCollection().InsertOne(ctx, log)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return res.InsertedID.(primitive.ObjectID), nil
+}
+
+// ReplaceAuditLog replaces the log with the same id.
+func (s *Service) ReplaceAuditLog(ctx context.Context, log schema.AuditLog) error {
+	_, err := s.AuditLogCollection().ReplaceOne(ctx, bson.M{
+		schema.AuditLogIDKey: log.ID,
+	}, log)
+	return err
+}
+
+// WithAuditLog records the change made by fn in the log. The log is inserted
+// as pending before fn is called, so that no change is made without its log,
+// and marked done after fn returns. fn may fill in the log.
+// If fn fails without making the change, e.g. with mongo.ErrNoDocuments,
+// the log is deleted. Otherwise, as when the process dies in the middle,
+// the log remains pending since the change may or may not have been made.
+func (s *Service) WithAuditLog(ctx context.Context, log schema.AuditLog, fn func(log *schema.AuditLog) error) error {
+	log.Pending = true
+	id, err := s.InsertAuditLog(ctx, log)
+	if err != nil {
+		return fmt.Errorf("insert audit log: %w", err)
+	}
+	log.ID = id
+	if err := fn(&log); err != nil {
+		if changeNotMade(err) {
+			// A log which cannot be deleted remains pending, which is still true.
+			_ = s.DeleteAuditLog(ctx, id)
+		}
+		return err
+	}
+	log.Pending = false
+	if err := s.ReplaceAuditLog(ctx, log); err != nil {
+		return fmt.Errorf("mark audit log done: %w", err)
+	}
+	return nil
+}
+
+// changeNotMade reports whether the error tells that a change has not been made at all.
+func changeNotMade(err error) bool {
+	var overlapErr *BannerOverlapError
+	return errors.Is(err, mongo.ErrNoDocuments) || mongo.IsDuplicateKeyError(err) || errors.As(err, &overlapErr)
+}
+
+func (s *Service) DeleteAuditLog(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.AuditLogCollection().DeleteOne(ctx, bson.M{
+		schema.AuditLogIDKey: id,
+	})
+	return err
+}
+
+// AuditLogs returns the latest audit logs, optionally of an account or a banner only.
+func (s *Service) AuditLogs(ctx context.Context, address, bannerID string, limit int) ([]schema.AuditLog, error) {
+	filter := bson.M{}
+	if address != "" {
+		filter[schema.AuditLogAddressKey] = address
+	}
+	if bannerID != "" {
+		filter[schema.AuditLogBannerIDKey] = bannerID
+	}
+	cur, err := s.AuditLogCollection().Find(ctx, filter,
+		options.Find().SetSort(bson.M{schema.AuditLogCreatedAtKey: -1}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("find audit logs: %w", err)
+	}
+	defer cur.Close(ctx)
+	var logs []schema.AuditLog
+	if err := cur.All(ctx, &logs); err != nil {
+		return nil, fmt.Errorf("decode audit logs: %w", err)
+	}
+	return logs, nil
+}
+
+// Banners returns all banners sorted by the start time.
+func (s *Service) Banners(ctx context.Context) ([]schema.Banner, error) {
+	cur, err := s.BannerCollection().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{schema.BannerStartsAtKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("find banners: %w", err)
+	}
+	defer cur.Close(ctx)
+	var bs []schema.Banner
+	if err := cur.All(ctx, &bs); err != nil {
+		return nil, fmt.Errorf("decode banners: %w", err)
+	}
+	return bs, nil
+}
+
+func (s *Service) BannerByID(ctx context.Context, id string) (schema.Banner, error) {
+	var b schema.Banner
+	if err := s.BannerCollection().FindOne(ctx, bson.M{
+		schema.BannerIDKey: id,
+	}).Decode(&b); err != nil {
+		return schema.Banner{}, err
+	}
+	return b, nil
+}
+
+// BannerOverlapError is returned when a banner is visible at the same time
+// as other banners.
+type BannerOverlapError struct {
+	ID     string
+	Others []schema.Banner
+}
+
+func (err *BannerOverlapError) Error() string {
+	var others []string
+	for _, b := range err.Others {
+		if b.ID == "" {
+			others = append(others, fmt.Sprintf("a banner without id starting at %s", b.StartsAt.Format(time.RFC3339)))
+		} else {
+			others = append(others, strconv.Quote(b.ID))
+		}
+	}
+	return fmt.Sprintf("banner %q overlaps %s", err.ID, strings.Join(others, ", "))
+}
+
+// CheckBannerOverlaps returns *BannerOverlapError if any of the banners
+// overlaps another one of them, or a saved banner which is not replaced by them.
+func (s *Service) CheckBannerOverlaps(ctx context.Context, bs []schema.Banner) error {
+	saved, err := s.Banners(ctx)
+	if err != nil {
+		return fmt.Errorf("get banners: %w", err)
+	}
+	ids := make(map[string]struct{})
+	for _, b := range bs {
+		ids[b.ID] = struct{}{}
+	}
+	all := append([]schema.Banner{}, bs...)
+	for _, b := range saved {
+		if _, ok := ids[b.ID]; !ok {
+			all = append(all, b)
+		}
+	}
+	for i, b := range bs {
+		var others []schema.Banner
+		for j, other := range all {
+			if j != i && b.Overlaps(other) {
+				others = append(others, other)
+			}
+		}
+		if len(others) > 0 {
+			return &BannerOverlapError{ID: b.ID, Others: others}
+		}
+	}
+	return nil
+}
+
+// SaveBanner inserts the banner, or replaces the banner with the same id.
+// Unless allowOverlap is set, it returns *BannerOverlapError if the banner
+// overlaps others. It reports whether the banner has been inserted.
+func (s *Service) SaveBanner(ctx context.Context, b schema.Banner, allowOverlap bool) (created bool, err error) {
+	if !allowOverlap {
+		if err := s.CheckBannerOverlaps(ctx, []schema.Banner{b}); err != nil {
+			return false, err
+		}
+	}
+	res, err := s.BannerCollection().ReplaceOne(ctx, bson.M{
+		schema.BannerIDKey: b.ID,
+	}, b, options.Replace().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+// DeleteBanner returns mongo.ErrNoDocuments if there is no such banner.
+func (s *Service) DeleteBanner(ctx context.Context, id string) error {
+	res, err := s.BannerCollection().DeleteOne(ctx, bson.M{
+		schema.BannerIDKey: id,
+	})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
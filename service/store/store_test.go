@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"os"
 	"testing"
 	"time"
 
@@ -10,21 +11,32 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"github.com/b-harvest/gravity-dex-backend/config"
 	"github.com/b-harvest/gravity-dex-backend/schema"
 )
 
-func TestService_Banner(t *testing.T) {
-	cfg := config.DefaultMongoDBConfig
-	cfg.DB = "test"
-
-	mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.URI))
+func newTestService(t *testing.T) *Service {
+	uri := os.Getenv("GDEX_TEST_MONGODB_URI")
+	if uri == "" {
+		uri = "mongodb://localhost"
+	}
+	mc, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
 	require.NoError(t, err)
-	defer mc.Disconnect(context.Background())
+	t.Cleanup(func() { mc.Disconnect(context.Background()) })
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := mc.Ping(ctx, nil); err != nil {
+		t.Skipf("mongodb is not available: %v", err)
+	}
+
+	cfg := DefaultConfig
+	cfg.DB = "test"
+	return NewService(cfg, mc)
+}
 
-	s := NewService(config.DefaultMongoDBConfig, mc)
+func TestService_Banner(t *testing.T) {
+	s := newTestService(t)
 
-	err = s.BannerCollection().Drop(context.Background())
+	err := s.BannerCollection().Drop(context.Background())
 	require.NoError(t, err)
 
 	_, err = s.BannerCollection().InsertMany(context.Background(), bson.A{
@@ -74,3 +86,555 @@ func TestService_Banner(t *testing.T) {
 		}
 	}
 }
+
+func TestService_SetAccountBlocked(t *testing.T) {
+	s := newTestService(t)
+
+	err := s.AccountCollection().Drop(context.Background())
+	require.NoError(t, err)
+
+	_, err = s.AccountCollection().InsertMany(context.Background(), bson.A{
+		schema.Account{Address: "cosmos1a", Username: "alice"},
+		schema.Account{Address: "cosmos1b", Username: "bob"},
+	})
+	require.NoError(t, err)
+
+	now := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	err = s.SetAccountBlocked(context.Background(), "cosmos1a", true, "cheating", now)
+	require.NoError(t, err)
+	err = s.SetAccountBlocked(context.Background(), "cosmos1a", true, "cheating", now)
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+	err = s.SetAccountBlocked(context.Background(), "cosmos1b", false, "mistake", now)
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+	err = s.SetAccountBlocked(context.Background(), "cosmos1c", true, "cheating", now)
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+
+	accs, err := s.BlockedAccounts(context.Background())
+	require.NoError(t, err)
+	require.Len(t, accs, 1)
+	require.Equal(t, "cosmos1a", accs[0].Address)
+	require.Equal(t, "cheating", accs[0].BlockReason)
+	require.True(t, now.Equal(*accs[0].BlockedAt))
+
+	err = s.SetAccountBlocked(context.Background(), "cosmos1a", false, "mistake", now)
+	require.NoError(t, err)
+	acc, err := s.AccountByAddress(context.Background(), "cosmos1a")
+	require.NoError(t, err)
+	require.False(t, acc.IsBlocked)
+	require.Nil(t, acc.BlockedAt)
+	require.Empty(t, acc.BlockReason)
+
+	old, err := s.SetAccountUsername(context.Background(), "cosmos1b", "robert")
+	require.NoError(t, err)
+	require.Equal(t, "bob", old)
+	acc, err = s.AccountByUsername(context.Background(), "robert")
+	require.NoError(t, err)
+	require.Equal(t, "cosmos1b", acc.Address)
+}
+
+func TestService_AccountUsernameUnique(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	err := s.AccountCollection().Drop(ctx)
+	require.NoError(t, err)
+	// The non-unique index created by older versions is replaced.
+	_, err = s.AccountCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{schema.AccountUsernameKey, 1}},
+	})
+	require.NoError(t, err)
+	_, err = s.AccountCollection().InsertMany(ctx, bson.A{
+		schema.Account{Address: "cosmos1a", Username: "alice"},
+		schema.Account{Address: "cosmos1b", Username: "bob"},
+		schema.Account{Address: "cosmos1c"},
+		schema.Account{Address: "cosmos1d"},
+	})
+	require.NoError(t, err)
+	_, err = s.EnsureDBIndexes(ctx)
+	require.NoError(t, err)
+	_, err = s.EnsureDBIndexes(ctx)
+	require.NoError(t, err)
+
+	_, err = s.SetAccountUsername(ctx, "cosmos1b", "alice")
+	require.True(t, mongo.IsDuplicateKeyError(err))
+	_, err = s.SetAccountUsername(ctx, "cosmos1c", "carol")
+	require.NoError(t, err)
+	_, err = s.AccountCollection().InsertOne(ctx, schema.Account{Address: "cosmos1e"})
+	require.NoError(t, err)
+
+	cur, err := s.AccountCollection().Indexes().List(ctx)
+	require.NoError(t, err)
+	var indexes []struct {
+		Name string `bson:"name"`
+	}
+	require.NoError(t, cur.All(ctx, &indexes))
+	for _, idx := range indexes {
+		require.NotEqual(t, legacyAccountUsernameIndexName, idx.Name)
+	}
+}
+
+func TestService_DuplicateUsernames(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	err := s.AccountCollection().Drop(ctx)
+	require.NoError(t, err)
+	_, err = s.AccountCollection().InsertMany(ctx, bson.A{
+		schema.Account{Address: "cosmos1c", Username: "alice"},
+		schema.Account{Address: "cosmos1a", Username: "alice"},
+		schema.Account{Address: "cosmos1b", Username: "bob"},
+		schema.Account{Address: "cosmos1d"},
+		schema.Account{Address: "cosmos1e"},
+	})
+	require.NoError(t, err)
+
+	dups, err := s.DuplicateUsernames(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []DuplicateUsername{
+		{Username: "alice", Addresses: []string{"cosmos1a", "cosmos1c"}},
+	}, dups)
+	_, err = s.EnsureDBIndexes(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "gdex migrate usernames")
+
+	_, err = s.SetAccountUsername(ctx, "cosmos1c", "carol")
+	require.NoError(t, err)
+	dups, err = s.DuplicateUsernames(ctx)
+	require.NoError(t, err)
+	require.Empty(t, dups)
+	_, err = s.EnsureDBIndexes(ctx)
+	require.NoError(t, err)
+}
+
+func TestService_WithAuditLog(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	err := s.AuditLogCollection().Drop(ctx)
+	require.NoError(t, err)
+	_, err = s.EnsureDBIndexes(ctx)
+	require.NoError(t, err)
+
+	newLog := func(address string) schema.AuditLog {
+		return schema.AuditLog{
+			Actor:       "alice",
+			Action:      schema.AuditLogActionRenameAccount,
+			Address:     address,
+			NewUsername: "robert",
+			CreatedAt:   time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC),
+		}
+	}
+	logs := func(address string) []schema.AuditLog {
+		logs, err := s.AuditLogs(ctx, address, "", 10)
+		require.NoError(t, err)
+		return logs
+	}
+
+	// The log is pending while the change is being made.
+	err = s.WithAuditLog(ctx, newLog("cosmos1a"), func(log *schema.AuditLog) error {
+		pending := logs("cosmos1a")
+		require.Len(t, pending, 1)
+		require.True(t, pending[0].Pending)
+		log.OldUsername = "bob"
+		return nil
+	})
+	require.NoError(t, err)
+	done := logs("cosmos1a")
+	require.Len(t, done, 1)
+	require.False(t, done[0].Pending)
+	require.Equal(t, "bob", done[0].OldUsername)
+
+	// The log of a change which has not been made is deleted.
+	err = s.WithAuditLog(ctx, newLog("cosmos1b"), func(*schema.AuditLog) error {
+		return mongo.ErrNoDocuments
+	})
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+	require.Empty(t, logs("cosmos1b"))
+
+	// The log of a change which may have been made remains pending.
+	err = s.WithAuditLog(ctx, newLog("cosmos1c"), func(*schema.AuditLog) error {
+		return context.DeadlineExceeded
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	pending := logs("cosmos1c")
+	require.Len(t, pending, 1)
+	require.True(t, pending[0].Pending)
+}
+
+func TestService_SaveBanner(t *testing.T) {
+	s := newTestService(t)
+
+	err := s.BannerCollection().Drop(context.Background())
+	require.NoError(t, err)
+
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	b1 := schema.Banner{ID: "event-1", Text: "event 1", VisibleAt: t0, StartsAt: t0, EndsAt: t0.Add(time.Hour)}
+	created, err := s.SaveBanner(context.Background(), b1, false)
+	require.NoError(t, err)
+	require.True(t, created)
+
+	// Saving the same banner again replaces it.
+	b1.Text = "event 1 updated"
+	created, err = s.SaveBanner(context.Background(), b1, false)
+	require.NoError(t, err)
+	require.False(t, created)
+
+	b2 := schema.Banner{ID: "event-2", Text: "event 2", VisibleAt: t0.Add(30 * time.Minute), StartsAt: t0.Add(time.Hour), EndsAt: t0.Add(2 * time.Hour)}
+	_, err = s.SaveBanner(context.Background(), b2, false)
+	var overlapErr *BannerOverlapError
+	require.ErrorAs(t, err, &overlapErr)
+	require.Equal(t, "event-2", overlapErr.ID)
+	require.Len(t, overlapErr.Others, 1)
+	require.Equal(t, "event-1", overlapErr.Others[0].ID)
+	require.EqualError(t, err, `banner "event-2" overlaps "event-1"`)
+	created, err = s.SaveBanner(context.Background(), b2, true)
+	require.NoError(t, err)
+	require.True(t, created)
+
+	bs, err := s.Banners(context.Background())
+	require.NoError(t, err)
+	require.Len(t, bs, 2)
+	require.Equal(t, "event 1 updated", bs[0].Text)
+	require.Equal(t, "event-2", bs[1].ID)
+
+	err = s.DeleteBanner(context.Background(), "event-1")
+	require.NoError(t, err)
+	err = s.DeleteBanner(context.Background(), "event-1")
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+	_, err = s.BannerByID(context.Background(), "event-1")
+	require.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
+
+func TestService_CheckBannerOverlaps(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	err := s.BannerCollection().Drop(ctx)
+	require.NoError(t, err)
+
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	// A banner imported by older versions has no id.
+	_, err = s.BannerCollection().InsertOne(ctx, bson.M{
+		"text":      "old event",
+		"visibleAt": t0,
+		"startsAt":  t0,
+		"endsAt":    t0.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	_, err = s.SaveBanner(ctx, schema.Banner{ID: "event-1", Text: "event 1", VisibleAt: t0.Add(2 * time.Hour), StartsAt: t0.Add(2 * time.Hour), EndsAt: t0.Add(3 * time.Hour)}, false)
+	require.NoError(t, err)
+
+	err = s.CheckBannerOverlaps(ctx, []schema.Banner{
+		{ID: "event-2", Text: "event 2", VisibleAt: t0.Add(30 * time.Minute), StartsAt: t0.Add(30 * time.Minute), EndsAt: t0.Add(90 * time.Minute)},
+	})
+	require.EqualError(t, err, `banner "event-2" overlaps a banner without id starting at 2021-05-04T00:00:00Z`)
+
+	// Banners overlapping each other.
+	err = s.CheckBannerOverlaps(ctx, []schema.Banner{
+		{ID: "event-3", Text: "event 3", VisibleAt: t0.Add(4 * time.Hour), StartsAt: t0.Add(4 * time.Hour), EndsAt: t0.Add(5 * time.Hour)},
+		{ID: "event-4", Text: "event 4", VisibleAt: t0.Add(4 * time.Hour), StartsAt: t0.Add(4 * time.Hour), EndsAt: t0.Add(5 * time.Hour)},
+	})
+	var overlapErr *BannerOverlapError
+	require.ErrorAs(t, err, &overlapErr)
+	require.Equal(t, "event-3", overlapErr.ID)
+
+	// A saved banner does not overlap the banner replacing it.
+	err = s.CheckBannerOverlaps(ctx, []schema.Banner{
+		{ID: "event-1", Text: "event 1", VisibleAt: t0.Add(2 * time.Hour), StartsAt: t0.Add(150 * time.Minute), EndsAt: t0.Add(3 * time.Hour)},
+		{ID: "event-3", Text: "event 3", VisibleAt: t0.Add(4 * time.Hour), StartsAt: t0.Add(4 * time.Hour), EndsAt: t0.Add(5 * time.Hour)},
+	})
+	require.NoError(t, err)
+}
+
+func TestService_MigrateBanners(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	err := s.BannerCollection().Drop(ctx)
+	require.NoError(t, err)
+	_, err = s.EnsureDBIndexes(ctx)
+	require.NoError(t, err)
+
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	_, err = s.BannerCollection().InsertMany(ctx, bson.A{
+		bson.M{"text": "old event 1", "visibleAt": t0, "startsAt": t0, "endsAt": t0.Add(time.Hour)},
+		bson.M{"text": "old event 2", "visibleAt": t0, "startsAt": t0.Add(2 * time.Hour), "endsAt": t0.Add(3 * time.Hour)},
+		schema.Banner{ID: "event-1", Text: "event 1", VisibleAt: t0, StartsAt: t0.Add(4 * time.Hour), EndsAt: t0.Add(5 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	n, err := s.MigrateBanners(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+	n, err = s.MigrateBanners(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, n)
+
+	bs, err := s.Banners(ctx)
+	require.NoError(t, err)
+	require.Len(t, bs, 3)
+	for _, b := range bs[:2] {
+		require.Equal(t, b.DerivedID(), b.ID)
+		found, err := s.BannerByID(ctx, b.ID)
+		require.NoError(t, err)
+		require.Equal(t, b.Text, found.Text)
+	}
+	require.Equal(t, "event-1", bs[2].ID)
+}
+
+func TestService_MigrateBanners_Duplicates(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	err := s.BannerCollection().Drop(ctx)
+	require.NoError(t, err)
+	_, err = s.EnsureDBIndexes(ctx)
+	require.NoError(t, err)
+
+	// banner-importer was run twice, and the event was extended later.
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	old := bson.M{"text": "old event", "visibleAt": t0, "startsAt": t0, "endsAt": t0.Add(time.Hour)}
+	_, err = s.BannerCollection().InsertMany(ctx, bson.A{
+		old,
+		old,
+		bson.M{"text": "old event", "visibleAt": t0, "startsAt": t0, "endsAt": t0.Add(2 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	n, err := s.MigrateBanners(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, n)
+
+	bs, err := s.Banners(ctx)
+	require.NoError(t, err)
+	require.Len(t, bs, 2)
+	id := bs[0].DerivedID()
+	ids := []string{bs[0].ID, bs[1].ID}
+	require.ElementsMatch(t, []string{id, id + "-2"}, ids)
+	b, err := s.BannerByID(ctx, id)
+	require.NoError(t, err)
+	require.True(t, t0.Add(time.Hour).Equal(b.EndsAt))
+}
+
+func TestService_AccountEvents(t *testing.T) {
+	s := newTestService(t)
+
+	err := s.AccountEventCollection().Drop(context.Background())
+	require.NoError(t, err)
+
+	var docs bson.A
+	for _, x := range []struct {
+		blockHeight int64
+		numEvents   int
+	}{
+		{10, 1},
+		{9, 4}, // more than the page size
+		{8, 2},
+	} {
+		for i := 0; i < x.numEvents; i++ {
+			docs = append(docs, schema.AccountEvent{
+				BlockHeight: x.blockHeight,
+				Index:       i,
+				Address:     "cosmos1a",
+				Type:        schema.AccountEventTypeSwap,
+				PoolID:      1,
+			})
+		}
+	}
+	_, err = s.AccountEventCollection().InsertMany(context.Background(), docs)
+	require.NoError(t, err)
+
+	type page struct {
+		blockHeights []int64
+		hasMore      bool
+	}
+	var pages []page
+	var cursor int64
+	for {
+		events, hasMore, err := s.AccountEvents(context.Background(), "cosmos1a", "", 0, cursor, 3)
+		require.NoError(t, err)
+		var p page
+		for _, evt := range events {
+			p.blockHeights = append(p.blockHeights, evt.BlockHeight)
+		}
+		p.hasMore = hasMore
+		pages = append(pages, p)
+		if !hasMore {
+			break
+		}
+		cursor = events[len(events)-1].BlockHeight
+	}
+	// A block is never split across pages, even if it has more events than the limit.
+	require.Equal(t, []page{
+		{[]int64{10}, true},
+		{[]int64{9, 9, 9, 9}, true},
+		{[]int64{8, 8}, false},
+	}, pages)
+}
+
+func TestService_Rollback_Checkpoint(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	require.NoError(t, s.CheckpointCollection().Drop(ctx))
+	require.NoError(t, s.SetLatestBlockHeight(ctx, 30))
+
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, s.Rollback(ctx, schema.StateSnapshot{BlockHeight: 20, Timestamp: t0}))
+	// Rolling back again while replaying keeps the highest block height.
+	require.NoError(t, s.SetLatestBlockHeight(ctx, 25))
+	require.NoError(t, s.Rollback(ctx, schema.StateSnapshot{BlockHeight: 10, Timestamp: t0}))
+	cp, err := s.Checkpoint(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, cp.BlockHeight)
+	require.EqualValues(t, 30, cp.RolledBackFrom)
+	require.True(t, cp.Replaying())
+
+	require.NoError(t, s.SetLatestBlockHeight(ctx, 29))
+	cp, err = s.Checkpoint(ctx)
+	require.NoError(t, err)
+	require.True(t, cp.Replaying())
+	require.NoError(t, s.SetLatestBlockHeight(ctx, 30))
+	cp, err = s.Checkpoint(ctx)
+	require.NoError(t, err)
+	require.False(t, cp.Replaying())
+	require.Zero(t, cp.RolledBackFrom)
+}
+
+func TestService_Rollback_PoolCandles(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	for _, coll := range []*mongo.Collection{s.PoolCollection(), s.PoolCandleCollection(), s.AccountEventCollection()} {
+		require.NoError(t, coll.Drop(ctx))
+	}
+
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	_, err := s.PoolCollection().InsertMany(ctx, bson.A{
+		schema.Pool{ID: 1, ReserveCoinDenoms: []string{"uatom", "uusd"}},
+		schema.Pool{ID: 2, ReserveCoinDenoms: []string{"uatom", "uusd"}},
+	})
+	require.NoError(t, err)
+	swap := func(blockHeight int64, poolID uint64, sec int, price string, offer, demand schema.Coin) schema.AccountEvent {
+		return schema.AccountEvent{
+			BlockHeight: blockHeight,
+			Address:     "cosmos1a",
+			Type:        schema.AccountEventTypeSwap,
+			PoolID:      poolID,
+			Timestamp:   t0.Add(time.Duration(sec) * time.Second),
+			Coins:       []schema.Coin{offer, demand},
+			SwapPrice:   price,
+		}
+	}
+	atom := func(n int64) schema.Coin { return schema.Coin{Denom: "uatom", Amount: schema.NewInt(n)} }
+	usd := func(n int64) schema.Coin { return schema.Coin{Denom: "uusd", Amount: schema.NewInt(n)} }
+	_, err = s.AccountEventCollection().InsertMany(ctx, bson.A{
+		swap(8, 1, 30, "2", atom(10), usd(20)),
+		swap(10, 1, 90, "3", usd(30), atom(10)),
+		swap(11, 1, 100, "5", atom(10), usd(50)),
+		swap(11, 2, 100, "5", atom(10), usd(50)),
+		swap(12, 1, 130, "7", atom(10), usd(70)),
+	})
+	require.NoError(t, err)
+	candle := func(poolID uint64, sec int, open, high, low, close float64, volumeX, volumeY int64, numSwaps int) schema.PoolCandle {
+		return schema.PoolCandle{
+			ID:         poolID,
+			Resolution: 60,
+			Timestamp:  t0.Add(time.Duration(sec) * time.Second),
+			Open:       open,
+			High:       high,
+			Low:        low,
+			Close:      close,
+			VolumeX:    schema.NewInt(volumeX),
+			VolumeY:    schema.NewInt(volumeY),
+			NumSwaps:   numSwaps,
+		}
+	}
+	_, err = s.PoolCandleCollection().InsertMany(ctx, bson.A{
+		candle(1, 0, 2, 2, 2, 2, 10, 20, 1),
+		candle(1, 60, 3, 5, 3, 5, 20, 80, 2),
+		candle(2, 60, 5, 5, 5, 5, 10, 50, 1),
+		candle(1, 120, 7, 7, 7, 7, 10, 70, 1),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Rollback(ctx, schema.StateSnapshot{BlockHeight: 10, Timestamp: t0.Add(90 * time.Second)}))
+
+	cur, err := s.PoolCandleCollection().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{
+		{schema.PoolCandleIDKey, 1},
+		{schema.PoolCandleTimestampKey, 1},
+	}))
+	require.NoError(t, err)
+	var candles []schema.PoolCandle
+	require.NoError(t, cur.All(ctx, &candles))
+	// The closed candle is kept, the open candles are rebuilt from the swaps
+	// up to the snapshot, and the candles after the snapshot are deleted.
+	require.Len(t, candles, 2)
+	for i, c := range []schema.PoolCandle{
+		candle(1, 0, 2, 2, 2, 2, 10, 20, 1),
+		candle(1, 60, 3, 3, 3, 3, 10, 30, 1),
+	} {
+		require.Equal(t, c.Timestamp, candles[i].Timestamp.UTC())
+		require.Equal(t, c.Open, candles[i].Open)
+		require.Equal(t, c.Close, candles[i].Close)
+		require.Equal(t, c.NumSwaps, candles[i].NumSwaps)
+		require.Equal(t, c.VolumeX.String(), candles[i].VolumeX.String())
+		require.Equal(t, c.VolumeY.String(), candles[i].VolumeY.String())
+	}
+}
+
+func TestService_BackfillPoolSnapshotPrices(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	require.NoError(t, s.PoolSnapshotCollection().Drop(ctx))
+
+	t0 := time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC)
+	snapshot := func(blockHeight int64, tm time.Time, reserveY string, prices map[string]float64) schema.PoolSnapshot {
+		return schema.PoolSnapshot{
+			BlockHeight: blockHeight,
+			ID:          1,
+			Timestamp:   tm,
+			ReserveCoins: []schema.Coin{
+				{Denom: "uatom", Amount: schema.NewInt(100)},
+				{Denom: reserveY, Amount: schema.NewInt(200)},
+			},
+			PoolCoin: schema.Coin{Denom: "pool1", Amount: schema.NewInt(10)},
+			Prices:   prices,
+		}
+	}
+	_, err := s.PoolSnapshotCollection().InsertMany(ctx, bson.A{
+		snapshot(10, t0, "uusd", nil),
+		snapshot(20, t0.Add(time.Hour), "uusd", nil),
+		snapshot(30, t0.Add(2*time.Hour), "uluna", nil),
+		snapshot(40, t0.Add(3*time.Hour), "uusd", map[string]float64{"uatom": 9, "uusd": 9, "pool1": 9}),
+	})
+	require.NoError(t, err)
+
+	priceAt := func(denom string, tm time.Time) (float64, bool) {
+		switch denom {
+		case "uatom":
+			if tm.Before(t0.Add(time.Hour)) {
+				return 2, true
+			}
+			return 3, true
+		case "uusd":
+			return 1, true
+		}
+		return 0, false
+	}
+	n, err := s.BackfillPoolSnapshotPrices(ctx, priceAt)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	cur, err := s.PoolSnapshotCollection().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{schema.PoolSnapshotBlockHeightKey: 1}))
+	require.NoError(t, err)
+	var snapshots []schema.PoolSnapshot
+	require.NoError(t, cur.All(ctx, &snapshots))
+	require.Len(t, snapshots, 4)
+	require.Equal(t, map[string]float64{"uatom": 2, "uusd": 1, "pool1": 40}, snapshots[0].Prices)
+	require.Equal(t, map[string]float64{"uatom": 3, "uusd": 1, "pool1": 50}, snapshots[1].Prices)
+	// Snapshots with a reserve coin without a price and snapshots with prices are kept.
+	require.Nil(t, snapshots[2].Prices)
+	require.Equal(t, map[string]float64{"uatom": 9, "uusd": 9, "pool1": 9}, snapshots[3].Prices)
+}
@@ -21,12 +21,3 @@ func (d *BlockData) PoolByID() map[uint64]liquiditytypes.Pool {
 	}
 	return m
 }
-
-func oppositeReserveCoinDenom(pool liquiditytypes.Pool, denom string) (string, bool) {
-	for _, d := range pool.ReserveCoinDenoms {
-		if d != denom {
-			return d, true
-		}
-	}
-	return "", false
-}
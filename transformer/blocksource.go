@@ -0,0 +1,419 @@
+package transformer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/klauspost/compress/zstd"
+	liquiditytypes "github.com/tendermint/liquidity/x/liquidity/types"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/event"
+)
+
+// BlockSource provides block data by height.
+// ReadBlockData returns an error wrapping os.ErrNotExist if the block data
+// is not available yet, and a *BlockDataDecodeError if it is malformed.
+type BlockSource interface {
+	ReadBlockData(ctx context.Context, blockHeight int64) (*BlockData, error)
+}
+
+func NewBlockSource(cfg config.TransformerConfig) (BlockSource, error) {
+	switch cfg.BlockDataSource {
+	case config.BlockDataSourceDir:
+		return NewDirBlockSource(cfg.BlockDataDir, cfg.BlockDataFilename, cfg.BlockDataBucketSize, cfg.BlockDataCompression), nil
+	case config.BlockDataSourceTar:
+		return NewTarBlockSource(cfg.BlockDataDir, cfg.BlockDataArchiveFilename, cfg.BlockDataBucketSize, cfg.BlockDataCompression), nil
+	case config.BlockDataSourceRPC:
+		return NewRPCBlockSource(cfg.RPCEndpoint)
+	default:
+		return nil, fmt.Errorf("unknown block data source: %s", cfg.BlockDataSource)
+	}
+}
+
+type BlockDataDecodeError struct {
+	Err error
+}
+
+func (err *BlockDataDecodeError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *BlockDataDecodeError) Unwrap() error {
+	return err.Err
+}
+
+func decompress(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case config.BlockDataCompressionNone:
+		return io.NopCloser(r), nil
+	case config.BlockDataCompressionGzip:
+		return gzip.NewReader(r)
+	case config.BlockDataCompressionZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compression)
+	}
+}
+
+func decodeBlockData(r io.Reader, compression string) (*BlockData, error) {
+	dr, err := decompress(r, compression)
+	if err != nil {
+		return nil, &BlockDataDecodeError{err}
+	}
+	defer dr.Close()
+	var data BlockData
+	if err := jsonit.NewDecoder(dr).Decode(&data); err != nil {
+		return nil, &BlockDataDecodeError{err}
+	}
+	return &data, nil
+}
+
+// DirBlockSource reads a file per block, laid out in buckets of bucketSize blocks.
+type DirBlockSource struct {
+	dir         string
+	filename    string
+	bucketSize  int64
+	compression string
+}
+
+func NewDirBlockSource(dir, filename string, bucketSize int, compression string) *DirBlockSource {
+	return &DirBlockSource{dir, filename, int64(bucketSize), compression}
+}
+
+func (src *DirBlockSource) Filename(blockHeight int64) string {
+	p := blockHeight / src.bucketSize * src.bucketSize
+	return filepath.Join(src.dir, fmt.Sprintf(src.filename, p, blockHeight))
+}
+
+func (src *DirBlockSource) ReadBlockData(ctx context.Context, blockHeight int64) (*BlockData, error) {
+	f, err := os.Open(src.Filename(blockHeight))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeBlockData(f, src.compression)
+}
+
+// TarBlockSource reads block data from tar archives, each of which holds
+// a bucket of bucketSize blocks as files named after their heights(e.g. 1234.json),
+// in ascending order.
+// Since tar archives can only be read sequentially, the archive being read
+// is kept open, and entries skipped over are kept for a while to serve
+// requests arriving slightly out of order.
+type TarBlockSource struct {
+	dir         string
+	filename    string
+	bucketSize  int64
+	compression string
+
+	mu      sync.Mutex
+	cur     *tarSegment
+	skipped map[int64][]byte
+}
+
+const maxTarSkippedEntries = 256
+
+type tarSegment struct {
+	bucket  int64
+	f       *os.File
+	r       io.ReadCloser
+	tr      *tar.Reader
+	last    int64 // height of the last entry read
+	pending int64 // height of the entry read ahead, 0 if none
+}
+
+func (seg *tarSegment) Close() error {
+	seg.r.Close()
+	return seg.f.Close()
+}
+
+func NewTarBlockSource(dir, filename string, bucketSize int, compression string) *TarBlockSource {
+	return &TarBlockSource{
+		dir:         dir,
+		filename:    filename,
+		bucketSize:  int64(bucketSize),
+		compression: compression,
+		skipped:     make(map[int64][]byte),
+	}
+}
+
+func (src *TarBlockSource) Filename(bucket int64) string {
+	return filepath.Join(src.dir, fmt.Sprintf(src.filename, bucket))
+}
+
+func (src *TarBlockSource) ReadBlockData(ctx context.Context, blockHeight int64) (*BlockData, error) {
+	bz, err := src.readEntry(blockHeight)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBlockData(bytes.NewReader(bz), config.BlockDataCompressionNone)
+}
+
+func (src *TarBlockSource) readEntry(blockHeight int64) ([]byte, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if bz, ok := src.skipped[blockHeight]; ok {
+		delete(src.skipped, blockHeight)
+		return bz, nil
+	}
+	bucket := blockHeight / src.bucketSize * src.bucketSize
+	if src.cur != nil && (src.cur.bucket != bucket || src.cur.last >= blockHeight) {
+		src.closeSegment()
+	}
+	if src.cur == nil {
+		seg, err := src.openSegment(bucket)
+		if err != nil {
+			return nil, err
+		}
+		src.cur = seg
+	}
+	seg := src.cur
+	for {
+		if seg.pending == 0 {
+			hdr, err := seg.tr.Next()
+			if err == io.EOF {
+				return nil, fmt.Errorf("block %d in %s: %w", blockHeight, seg.f.Name(), os.ErrNotExist)
+			} else if err != nil {
+				src.closeSegment()
+				return nil, &BlockDataDecodeError{fmt.Errorf("read tar header: %w", err)}
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			h, err := strconv.ParseInt(strings.SplitN(path.Base(hdr.Name), ".", 2)[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			seg.pending = h
+		}
+		if seg.pending > blockHeight {
+			return nil, fmt.Errorf("block %d in %s: %w", blockHeight, seg.f.Name(), os.ErrNotExist)
+		}
+		h := seg.pending
+		seg.last, seg.pending = h, 0
+		bz, err := io.ReadAll(seg.tr)
+		if err != nil {
+			src.closeSegment()
+			return nil, &BlockDataDecodeError{fmt.Errorf("read tar entry: %w", err)}
+		}
+		if h == blockHeight {
+			return bz, nil
+		}
+		if len(src.skipped) < maxTarSkippedEntries {
+			src.skipped[h] = bz
+		}
+	}
+}
+
+func (src *TarBlockSource) openSegment(bucket int64) (*tarSegment, error) {
+	f, err := os.Open(src.Filename(bucket))
+	if err != nil {
+		return nil, err
+	}
+	r, err := decompress(f, src.compression)
+	if err != nil {
+		f.Close()
+		return nil, &BlockDataDecodeError{err}
+	}
+	return &tarSegment{bucket: bucket, f: f, r: r, tr: tar.NewReader(r)}, nil
+}
+
+func (src *TarBlockSource) closeSegment() {
+	src.cur.Close()
+	src.cur = nil
+}
+
+// RPCBlockSource fetches block data from a Tendermint RPC endpoint.
+// Its bank module states only hold the total supply and the balances of
+// the pool reserve accounts and of the accounts in the block's liquidity
+// events, which is enough for pool snapshots and account balances.
+type RPCBlockSource struct {
+	c            *rpchttp.HTTP
+	latestHeight int64 // accessed atomically
+}
+
+func NewRPCBlockSource(endpoint string) (*RPCBlockSource, error) {
+	c, err := rpchttp.New(endpoint, "/websocket")
+	if err != nil {
+		return nil, fmt.Errorf("new rpc client: %w", err)
+	}
+	return &RPCBlockSource{c: c}, nil
+}
+
+func (src *RPCBlockSource) ReadBlockData(ctx context.Context, blockHeight int64) (*BlockData, error) {
+	if blockHeight > atomic.LoadInt64(&src.latestHeight) {
+		st, err := src.c.Status(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get status: %w", err)
+		}
+		latestHeight := st.SyncInfo.LatestBlockHeight
+		for {
+			h := atomic.LoadInt64(&src.latestHeight)
+			if latestHeight <= h || atomic.CompareAndSwapInt64(&src.latestHeight, h, latestHeight) {
+				break
+			}
+		}
+		if latestHeight < blockHeight {
+			return nil, fmt.Errorf("block %d: %w", blockHeight, os.ErrNotExist)
+		}
+	}
+	b, err := src.c.Block(ctx, &blockHeight)
+	if err != nil {
+		return nil, fmt.Errorf("get block: %w", err)
+	}
+	res, err := src.c.BlockResults(ctx, &blockHeight)
+	if err != nil {
+		return nil, fmt.Errorf("get block results: %w", err)
+	}
+	pools, err := src.pools(ctx, blockHeight)
+	if err != nil {
+		return nil, fmt.Errorf("get pools: %w", err)
+	}
+	bankModuleState, err := src.bankModuleState(ctx, blockHeight, pools, res.EndBlockEvents)
+	if err != nil {
+		return nil, fmt.Errorf("get bank module state: %w", err)
+	}
+	return &BlockData{
+		Header:          *b.Block.Header.ToProto(),
+		BankModuleState: bankModuleState,
+		Events:          res.EndBlockEvents,
+		Pools:           pools,
+	}, nil
+}
+
+// query runs a gRPC query through ABCI at the block height.
+// It returns false if the queried state does not exist.
+func (src *RPCBlockSource) query(ctx context.Context, blockHeight int64, path string, req interface{ Marshal() ([]byte, error) }, resp interface{ Unmarshal([]byte) error }) (bool, error) {
+	bz, err := req.Marshal()
+	if err != nil {
+		return false, fmt.Errorf("marshal request: %w", err)
+	}
+	res, err := src.c.ABCIQueryWithOptions(ctx, path, bz, rpcclient.ABCIQueryOptions{Height: blockHeight})
+	if err != nil {
+		return false, fmt.Errorf("abci query: %w", err)
+	}
+	if res.Response.Codespace == sdkerrors.ErrKeyNotFound.Codespace() && res.Response.Code == sdkerrors.ErrKeyNotFound.ABCICode() {
+		return false, nil
+	}
+	if !res.Response.IsOK() {
+		return false, fmt.Errorf("abci query: %s", res.Response.Log)
+	}
+	if err := resp.Unmarshal(res.Response.Value); err != nil {
+		return false, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return true, nil
+}
+
+func (src *RPCBlockSource) pools(ctx context.Context, blockHeight int64) ([]liquiditytypes.Pool, error) {
+	var pools []liquiditytypes.Pool
+	var key []byte
+	for {
+		req := liquiditytypes.QueryLiquidityPoolsRequest{Pagination: &query.PageRequest{Key: key}}
+		var resp liquiditytypes.QueryLiquidityPoolsResponse
+		found, err := src.query(ctx, blockHeight, "/tendermint.liquidity.v1beta1.Query/LiquidityPools", &req, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			break // there are no pools yet
+		}
+		pools = append(pools, resp.Pools...)
+		if resp.Pagination == nil || len(resp.Pagination.NextKey) == 0 {
+			break
+		}
+		key = resp.Pagination.NextKey
+	}
+	return pools, nil
+}
+
+func (src *RPCBlockSource) bankModuleState(ctx context.Context, blockHeight int64, pools []liquiditytypes.Pool, events []abcitypes.Event) (*banktypes.GenesisState, error) {
+	var supplyResp banktypes.QueryTotalSupplyResponse
+	if _, err := src.query(ctx, blockHeight, "/cosmos.bank.v1beta1.Query/TotalSupply", &banktypes.QueryTotalSupplyRequest{}, &supplyResp); err != nil {
+		return nil, fmt.Errorf("get total supply: %w", err)
+	}
+	addrSet := make(map[string]struct{})
+	for _, p := range pools {
+		addrSet[p.ReserveAccountAddress] = struct{}{}
+	}
+	for _, evt := range events {
+		e, err := event.Decode(evt)
+		if err != nil {
+			return nil, &BlockDataDecodeError{fmt.Errorf("decode event: %w", err)}
+		}
+		switch e := e.(type) {
+		case *event.DepositRefund:
+			addrSet[e.Depositor] = struct{}{}
+		case *event.WithdrawRefund:
+			addrSet[e.Withdrawer] = struct{}{}
+		case *event.DepositToPool:
+			addrSet[e.Depositor] = struct{}{}
+		case *event.WithdrawFromPool:
+			addrSet[e.Withdrawer] = struct{}{}
+		case *event.SwapTransacted:
+			addrSet[e.SwapRequester] = struct{}{}
+		}
+	}
+	addrs := make([]string, 0, len(addrSet))
+	for addr := range addrSet {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	balances := make([]banktypes.Balance, 0, len(addrs))
+	for _, addr := range addrs {
+		coins, err := src.balances(ctx, blockHeight, addr)
+		if err != nil {
+			return nil, fmt.Errorf("get balances of %s: %w", addr, err)
+		}
+		balances = append(balances, banktypes.Balance{Address: addr, Coins: coins})
+	}
+	return &banktypes.GenesisState{
+		Balances: balances,
+		Supply:   supplyResp.Supply,
+	}, nil
+}
+
+func (src *RPCBlockSource) balances(ctx context.Context, blockHeight int64, addr string) (sdk.Coins, error) {
+	var coins sdk.Coins
+	var key []byte
+	for {
+		req := banktypes.QueryAllBalancesRequest{Address: addr, Pagination: &query.PageRequest{Key: key}}
+		var resp banktypes.QueryAllBalancesResponse
+		found, err := src.query(ctx, blockHeight, "/cosmos.bank.v1beta1.Query/AllBalances", &req, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			break
+		}
+		coins = append(coins, resp.Balances...)
+		if resp.Pagination == nil || len(resp.Pagination.NextKey) == 0 {
+			break
+		}
+		key = resp.Pagination.NextKey
+	}
+	return coins, nil
+}
@@ -0,0 +1,272 @@
+package transformer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	liquiditytypes "github.com/tendermint/liquidity/x/liquidity/types"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+)
+
+func compress(t *testing.T, compression string, bz []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case config.BlockDataCompressionNone:
+		buf.Write(bz)
+		return buf.Bytes()
+	case config.BlockDataCompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case config.BlockDataCompressionZstd:
+		var err error
+		w, err = zstd.NewWriter(&buf)
+		require.NoError(t, err)
+	}
+	_, err := w.Write(bz)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func blockDataJSON(blockHeight int64) []byte {
+	return []byte(fmt.Sprintf(`{"block_header":{"height":%d}}`, blockHeight))
+}
+
+func writeTestBlockData(t *testing.T, src *DirBlockSource, blockHeight int64) {
+	fn := src.Filename(blockHeight)
+	require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+	require.NoError(t, os.WriteFile(fn, blockDataJSON(blockHeight), 0644))
+}
+
+func TestDirBlockSource(t *testing.T) {
+	for _, compression := range []string{
+		config.BlockDataCompressionNone,
+		config.BlockDataCompressionGzip,
+		config.BlockDataCompressionZstd,
+	} {
+		t.Run(compression, func(t *testing.T) {
+			src := NewDirBlockSource(t.TempDir(), "%08d/%d.json", 10, compression)
+			for _, h := range []int64{9, 10} {
+				fn := src.Filename(h)
+				require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+				require.NoError(t, os.WriteFile(fn, compress(t, compression, blockDataJSON(h)), 0644))
+			}
+			for _, h := range []int64{9, 10} {
+				data, err := src.ReadBlockData(context.Background(), h)
+				require.NoError(t, err)
+				require.Equal(t, h, data.Header.Height)
+			}
+			_, err := src.ReadBlockData(context.Background(), 11)
+			require.True(t, errors.Is(err, os.ErrNotExist))
+		})
+	}
+}
+
+func TestTarBlockSource(t *testing.T) {
+	for _, compression := range []string{
+		config.BlockDataCompressionNone,
+		config.BlockDataCompressionGzip,
+		config.BlockDataCompressionZstd,
+	} {
+		t.Run(compression, func(t *testing.T) {
+			src := NewTarBlockSource(t.TempDir(), "%08d.tar", 10, compression)
+			for _, bucket := range []int64{0, 10} {
+				var buf bytes.Buffer
+				tw := tar.NewWriter(&buf)
+				for h := bucket; h < bucket+10; h++ {
+					if h == 0 || h == 15 {
+						continue
+					}
+					bz := blockDataJSON(h)
+					require.NoError(t, tw.WriteHeader(&tar.Header{
+						Name:     fmt.Sprintf("%08d/%d.json", bucket, h),
+						Typeflag: tar.TypeReg,
+						Mode:     0644,
+						Size:     int64(len(bz)),
+					}))
+					_, err := tw.Write(bz)
+					require.NoError(t, err)
+				}
+				require.NoError(t, tw.Close())
+				require.NoError(t, os.WriteFile(src.Filename(bucket), compress(t, compression, buf.Bytes()), 0644))
+			}
+			for _, tc := range []struct {
+				height int64
+				found  bool
+			}{
+				{1, true},
+				{2, true},
+				{5, true},
+				{3, true}, // reopens the archive
+				{14, true},
+				{15, false},
+				{16, true},
+				{19, true},
+				{20, false},
+			} {
+				data, err := src.ReadBlockData(context.Background(), tc.height)
+				if tc.found {
+					require.NoError(t, err, tc.height)
+					require.Equal(t, tc.height, data.Header.Height)
+				} else {
+					require.True(t, errors.Is(err, os.ErrNotExist), tc.height)
+				}
+			}
+		})
+	}
+}
+
+// mockNode serves the Tendermint RPC methods used by RPCBlockSource.
+type mockNode struct {
+	latestHeight int64 // accessed atomically
+	pools        []liquiditytypes.Pool
+	balances     map[string]sdk.Coins
+	supply       sdk.Coins
+	events       []abcitypes.Event
+	statusCalls  int64
+}
+
+func (n *mockNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req rpctypes.RPCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var params struct {
+		Height string           `json:"height"`
+		Path   string           `json:"path"`
+		Data   tmbytes.HexBytes `json:"data"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	height, _ := strconv.ParseInt(params.Height, 10, 64)
+	var result interface{}
+	switch req.Method {
+	case "status":
+		atomic.AddInt64(&n.statusCalls, 1)
+		result = &ctypes.ResultStatus{SyncInfo: ctypes.SyncInfo{LatestBlockHeight: atomic.LoadInt64(&n.latestHeight)}}
+	case "block":
+		result = &ctypes.ResultBlock{Block: &tmtypes.Block{Header: tmtypes.Header{Height: height}}}
+	case "block_results":
+		result = &ctypes.ResultBlockResults{Height: height, EndBlockEvents: n.events}
+	case "abci_query":
+		result = &ctypes.ResultABCIQuery{Response: n.query(params.Path, params.Data)}
+	default:
+		http.Error(w, "unknown method", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rpctypes.NewRPCSuccessResponse(req.ID, result))
+}
+
+func (n *mockNode) query(path string, data []byte) abcitypes.ResponseQuery {
+	var resp interface{ Marshal() ([]byte, error) }
+	switch path {
+	case "/tendermint.liquidity.v1beta1.Query/LiquidityPools":
+		resp = &liquiditytypes.QueryLiquidityPoolsResponse{Pools: n.pools}
+	case "/cosmos.bank.v1beta1.Query/TotalSupply":
+		resp = &banktypes.QueryTotalSupplyResponse{Supply: n.supply}
+	case "/cosmos.bank.v1beta1.Query/AllBalances":
+		var req banktypes.QueryAllBalancesRequest
+		if err := req.Unmarshal(data); err != nil {
+			return abcitypes.ResponseQuery{Code: 1, Log: err.Error()}
+		}
+		resp = &banktypes.QueryAllBalancesResponse{Balances: n.balances[req.Address]}
+	default:
+		return abcitypes.ResponseQuery{Code: 1, Log: "unknown path"}
+	}
+	bz, err := resp.Marshal()
+	if err != nil {
+		return abcitypes.ResponseQuery{Code: 1, Log: err.Error()}
+	}
+	return abcitypes.ResponseQuery{Value: bz}
+}
+
+func TestRPCBlockSource(t *testing.T) {
+	const (
+		reserveAddr   = "cosmos1reserve"
+		depositorAddr = "cosmos1depositor"
+	)
+	node := &mockNode{
+		latestHeight: 3,
+		pools: []liquiditytypes.Pool{
+			{Id: 1, ReserveAccountAddress: reserveAddr, ReserveCoinDenoms: []string{"uatom", "uusd"}, PoolCoinDenom: "pool1"},
+		},
+		balances: map[string]sdk.Coins{
+			reserveAddr:   sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000), sdk.NewInt64Coin("uusd", 2000)),
+			depositorAddr: sdk.NewCoins(sdk.NewInt64Coin("pool1", 500)),
+		},
+		supply: sdk.NewCoins(sdk.NewInt64Coin("pool1", 500)),
+		events: []abcitypes.Event{
+			{
+				Type: liquiditytypes.EventTypeDepositToPool,
+				Attributes: []abcitypes.EventAttribute{
+					{Key: []byte(liquiditytypes.AttributeValuePoolId), Value: []byte("1")},
+					{Key: []byte(liquiditytypes.AttributeValueBatchIndex), Value: []byte("1")},
+					{Key: []byte(liquiditytypes.AttributeValueMsgIndex), Value: []byte("1")},
+					{Key: []byte(liquiditytypes.AttributeValueDepositor), Value: []byte(depositorAddr)},
+					{Key: []byte(liquiditytypes.AttributeValueAcceptedCoins), Value: []byte("1000uatom,2000uusd")},
+					{Key: []byte(liquiditytypes.AttributeValueRefundedCoins), Value: []byte("")},
+					{Key: []byte(liquiditytypes.AttributeValuePoolCoinDenom), Value: []byte("pool1")},
+					{Key: []byte(liquiditytypes.AttributeValuePoolCoinAmount), Value: []byte("500")},
+					{Key: []byte(liquiditytypes.AttributeValueSuccess), Value: []byte(liquiditytypes.Success)},
+				},
+			},
+		},
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	src, err := NewRPCBlockSource(srv.URL)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for h := int64(1); h <= 3; h++ {
+		data, err := src.ReadBlockData(ctx, h)
+		require.NoError(t, err)
+		require.Equal(t, h, data.Header.Height)
+		require.Len(t, data.Events, 1)
+		require.Len(t, data.Pools, 1)
+		require.NotNil(t, data.BankModuleState)
+		require.Equal(t, node.supply, data.BankModuleState.Supply)
+		require.Equal(t, []banktypes.Balance{
+			{Address: depositorAddr, Coins: node.balances[depositorAddr]},
+			{Address: reserveAddr, Coins: node.balances[reserveAddr]},
+		}, data.BankModuleState.Balances)
+	}
+	require.EqualValues(t, 1, atomic.LoadInt64(&node.statusCalls))
+
+	_, err = src.ReadBlockData(ctx, 4)
+	require.True(t, errors.Is(err, os.ErrNotExist))
+	require.EqualValues(t, 2, atomic.LoadInt64(&node.statusCalls))
+
+	atomic.StoreInt64(&node.latestHeight, 4)
+	_, err = src.ReadBlockData(ctx, 4)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, atomic.LoadInt64(&node.statusCalls))
+}
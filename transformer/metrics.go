@@ -0,0 +1,50 @@
+package transformer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/b-harvest/gravity-dex-backend/metrics"
+)
+
+var (
+	blocksProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "transformer",
+		Name:      "blocks_processed_total",
+		Help:      "Number of blocks committed.",
+	})
+	batchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "transformer",
+		Name:      "batch_blocks",
+		Help:      "Number of blocks per committed batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	})
+	latestBlockHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "transformer",
+		Name:      "latest_block_height",
+		Help:      "Latest committed block height.",
+	})
+	lagSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "transformer",
+		Name:      "lag_seconds",
+		Help:      "Time between the latest committed block and its commit.",
+	})
+	stageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "transformer",
+		Name:      "stage_duration_seconds",
+		Help:      "Duration of the bulk writes of each state update stage.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"stage"})
+	commitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "transformer",
+		Name:      "commit_duration_seconds",
+		Help:      "Duration of committing a batch of state updates.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	})
+)
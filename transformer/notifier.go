@@ -0,0 +1,39 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/b-harvest/gravity-dex-backend/schema"
+)
+
+// BlockHeightNotifier is notified when the latest block height has advanced.
+type BlockHeightNotifier interface {
+	NotifyBlockHeight(ctx context.Context, blockHeight int64) error
+}
+
+// RedisBlockHeightNotifier publishes the latest block height to a Redis channel.
+type RedisBlockHeightNotifier struct {
+	rp      *redis.Pool
+	channel string
+}
+
+func NewRedisBlockHeightNotifier(rp *redis.Pool, channel string) *RedisBlockHeightNotifier {
+	return &RedisBlockHeightNotifier{rp, channel}
+}
+
+func (n *RedisBlockHeightNotifier) NotifyBlockHeight(ctx context.Context, blockHeight int64) error {
+	c, err := n.rp.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("get redis conn: %w", err)
+	}
+	defer c.Close()
+	b, err := jsonit.Marshal(schema.BlockHeightUpdate{BlockHeight: blockHeight})
+	if err != nil {
+		return fmt.Errorf("marshal update: %w", err)
+	}
+	_, err = c.Do("PUBLISH", n.channel, b)
+	return err
+}
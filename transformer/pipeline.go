@@ -0,0 +1,140 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type blockDataResult struct {
+	data *BlockData
+	err  error
+}
+
+// blockDataPipeline prefetches and decodes block data of consecutive heights
+// with multiple workers, and hands them out in height order.
+type blockDataPipeline struct {
+	cancel  context.CancelFunc
+	next    int64 // height of the block data to be handed out next
+	results chan chan blockDataResult
+	cur     chan blockDataResult
+}
+
+type blockDataJob struct {
+	blockHeight int64
+	result      chan blockDataResult
+}
+
+func (t *Transformer) newBlockDataPipeline(startingBlockHeight int64) *blockDataPipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &blockDataPipeline{
+		cancel:  cancel,
+		next:    startingBlockHeight,
+		results: make(chan chan blockDataResult, t.cfg.BlockDataPrefetchSize),
+	}
+	jobs := make(chan blockDataJob)
+	go func() {
+		defer close(jobs)
+		for h := startingBlockHeight; ; h++ {
+			result := make(chan blockDataResult, 1)
+			select {
+			case <-ctx.Done():
+				return
+			case p.results <- result:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- blockDataJob{h, result}:
+			}
+		}
+	}()
+	for i := 0; i < t.cfg.BlockDataDecoders; i++ {
+		go func() {
+			for job := range jobs {
+				data, err := t.WaitForBlockData(ctx, job.blockHeight, 0)
+				job.result <- blockDataResult{data, err}
+			}
+		}()
+	}
+	return p
+}
+
+// Next returns the block data of the next height.
+// If timeout is positive and the block data isn't available within timeout,
+// it returns context.DeadlineExceeded and the same height can be requested again.
+func (p *blockDataPipeline) Next(ctx context.Context, timeout time.Duration) (*BlockData, error) {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+	if p.cur == nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer:
+			return nil, context.DeadlineExceeded
+		case p.cur = <-p.results:
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer:
+		return nil, context.DeadlineExceeded
+	case res := <-p.cur:
+		p.cur = nil
+		if res.err != nil {
+			return nil, fmt.Errorf("block %d: %w", p.next, res.err)
+		}
+		p.next++
+		return res.data, nil
+	}
+}
+
+func (p *blockDataPipeline) Close() {
+	p.cancel()
+}
+
+// blockDataPipeline returns the running pipeline if it continues from the height,
+// or starts a new one.
+func (t *Transformer) blockDataPipeline(startingBlockHeight int64) *blockDataPipeline {
+	if t.pipeline != nil && t.pipeline.next != startingBlockHeight {
+		t.closeBlockDataPipeline()
+	}
+	if t.pipeline == nil {
+		t.pipeline = t.newBlockDataPipeline(startingBlockHeight)
+	}
+	return t.pipeline
+}
+
+func (t *Transformer) closeBlockDataPipeline() {
+	if t.pipeline != nil {
+		t.pipeline.Close()
+		t.pipeline = nil
+	}
+}
+
+const progressLogInterval = 10 * time.Second
+
+type progressLogger struct {
+	logger    *zap.Logger
+	since     time.Time
+	numBlocks int
+}
+
+func newProgressLogger(logger *zap.Logger) *progressLogger {
+	return &progressLogger{logger: logger, since: time.Now()}
+}
+
+func (l *progressLogger) Add(blockHeight int64) {
+	l.numBlocks++
+	if d := time.Since(l.since); d >= progressLogInterval {
+		l.logger.Info("processing blocks",
+			zap.Int64("height", blockHeight),
+			zap.Float64("blocks_per_sec", float64(l.numBlocks)/d.Seconds()))
+		l.since, l.numBlocks = time.Now(), 0
+	}
+}
@@ -0,0 +1,67 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+)
+
+func TestBlockDataPipeline(t *testing.T) {
+	cfg := config.DefaultTransformerConfig
+	cfg.BlockDataDir = t.TempDir()
+	cfg.BlockDataWaitingInterval = 10 * time.Millisecond
+	cfg.BlockDataPrefetchSize = 8
+	src := NewDirBlockSource(cfg.BlockDataDir, cfg.BlockDataFilename, cfg.BlockDataBucketSize, cfg.BlockDataCompression)
+	tr := &Transformer{cfg: cfg, src: src, logger: zap.NewNop()}
+
+	for h := int64(1); h <= 50; h++ {
+		writeTestBlockData(t, src, h)
+	}
+
+	ctx := context.Background()
+	p := tr.blockDataPipeline(1)
+	defer tr.closeBlockDataPipeline()
+	for h := int64(1); h <= 50; h++ {
+		data, err := p.Next(ctx, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, h, data.Header.Height)
+	}
+	_, err := p.Next(ctx, 50*time.Millisecond)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	require.Same(t, p, tr.blockDataPipeline(51))
+	writeTestBlockData(t, src, 51)
+	data, err := p.Next(ctx, time.Second)
+	require.NoError(t, err)
+	require.EqualValues(t, 51, data.Header.Height)
+
+	require.NotSame(t, p, tr.blockDataPipeline(10))
+}
+
+func TestTransformer_AccStateUpdates_MaxBatchBlocks(t *testing.T) {
+	cfg := config.DefaultTransformerConfig
+	cfg.BlockDataDir = t.TempDir()
+	cfg.BlockDataWaitingInterval = 10 * time.Millisecond
+	cfg.PoolSnapshotTimeInterval = 0
+	cfg.MaxBatchBlocks = 20
+	src := NewDirBlockSource(cfg.BlockDataDir, cfg.BlockDataFilename, cfg.BlockDataBucketSize, cfg.BlockDataCompression)
+	tr := &Transformer{cfg: cfg, src: src, logger: zap.NewNop()}
+	defer tr.closeBlockDataPipeline()
+
+	for h := int64(1); h <= 50; h++ {
+		writeTestBlockData(t, src, h)
+	}
+	h := int64(0)
+	for _, expected := range []int64{20, 40, 50} {
+		updates, err := tr.AccStateUpdates(context.Background(), h+1)
+		require.NoError(t, err)
+		h = updates.lastBlockData.Header.Height
+		require.Equal(t, expected, h)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
@@ -11,16 +12,23 @@ import (
 	liquiditytypes "github.com/tendermint/liquidity/x/liquidity/types"
 	"go.uber.org/zap"
 
+	"github.com/b-harvest/gravity-dex-backend/event"
 	"github.com/b-harvest/gravity-dex-backend/schema"
 )
 
 type StateUpdates struct {
+	firstBlockTime            time.Time
 	lastBlockData             *BlockData
 	lastBankModuleStateHeight int64
 	lastBankModuleState       *banktypes.GenesisState
 	depositStatusByAddress    ActionStatusByAddress
 	swapStatusByAddress       ActionStatusByAddress
+	withdrawStatusByAddress   ActionStatusByAddress
 	swapVolumesByPoolID       VolumesByPoolID
+	swapVolumeByPoolID        CoinMapByPoolID
+	accountEvents             []schema.AccountEvent
+	poolSnapshots             []schema.PoolSnapshot
+	candles                   CandlesByKey
 }
 
 type ActionStatusByAddress map[string]schema.AccountActionStatus
@@ -45,14 +53,69 @@ func (m VolumesByPoolID) Volumes(poolID uint64) schema.Volumes {
 	return v
 }
 
+type CoinMapByPoolID map[uint64]schema.CoinMap
+
+func (m CoinMapByPoolID) CoinMap(poolID uint64) schema.CoinMap {
+	c, ok := m[poolID]
+	if !ok {
+		c = make(schema.CoinMap)
+		m[poolID] = c
+	}
+	return c
+}
+
+type CandleKey struct {
+	PoolID     uint64
+	Resolution time.Duration
+	Timestamp  int64
+}
+
+type CandlesByKey map[CandleKey]*schema.PoolCandle
+
+func (m CandlesByKey) Candle(poolID uint64, resolution time.Duration, now time.Time) *schema.PoolCandle {
+	t := now.Truncate(resolution)
+	k := CandleKey{poolID, resolution, t.Unix()}
+	c, ok := m[k]
+	if !ok {
+		c = &schema.PoolCandle{
+			ID:         poolID,
+			Resolution: int64(resolution / time.Second),
+			Timestamp:  t,
+		}
+		m[k] = c
+	}
+	return c
+}
+
+func newStateUpdates() *StateUpdates {
+	return &StateUpdates{
+		depositStatusByAddress:  make(ActionStatusByAddress),
+		swapStatusByAddress:     make(ActionStatusByAddress),
+		withdrawStatusByAddress: make(ActionStatusByAddress),
+		swapVolumesByPoolID:     make(VolumesByPoolID),
+		swapVolumeByPoolID:      make(CoinMapByPoolID),
+		candles:                 make(CandlesByKey),
+	}
+}
+
 func (t *Transformer) AccStateUpdates(ctx context.Context, startingBlockHeight int64) (*StateUpdates, error) {
 	blockHeight := startingBlockHeight
-	updates := &StateUpdates{
-		depositStatusByAddress: make(ActionStatusByAddress),
-		swapStatusByAddress:    make(ActionStatusByAddress),
-		swapVolumesByPoolID:    make(VolumesByPoolID),
-	}
+	updates := newStateUpdates()
 	ignoredAddresses := t.cfg.IgnoredAddressesSet()
+	var lastSnapshotHeight int64
+	var lastSnapshotTime time.Time
+	if t.cfg.PoolSnapshotEnabled() {
+		snapshot, err := t.ss.LatestPoolSnapshot(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get latest pool snapshot: %w", err)
+		}
+		if snapshot != nil {
+			lastSnapshotHeight, lastSnapshotTime = snapshot.BlockHeight, snapshot.Timestamp
+		}
+	}
+	started := time.Now()
+	pipeline := t.blockDataPipeline(startingBlockHeight)
+	progress := newProgressLogger(t.logger)
 	for {
 		select {
 		case <-ctx.Done():
@@ -63,92 +126,224 @@ func (t *Transformer) AccStateUpdates(ctx context.Context, startingBlockHeight i
 		var err error
 		t.logger.Debug("waiting for the block data", zap.Int64("height", blockHeight))
 		if blockHeight == startingBlockHeight {
-			data, err = t.WaitForBlockData(ctx, blockHeight, 0)
+			data, err = pipeline.Next(ctx, 0)
 			if err != nil {
+				t.closeBlockDataPipeline()
 				return nil, fmt.Errorf("wait for block data: %w", err)
 			}
 		} else {
-			data, err = t.WaitForBlockData(ctx, blockHeight, t.cfg.BlockDataWaitingInterval+time.Second)
+			data, err = pipeline.Next(ctx, t.cfg.BlockDataWaitingInterval+time.Second)
 			if err != nil {
 				if !errors.Is(err, context.DeadlineExceeded) {
+					t.closeBlockDataPipeline()
 					return nil, fmt.Errorf("wait for block data: %w", err)
 				}
 				break
 			}
 		}
 		if data.Header.Height != blockHeight {
+			t.closeBlockDataPipeline()
 			return nil, fmt.Errorf("mismatching block height: expected %d, got %d", blockHeight, data.Header.Height)
 		}
+		progress.Add(blockHeight)
+		if blockHeight == startingBlockHeight {
+			updates.firstBlockTime = data.Header.Time
+		}
 		updates.lastBlockData = data
 		if data.BankModuleState != nil {
-			updates.lastBankModuleState = data.BankModuleState
+			updates.lastBankModuleState = mergeBankModuleStates(updates.lastBankModuleState, data.BankModuleState)
 			updates.lastBankModuleStateHeight = blockHeight
 		}
 		tm := data.Header.Time.UTC()
 		dateKey := tm.Format("2006-01-02")
 		poolByID := data.PoolByID()
 		t.logger.Debug("handling block data", zap.Int64("height", blockHeight), zap.Time("time", tm))
-		for _, evt := range data.Events {
+		for i, evt := range data.Events {
 			switch evt.Type {
 			case liquiditytypes.EventTypeDepositToPool:
-				attrs := eventAttrsFromEvent(evt)
-				addr, err := attrs.DepositorAddr()
+				e, err := event.DecodeDepositToPool(evt)
 				if err != nil {
 					return nil, err
 				}
-				if _, ok := ignoredAddresses[addr]; ok {
+				if _, ok := ignoredAddresses[e.Depositor]; ok {
 					continue
 				}
-				poolID, err := attrs.PoolID()
-				if err != nil {
-					return nil, err
-				}
-				st := updates.depositStatusByAddress.ActionStatus(addr)
-				st.IncreaseCount(poolID, dateKey, 1)
-			case liquiditytypes.EventTypeSwapTransacted:
-				attrs := eventAttrsFromEvent(evt)
-				addr, err := attrs.SwapRequesterAddr()
+				st := updates.depositStatusByAddress.ActionStatus(e.Depositor)
+				st.IncreaseCount(e.PoolID, dateKey, 1)
+				updates.accountEvents = append(updates.accountEvents, schema.AccountEvent{
+					BlockHeight: blockHeight,
+					Index:       i,
+					Address:     e.Depositor,
+					Type:        schema.AccountEventTypeDeposit,
+					PoolID:      e.PoolID,
+					Timestamp:   tm,
+					Coins:       schema.CoinsFromSDK(e.AcceptedCoins),
+				})
+			case liquiditytypes.EventTypeWithdrawFromPool:
+				e, err := event.DecodeWithdrawFromPool(evt)
 				if err != nil {
 					return nil, err
 				}
-				if _, ok := ignoredAddresses[addr]; ok {
+				if _, ok := ignoredAddresses[e.Withdrawer]; ok {
 					continue
 				}
-				poolID, err := attrs.PoolID()
-				if err != nil {
-					return nil, err
-				}
-				offerCoinFee, err := attrs.OfferCoinFee()
+				st := updates.withdrawStatusByAddress.ActionStatus(e.Withdrawer)
+				st.IncreaseCount(e.PoolID, dateKey, 1)
+				updates.accountEvents = append(updates.accountEvents, schema.AccountEvent{
+					BlockHeight: blockHeight,
+					Index:       i,
+					Address:     e.Withdrawer,
+					Type:        schema.AccountEventTypeWithdraw,
+					PoolID:      e.PoolID,
+					Timestamp:   tm,
+					Coins:       schema.CoinsFromSDK(e.WithdrawnCoins),
+				})
+			case liquiditytypes.EventTypeSwapTransacted:
+				e, err := event.DecodeSwapTransacted(evt)
 				if err != nil {
 					return nil, err
 				}
-				swapPrice, err := attrs.SwapPrice()
-				if err != nil {
-					return nil, err
+				if _, ok := ignoredAddresses[e.SwapRequester]; ok {
+					continue
 				}
+				addr, poolID := e.SwapRequester, e.PoolID
+				offerCoin, offerCoinFee, swapPrice := e.ExchangedOfferCoin, e.OfferCoinFee, e.SwapPrice
 				pool, ok := poolByID[poolID]
 				if !ok {
-					return nil, fmt.Errorf("pool id %d not found: %w", poolID, err)
+					return nil, fmt.Errorf("pool id %d not found", poolID)
 				}
-				demandCoinDenom, ok := oppositeReserveCoinDenom(pool, offerCoinFee.Denom)
+				demandCoinDenom, ok := event.OppositeReserveCoinDenom(pool, offerCoinFee.Denom)
 				if !ok {
 					return nil, fmt.Errorf("opposite reserve coin denom not found")
 				}
-				var demandCoinFee sdk.Coin
-				if offerCoinFee.Denom < demandCoinDenom {
-					demandCoinFee = sdk.NewCoin(demandCoinDenom, offerCoinFee.Amount.ToDec().Quo(swapPrice).TruncateInt())
-				} else {
-					demandCoinFee = sdk.NewCoin(demandCoinDenom, offerCoinFee.Amount.ToDec().Mul(swapPrice).TruncateInt())
-				}
+				demandCoin := e.DemandCoin(offerCoin, demandCoinDenom)
+				demandCoinFee := e.DemandCoin(offerCoinFee, demandCoinDenom)
 				st := updates.swapStatusByAddress.ActionStatus(addr)
 				st.IncreaseCount(poolID, dateKey, 1)
 				updates.swapVolumesByPoolID.Volumes(poolID).AddCoins(tm, schema.CoinMap{
-					offerCoinFee.Denom:  offerCoinFee.Amount.Int64(),
-					demandCoinFee.Denom: demandCoinFee.Amount.Int64(),
+					offerCoinFee.Denom:  schema.NewIntFromSDK(offerCoinFee.Amount),
+					demandCoinFee.Denom: schema.NewIntFromSDK(demandCoinFee.Amount),
+				})
+				updates.swapVolumeByPoolID.CoinMap(poolID).Add(schema.CoinMap{
+					offerCoin.Denom:  schema.NewIntFromSDK(offerCoin.Amount),
+					demandCoin.Denom: schema.NewIntFromSDK(demandCoin.Amount),
+				})
+				price, err := strconv.ParseFloat(swapPrice.String(), 64)
+				if err != nil {
+					return nil, fmt.Errorf("parse swap price: %w", err)
+				}
+				volumeX, volumeY := schema.NewIntFromSDK(offerCoin.Amount), schema.NewIntFromSDK(demandCoin.Amount)
+				if offerCoin.Denom != pool.ReserveCoinDenoms[0] {
+					volumeX, volumeY = volumeY, volumeX
+				}
+				for _, r := range t.cfg.CandleResolutions {
+					updates.candles.Candle(poolID, r, tm).Update(price, volumeX, volumeY)
+				}
+				updates.accountEvents = append(updates.accountEvents, schema.AccountEvent{
+					BlockHeight: blockHeight,
+					Index:       i,
+					Address:     addr,
+					Type:        schema.AccountEventTypeSwap,
+					PoolID:      poolID,
+					Timestamp:   tm,
+					Coins:       []schema.Coin{schema.CoinFromSDK(offerCoin), schema.CoinFromSDK(demandCoin)},
+					SwapPrice:   swapPrice.String(),
+					Fees:        []schema.Coin{schema.CoinFromSDK(offerCoinFee), schema.CoinFromSDK(demandCoinFee)},
 				})
 			}
 		}
+		if data.BankModuleState != nil && t.shouldTakePoolSnapshot(blockHeight, tm, lastSnapshotHeight, lastSnapshotTime) {
+			updates.poolSnapshots = append(updates.poolSnapshots, newPoolSnapshots(data, updates.swapVolumeByPoolID)...)
+			lastSnapshotHeight, lastSnapshotTime = blockHeight, tm
+		}
 		blockHeight++
+		if t.cfg.MaxBatchBlocks > 0 && blockHeight-startingBlockHeight >= t.cfg.MaxBatchBlocks {
+			break
+		}
+		if t.cfg.MaxBatchDuration > 0 && time.Since(started) >= t.cfg.MaxBatchDuration {
+			break
+		}
 	}
 	return updates, nil
 }
+
+// mergeBankModuleStates returns cur with the balances of the accounts
+// missing from it taken from prev.
+// Sources which only provide the balances of the accounts touched in a block
+// would otherwise lose the balances changed in the earlier blocks of a batch.
+func mergeBankModuleStates(prev, cur *banktypes.GenesisState) *banktypes.GenesisState {
+	if prev == nil {
+		return cur
+	}
+	addrs := make(map[string]struct{})
+	for _, b := range cur.Balances {
+		addrs[b.Address] = struct{}{}
+	}
+	merged := *cur
+	merged.Balances = append([]banktypes.Balance{}, cur.Balances...)
+	for _, b := range prev.Balances {
+		if _, ok := addrs[b.Address]; !ok {
+			merged.Balances = append(merged.Balances, b)
+		}
+	}
+	return &merged
+}
+
+func (t *Transformer) shouldTakePoolSnapshot(blockHeight int64, now time.Time, lastBlockHeight int64, lastTime time.Time) bool {
+	if !t.cfg.PoolSnapshotEnabled() {
+		return false
+	}
+	if lastBlockHeight == 0 {
+		return true
+	}
+	if t.cfg.PoolSnapshotBlockInterval > 0 && blockHeight-lastBlockHeight >= t.cfg.PoolSnapshotBlockInterval {
+		return true
+	}
+	if t.cfg.PoolSnapshotTimeInterval > 0 &&
+		!now.Truncate(t.cfg.PoolSnapshotTimeInterval).Equal(lastTime.Truncate(t.cfg.PoolSnapshotTimeInterval)) {
+		return true
+	}
+	return false
+}
+
+// newPoolSnapshots takes snapshots of every pool from the block data.
+// Swap volumes of the snapshots are relative to the start of current state updates.
+func newPoolSnapshots(data *BlockData, swapVolumeByPoolID CoinMapByPoolID) []schema.PoolSnapshot {
+	reserveAccAddrs := make(map[string]struct{})
+	for _, p := range data.Pools {
+		reserveAccAddrs[p.ReserveAccountAddress] = struct{}{}
+	}
+	balances := make(map[string]sdk.Coins)
+	for _, b := range data.BankModuleState.Balances {
+		if _, ok := reserveAccAddrs[b.Address]; ok {
+			balances[b.Address] = b.Coins
+		}
+	}
+	var snapshots []schema.PoolSnapshot
+	for _, p := range data.Pools {
+		var reserveCoins []schema.Coin
+		for _, denom := range p.ReserveCoinDenoms {
+			reserveCoins = append(reserveCoins, schema.Coin{
+				Denom:  denom,
+				Amount: schema.NewIntFromSDK(balances[p.ReserveAccountAddress].AmountOf(denom)),
+			})
+		}
+		price := 0.0
+		if len(reserveCoins) == 2 && reserveCoins[1].Amount.Sign() > 0 {
+			price = reserveCoins[0].Amount.Float64() / reserveCoins[1].Amount.Float64()
+		}
+		snapshots = append(snapshots, schema.PoolSnapshot{
+			BlockHeight:  data.Header.Height,
+			ID:           p.Id,
+			Timestamp:    data.Header.Time.UTC(),
+			ReserveCoins: reserveCoins,
+			PoolCoin: schema.Coin{
+				Denom:  p.PoolCoinDenom,
+				Amount: schema.NewIntFromSDK(data.BankModuleState.Supply.AmountOf(p.PoolCoinDenom)),
+			},
+			Price:      price,
+			SwapVolume: schema.MergeCoinMaps(swapVolumeByPoolID[p.Id]),
+		})
+	}
+	return snapshots
+}
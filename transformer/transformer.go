@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -22,16 +21,33 @@ import (
 var jsonit = jsoniter.ConfigCompatibleWithStandardLibrary
 
 type Transformer struct {
-	cfg    config.TransformerConfig
-	ss     *store.Service
-	logger *zap.Logger
+	cfg      config.TransformerConfig
+	ss       *store.Service
+	src      BlockSource
+	pipeline *blockDataPipeline
+	notifier BlockHeightNotifier
+	logger   *zap.Logger
 }
 
 func New(cfg config.TransformerConfig, ss *store.Service, logger *zap.Logger) (*Transformer, error) {
-	return &Transformer{cfg: cfg, ss: ss, logger: logger}, nil
+	src, err := NewBlockSource(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new block source: %w", err)
+	}
+	return &Transformer{cfg: cfg, ss: ss, src: src, logger: logger}, nil
+}
+
+func (t *Transformer) Config() config.TransformerConfig {
+	return t.cfg
 }
 
 func (t *Transformer) Run(ctx context.Context) error {
+	defer t.closeBlockDataPipeline()
+	if ok, err := t.ss.RollbackPendingCommit(ctx); err != nil {
+		return fmt.Errorf("roll back pending commit: %w", err)
+	} else if ok {
+		t.logger.Warn("rolled back the unfinished commit")
+	}
 	for {
 		t.logger.Debug("getting latest block height")
 		h, err := t.ss.LatestBlockHeight(ctx)
@@ -49,57 +65,29 @@ func (t *Transformer) Run(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("accumulate state updates: %w", err)
 		}
-		lastH := updates.lastBlockData.Header.Height
-		t.logger.Info("updating state", zap.Int64("from", h+1), zap.Int64("to", lastH))
-		if err := t.UpdateState(ctx, h, updates); err != nil {
-			return fmt.Errorf("update state: %w", err)
-		}
-		t.logger.Debug("updating latest block height", zap.Int64("height", lastH))
-		if err := t.ss.SetLatestBlockHeight(ctx, lastH); err != nil {
-			return fmt.Errorf("update latest block height: %w", err)
+		t.logger.Info("updating state", zap.Int64("from", h+1), zap.Int64("to", updates.lastBlockData.Header.Height))
+		if err := t.CommitState(ctx, h, updates); err != nil {
+			return fmt.Errorf("commit state: %w", err)
 		}
 	}
 }
 
 func (t *Transformer) PruneOutdatedStates(ctx context.Context, currentBlockHeight int64) error {
-	if err := t.ss.DeleteOutdatedAccountStatuses(ctx, currentBlockHeight); err != nil {
+	hs, err := t.ss.StateSnapshotBlockHeights(ctx)
+	if err != nil {
+		return fmt.Errorf("get state snapshot block heights: %w", err)
+	}
+	if err := t.ss.DeleteOutdatedAccountStatuses(ctx, currentBlockHeight, hs); err != nil {
 		return fmt.Errorf("delete outdated accounts: %w", err)
 	}
-	if err := t.ss.DeleteOutdatedPoolStatuses(ctx, currentBlockHeight); err != nil {
+	if err := t.ss.DeleteOutdatedPoolStatuses(ctx, currentBlockHeight, hs); err != nil {
 		return fmt.Errorf("delete outdated pools: %w", err)
 	}
 	return nil
 }
 
-func (t *Transformer) blockDataFilename(blockHeight int64) string {
-	bs := int64(t.cfg.BlockDataBucketSize)
-	p := blockHeight / bs * bs
-	return filepath.Join(t.cfg.BlockDataDir, fmt.Sprintf(t.cfg.BlockDataFilename, p, blockHeight))
-}
-
-type BlockDataDecodeError struct {
-	Err error
-}
-
-func (err *BlockDataDecodeError) Error() string {
-	return err.Err.Error()
-}
-
-func (err *BlockDataDecodeError) Unwrap() error {
-	return err.Err
-}
-
-func (t *Transformer) ReadBlockData(blockHeight int64) (*BlockData, error) {
-	f, err := os.Open(t.blockDataFilename(blockHeight))
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	var data BlockData
-	if err := jsonit.NewDecoder(f).Decode(&data); err != nil {
-		return nil, &BlockDataDecodeError{err}
-	}
-	return &data, nil
+func (t *Transformer) ReadBlockData(ctx context.Context, blockHeight int64) (*BlockData, error) {
+	return t.src.ReadBlockData(ctx, blockHeight)
 }
 
 func (t *Transformer) WaitForBlockData(ctx context.Context, blockHeight int64, timeout time.Duration) (*BlockData, error) {
@@ -114,10 +102,10 @@ func (t *Transformer) WaitForBlockData(ctx context.Context, blockHeight int64, t
 			return nil, ctx.Err()
 		default:
 		}
-		data, err := t.ReadBlockData(blockHeight)
+		data, err := t.ReadBlockData(ctx, blockHeight)
 		if err != nil {
 			var berr *BlockDataDecodeError
-			if !os.IsNotExist(err) && !errors.As(err, &berr) {
+			if !errors.Is(err, os.ErrNotExist) && !errors.As(err, &berr) {
 				//if !os.IsNotExist(err) {
 				return nil, fmt.Errorf("read block data: %w", err)
 			}
@@ -132,24 +120,154 @@ func (t *Transformer) WaitForBlockData(ctx context.Context, blockHeight int64, t
 	}
 }
 
-func (t *Transformer) UpdateState(ctx context.Context, currentBlockHeight int64, updates *StateUpdates) error {
-	eg, ctx2 := errgroup.WithContext(ctx)
-	eg.Go(func() error {
-		if err := t.UpdateAccountStatus(ctx2, currentBlockHeight, updates); err != nil {
-			return fmt.Errorf("update accounts: %w", err)
+// SetBlockHeightNotifier sets the notifier to be notified after each commit.
+func (t *Transformer) SetBlockHeightNotifier(n BlockHeightNotifier) {
+	t.notifier = n
+}
+
+// CommitState writes the state updates and advances the checkpoint atomically,
+// so that a restart never sees state written for blocks beyond the checkpoint.
+// Without a transaction, the commit is marked as pending until the checkpoint
+// advances, and Run rolls back a pending commit before anything else.
+// The notifier, if any, is notified of the new checkpoint after the commit.
+func (t *Transformer) CommitState(ctx context.Context, currentBlockHeight int64, updates *StateUpdates) error {
+	lastH := updates.lastBlockData.Header.Height
+	commit := func(ctx context.Context) error {
+		if err := t.UpdateState(ctx, currentBlockHeight, updates); err != nil {
+			return fmt.Errorf("update state: %w", err)
 		}
-		return nil
-	})
-	eg.Go(func() error {
-		if err := t.UpdatePoolStatus(ctx2, currentBlockHeight, updates); err != nil {
-			return fmt.Errorf("update pools: %w", err)
+		if t.shouldTakeStateSnapshot(currentBlockHeight, lastH) {
+			t.logger.Info("taking state snapshot", zap.Int64("height", lastH))
+			if err := t.ss.AddStateSnapshot(ctx, schema.StateSnapshot{
+				BlockHeight: lastH,
+				Timestamp:   updates.lastBlockData.Header.Time,
+			}, t.cfg.StateSnapshotRetention); err != nil {
+				return fmt.Errorf("add state snapshot: %w", err)
+			}
+		}
+		t.logger.Debug("updating latest block height", zap.Int64("height", lastH))
+		if err := t.ss.SetLatestBlockHeight(ctx, lastH); err != nil {
+			return fmt.Errorf("update latest block height: %w", err)
 		}
 		return nil
-	})
+	}
+	started := time.Now()
+	var err error
+	if t.cfg.UseTransaction {
+		err = t.ss.WithTransaction(ctx, commit)
+	} else {
+		if err := t.ss.SetPendingCommit(ctx, lastH, updates.firstBlockTime); err != nil {
+			return fmt.Errorf("set pending commit: %w", err)
+		}
+		err = commit(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	commitDuration.Observe(time.Since(started).Seconds())
+	blocksProcessed.Add(float64(lastH - currentBlockHeight))
+	batchSize.Observe(float64(lastH - currentBlockHeight))
+	latestBlockHeight.Set(float64(lastH))
+	lagSeconds.Set(time.Since(updates.lastBlockData.Header.Time).Seconds())
+	if t.notifier != nil {
+		// The server falls back to polling, so a failed notification is not fatal.
+		if err := t.notifier.NotifyBlockHeight(ctx, lastH); err != nil {
+			t.logger.Warn("failed to notify block height", zap.Int64("height", lastH), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (t *Transformer) shouldTakeStateSnapshot(currentBlockHeight, lastBlockHeight int64) bool {
+	if t.cfg.StateSnapshotInterval <= 0 {
+		return false
+	}
+	return lastBlockHeight/t.cfg.StateSnapshotInterval > currentBlockHeight/t.cfg.StateSnapshotInterval
+}
+
+// Rollback restores the state to the latest state snapshot taken at or below
+// the block height, and returns the snapshot's block height.
+// The transformer must not be running while rolling back.
+func (t *Transformer) Rollback(ctx context.Context, blockHeight int64) (int64, error) {
+	h, err := t.ss.LatestBlockHeight(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get latest block height: %w", err)
+	}
+	if blockHeight >= h {
+		return 0, fmt.Errorf("block height %d is not below the latest block height %d", blockHeight, h)
+	}
+	snapshot := &schema.StateSnapshot{}
+	if blockHeight > 0 {
+		snapshot, err = t.ss.LatestStateSnapshot(ctx, blockHeight)
+		if err != nil {
+			return 0, fmt.Errorf("get latest state snapshot: %w", err)
+		}
+		if snapshot == nil {
+			return 0, fmt.Errorf("no state snapshot at or below block height %d", blockHeight)
+		}
+	}
+	rollback := func(ctx context.Context) error {
+		return t.ss.Rollback(ctx, *snapshot)
+	}
+	if t.cfg.UseTransaction {
+		err = t.ss.WithTransaction(ctx, rollback)
+	} else {
+		err = rollback(ctx)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return snapshot.BlockHeight, nil
+}
+
+type stateUpdateStage struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (st stateUpdateStage) run(ctx context.Context) error {
+	started := time.Now()
+	if err := st.fn(ctx); err != nil {
+		return fmt.Errorf("%s: %w", st.name, err)
+	}
+	stageDuration.WithLabelValues(st.name).Observe(time.Since(started).Seconds())
+	return nil
+}
+
+func (t *Transformer) UpdateState(ctx context.Context, currentBlockHeight int64, updates *StateUpdates) error {
+	stages := []stateUpdateStage{
+		{"update accounts", func(ctx context.Context) error {
+			return t.UpdateAccountStatus(ctx, currentBlockHeight, updates)
+		}},
+		{"update pools", func(ctx context.Context) error {
+			return t.UpdatePoolStatus(ctx, currentBlockHeight, updates)
+		}},
+		{"update account events", func(ctx context.Context) error {
+			return t.UpdateAccountEvents(ctx, updates)
+		}},
+		{"update pool candles", func(ctx context.Context) error {
+			return t.UpdatePoolCandles(ctx, updates)
+		}},
+	}
 	if updates.lastBankModuleState != nil {
+		stages = append(stages, stateUpdateStage{"update balances and supplies", func(ctx context.Context) error {
+			return t.UpdateBalancesAndSupplies(ctx, updates)
+		}})
+	}
+	if mongo.SessionFromContext(ctx) != nil { // operations in a transaction must not run concurrently
+		for _, st := range stages {
+			if err := st.run(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	eg, ctx2 := errgroup.WithContext(ctx)
+	for _, st := range stages {
+		st := st
 		eg.Go(func() error {
-			if err := t.UpdateBalancesAndSupplies(ctx2, updates); err != nil {
-				return fmt.Errorf("update balances and supplies: %w", err)
+			if err := st.run(ctx2); err != nil {
+				return err
 			}
 			return nil
 		})
@@ -171,6 +289,9 @@ func (t *Transformer) UpdateAccountStatus(ctx context.Context, currentBlockHeigh
 	for addr := range updates.swapStatusByAddress {
 		addrsToUpdate[addr] = struct{}{}
 	}
+	for addr := range updates.withdrawStatusByAddress {
+		addrsToUpdate[addr] = struct{}{}
+	}
 	var writes []mongo.WriteModel
 	for addr := range addrsToUpdate {
 		if _, ok := reserveAccAddrs[addr]; ok {
@@ -186,6 +307,7 @@ func (t *Transformer) UpdateAccountStatus(ctx context.Context, currentBlockHeigh
 		}
 		accStatus.Deposits = schema.MergeAccountActionStatuses(accStatus.Deposits, updates.depositStatusByAddress[addr])
 		accStatus.Swaps = schema.MergeAccountActionStatuses(accStatus.Swaps, updates.swapStatusByAddress[addr])
+		accStatus.Withdrawals = schema.MergeAccountActionStatuses(accStatus.Withdrawals, updates.withdrawStatusByAddress[addr])
 		writes = append(writes,
 			mongo.NewUpdateOneModel().
 				SetFilter(bson.M{
@@ -193,8 +315,9 @@ func (t *Transformer) UpdateAccountStatus(ctx context.Context, currentBlockHeigh
 					schema.AccountStatusAddressKey:     addr,
 				}).
 				SetUpdate(bson.M{"$set": bson.M{
-					schema.AccountStatusDepositsKey: accStatus.Deposits,
-					schema.AccountStatusSwapsKey:    accStatus.Swaps,
+					schema.AccountStatusDepositsKey:    accStatus.Deposits,
+					schema.AccountStatusSwapsKey:       accStatus.Swaps,
+					schema.AccountStatusWithdrawalsKey: accStatus.Withdrawals,
 				}}).
 				SetUpsert(true))
 	}
@@ -225,8 +348,9 @@ func (t *Transformer) UpdateAccountStatus(ctx context.Context, currentBlockHeigh
 				schema.AccountStatusAddressKey:     accStatus.Address,
 			}).
 			SetUpdate(bson.M{"$set": bson.M{
-				schema.AccountStatusDepositsKey: accStatus.Deposits,
-				schema.AccountStatusSwapsKey:    accStatus.Swaps,
+				schema.AccountStatusDepositsKey:    accStatus.Deposits,
+				schema.AccountStatusSwapsKey:       accStatus.Swaps,
+				schema.AccountStatusWithdrawalsKey: accStatus.Withdrawals,
 			}}).
 			SetUpsert(true))
 	}
@@ -238,10 +362,30 @@ func (t *Transformer) UpdateAccountStatus(ctx context.Context, currentBlockHeigh
 	return nil
 }
 
+func (t *Transformer) UpdateAccountEvents(ctx context.Context, updates *StateUpdates) error {
+	var writes []mongo.WriteModel
+	for _, evt := range updates.accountEvents {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{
+				schema.AccountEventBlockHeightKey: evt.BlockHeight,
+				schema.AccountEventIndexKey:       evt.Index,
+			}).
+			SetReplacement(evt).
+			SetUpsert(true))
+	}
+	if len(writes) > 0 {
+		if _, err := t.ss.AccountEventCollection().BulkWrite(ctx, writes); err != nil {
+			return fmt.Errorf("bulk write: %w", err)
+		}
+	}
+	return nil
+}
+
 func (t *Transformer) UpdatePoolStatus(ctx context.Context, currentBlockHeight int64, updates *StateUpdates) error {
 	data := updates.lastBlockData
 	lastBlockHeight := data.Header.Height
-	var writes, writes2 []mongo.WriteModel
+	var writes, writes2, writes3 []mongo.WriteModel
+	swapVolumeBases := make(CoinMapByPoolID)
 	for _, p := range data.Pools {
 		var poolStatus schema.PoolStatus
 		if currentBlockHeight > 0 {
@@ -251,8 +395,10 @@ func (t *Transformer) UpdatePoolStatus(ctx context.Context, currentBlockHeight i
 				return fmt.Errorf("find pool: %w", err)
 			}
 		}
+		swapVolumeBases[p.Id] = poolStatus.SwapVolume
 		poolStatus.SwapFeeVolumes = schema.MergeVolumes(poolStatus.SwapFeeVolumes, updates.swapVolumesByPoolID[p.Id])
 		poolStatus.SwapFeeVolumes.RemoveOutdated(data.Header.Time.Add(-time.Hour))
+		poolStatus.SwapVolume = schema.MergeCoinMaps(poolStatus.SwapVolume, updates.swapVolumeByPoolID[p.Id])
 		writes = append(writes, mongo.NewUpdateOneModel().
 			SetFilter(bson.M{
 				schema.PoolStatusBlockHeightKey: lastBlockHeight,
@@ -261,6 +407,7 @@ func (t *Transformer) UpdatePoolStatus(ctx context.Context, currentBlockHeight i
 			SetUpdate(bson.M{
 				"$set": bson.M{
 					schema.PoolStatusSwapFeeVolumesKey: poolStatus.SwapFeeVolumes,
+					schema.PoolStatusSwapVolumeKey:     poolStatus.SwapVolume,
 				},
 			}).
 			SetUpsert(true))
@@ -287,6 +434,49 @@ func (t *Transformer) UpdatePoolStatus(ctx context.Context, currentBlockHeight i
 			return fmt.Errorf("bulk write: %w", err)
 		}
 	}
+	for _, snapshot := range updates.poolSnapshots {
+		snapshot.SwapVolume = schema.MergeCoinMaps(swapVolumeBases[snapshot.ID], snapshot.SwapVolume)
+		writes3 = append(writes3, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{
+				schema.PoolSnapshotBlockHeightKey: snapshot.BlockHeight,
+				schema.PoolSnapshotIDKey:          snapshot.ID,
+			}).
+			SetReplacement(snapshot).
+			SetUpsert(true))
+	}
+	if len(writes3) > 0 {
+		if _, err := t.ss.PoolSnapshotCollection().BulkWrite(ctx, writes3); err != nil {
+			return fmt.Errorf("bulk write: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *Transformer) UpdatePoolCandles(ctx context.Context, updates *StateUpdates) error {
+	var writes []mongo.WriteModel
+	for _, c := range updates.candles {
+		candle, err := t.ss.PoolCandle(ctx, c.ID, c.Resolution, c.Timestamp)
+		if err != nil {
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				return fmt.Errorf("find pool candle: %w", err)
+			}
+			candle = schema.PoolCandle{ID: c.ID, Resolution: c.Resolution, Timestamp: c.Timestamp}
+		}
+		candle.Merge(*c)
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{
+				schema.PoolCandleIDKey:         c.ID,
+				schema.PoolCandleResolutionKey: c.Resolution,
+				schema.PoolCandleTimestampKey:  c.Timestamp,
+			}).
+			SetReplacement(candle).
+			SetUpsert(true))
+	}
+	if len(writes) > 0 {
+		if _, err := t.ss.PoolCandleCollection().BulkWrite(ctx, writes); err != nil {
+			return fmt.Errorf("bulk write: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -324,7 +514,7 @@ func (t *Transformer) UpdateBalancesAndSupplies(ctx context.Context, updates *St
 			SetUpdate(bson.M{
 				"$set": bson.M{
 					schema.SupplyBlockHeightKey: lastBankModuleStateHeight,
-					schema.SupplyAmountKey:      c.Amount.Int64(),
+					schema.SupplyAmountKey:      schema.NewIntFromSDK(c.Amount),
 				},
 			}).
 			SetUpsert(true))
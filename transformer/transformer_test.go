@@ -0,0 +1,280 @@
+package transformer
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/stretchr/testify/require"
+	liquiditytypes "github.com/tendermint/liquidity/x/liquidity/types"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"github.com/b-harvest/gravity-dex-backend/config"
+	"github.com/b-harvest/gravity-dex-backend/schema"
+	"github.com/b-harvest/gravity-dex-backend/service/store"
+)
+
+func newTestTransformer(t *testing.T, cfg config.TransformerConfig) (*Transformer, *store.Service) {
+	ctx := context.Background()
+
+	uri := os.Getenv("GDEX_TEST_MONGODB_URI")
+	if uri == "" {
+		uri = config.DefaultMongoDBConfig.URI
+	}
+	mc, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	t.Cleanup(func() { mc.Disconnect(ctx) })
+	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if err := mc.Ping(pingCtx, nil); err != nil {
+		t.Skipf("mongodb is not available: %v", err)
+	}
+
+	cfg.Store.DB = "test"
+	ss := store.NewService(cfg.Store, mc)
+	if cfg.UseTransaction {
+		ok, err := ss.SupportsTransactions(ctx)
+		require.NoError(t, err)
+		if !ok {
+			t.Skip("mongodb does not support transactions")
+		}
+	}
+	require.NoError(t, ss.Database().Drop(ctx))
+	_, err = ss.EnsureDBIndexes(ctx)
+	require.NoError(t, err)
+
+	tr, err := New(cfg, ss, zap.NewNop())
+	require.NoError(t, err)
+	return tr, ss
+}
+
+// newTestStateUpdates returns state updates which write to every collection
+// updated by UpdateState.
+func newTestStateUpdates(blockHeight int64, addr string) *StateUpdates {
+	updates := newStateUpdates()
+	now := time.Date(2021, time.May, 4, 0, 0, int(blockHeight), 0, time.UTC)
+	updates.firstBlockTime = now
+	updates.lastBlockData = &BlockData{
+		Header: tmproto.Header{Height: blockHeight, Time: now},
+		Pools:  []liquiditytypes.Pool{{Id: 1, ReserveCoinDenoms: []string{"uatom", "uusd"}, PoolCoinDenom: "pool1"}},
+	}
+	updates.lastBankModuleStateHeight = blockHeight
+	updates.lastBankModuleState = &banktypes.GenesisState{
+		Balances: []banktypes.Balance{{Address: addr, Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 1))}},
+		Supply:   sdk.NewCoins(sdk.NewInt64Coin("uatom", 1)),
+	}
+	st := updates.depositStatusByAddress.ActionStatus(addr)
+	st.IncreaseCount(1, "2021-05-04", 1)
+	updates.accountEvents = append(updates.accountEvents, schema.AccountEvent{
+		BlockHeight: blockHeight,
+		Address:     addr,
+		Type:        schema.AccountEventTypeDeposit,
+		PoolID:      1,
+		Timestamp:   now,
+	})
+	updates.candles.Candle(1, time.Minute, now)
+	return updates
+}
+
+type blockHeightRecorder []int64
+
+func (r *blockHeightRecorder) NotifyBlockHeight(_ context.Context, blockHeight int64) error {
+	*r = append(*r, blockHeight)
+	return nil
+}
+
+// rejectWrites makes every write to the collection fail, by setting a validator
+// no document can pass.
+func rejectWrites(t *testing.T, coll *mongo.Collection) {
+	setValidator(t, coll, bson.M{"_id": bson.M{"$exists": false}})
+}
+
+// setValidator makes writes of documents which do not match the validator fail.
+func setValidator(t *testing.T, coll *mongo.Collection, validator bson.M) {
+	err := coll.Database().RunCommand(context.Background(), bson.D{
+		{"collMod", coll.Name()},
+		{"validator", validator},
+	}).Err()
+	require.NoError(t, err)
+}
+
+func TestTransformer_CommitState(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultTransformerConfig
+	cfg.UseTransaction = true
+
+	for _, x := range []struct {
+		stage string
+		coll  func(ss *store.Service) *mongo.Collection
+	}{
+		{"update accounts", (*store.Service).AccountStatusCollection},
+		{"update pools", (*store.Service).PoolStatusCollection},
+		{"update account events", (*store.Service).AccountEventCollection},
+		{"update pool candles", (*store.Service).PoolCandleCollection},
+		{"update balances and supplies", (*store.Service).SupplyCollection},
+		{"update latest block height", (*store.Service).CheckpointCollection},
+	} {
+		tr, ss := newTestTransformer(t, cfg)
+		var notified blockHeightRecorder
+		tr.SetBlockHeightNotifier(&notified)
+		rejectWrites(t, x.coll(ss))
+
+		err := tr.CommitState(ctx, 0, newTestStateUpdates(10, "addr1"))
+		require.Error(t, err, x.stage)
+		require.Contains(t, err.Error(), x.stage)
+		require.Empty(t, notified, x.stage)
+
+		h, err := ss.LatestBlockHeight(ctx)
+		require.NoError(t, err)
+		require.EqualValues(t, 0, h, x.stage)
+		for _, coll := range []*mongo.Collection{
+			ss.AccountStatusCollection(),
+			ss.PoolStatusCollection(),
+			ss.AccountEventCollection(),
+			ss.PoolCandleCollection(),
+			ss.BalanceCollection(),
+			ss.SupplyCollection(),
+		} {
+			n, err := coll.CountDocuments(ctx, bson.M{})
+			require.NoError(t, err)
+			require.EqualValues(t, 0, n, "%s: %s", x.stage, coll.Name())
+		}
+	}
+
+	tr, ss := newTestTransformer(t, cfg)
+	var notified blockHeightRecorder
+	tr.SetBlockHeightNotifier(&notified)
+	require.NoError(t, tr.CommitState(ctx, 0, newTestStateUpdates(10, "addr1")))
+	require.Equal(t, blockHeightRecorder{10}, notified)
+
+	h, err := ss.LatestBlockHeight(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, h)
+	accStatus, err := ss.AccountStatus(ctx, 10, "addr1")
+	require.NoError(t, err)
+	require.Equal(t, 1, accStatus.Deposits.CountByPoolID[1])
+}
+
+func TestTransformer_CommitState_WithoutTransaction(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultTransformerConfig
+	cfg.UseTransaction = false
+	tr, ss := newTestTransformer(t, cfg)
+
+	newUpdates := func() *StateUpdates {
+		updates := newTestStateUpdates(10, "addr1")
+		c := updates.candles.Candle(1, time.Minute, updates.lastBlockData.Header.Time)
+		c.Update(2, schema.NewInt(10), schema.NewInt(20))
+		return updates
+	}
+
+	// Every stage is written, but the checkpoint, which clears the pending commit, is not.
+	setValidator(t, ss.CheckpointCollection(), bson.M{schema.CheckpointPendingBlockHeightKey: bson.M{"$exists": true}})
+	err := tr.CommitState(ctx, 0, newUpdates())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "update latest block height")
+	setValidator(t, ss.CheckpointCollection(), bson.M{})
+	cp, err := ss.Checkpoint(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, cp.BlockHeight)
+	require.EqualValues(t, 10, cp.PendingBlockHeight)
+
+	// Replaying the batch after rolling back the pending commit does not count it twice.
+	ok, err := ss.RollbackPendingCommit(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, tr.CommitState(ctx, 0, newUpdates()))
+	ok, err = ss.RollbackPendingCommit(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	h, err := ss.LatestBlockHeight(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, h)
+	candle, err := ss.PoolCandle(ctx, 1, 60, time.Date(2021, time.May, 4, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, 1, candle.NumSwaps)
+	require.Equal(t, "10", candle.VolumeX.String())
+	n, err := ss.AccountEventCollection().CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+}
+
+func TestTransformer_Rollback(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultTransformerConfig
+	cfg.StateSnapshotInterval = 10
+	tr, ss := newTestTransformer(t, cfg)
+
+	var h int64
+	for _, x := range []struct {
+		blockHeight int64
+		addr        string
+	}{
+		{5, "addr1"},
+		{12, "addr2"},
+		{18, "addr3"},
+		{25, "addr4"},
+	} {
+		require.NoError(t, tr.PruneOutdatedStates(ctx, h))
+		require.NoError(t, tr.CommitState(ctx, h, newTestStateUpdates(x.blockHeight, x.addr)))
+		h = x.blockHeight
+	}
+
+	hs, err := ss.StateSnapshotBlockHeights(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int64{12, 25}, hs)
+
+	_, err = tr.Rollback(ctx, 11)
+	require.Error(t, err)
+
+	h, err = tr.Rollback(ctx, 20)
+	require.NoError(t, err)
+	require.EqualValues(t, 12, h)
+
+	cp, err := ss.Checkpoint(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 12, cp.BlockHeight)
+	require.EqualValues(t, 25, cp.RolledBackFrom)
+	n, err := ss.AccountStatusCollection().CountDocuments(ctx, bson.M{
+		schema.AccountStatusBlockHeightKey: 12,
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+	n, err = ss.AccountStatusCollection().CountDocuments(ctx, bson.M{
+		schema.AccountStatusBlockHeightKey: bson.M{"$gt": 12},
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 0, n)
+}
+
+func TestMergeBankModuleStates(t *testing.T) {
+	prev := &banktypes.GenesisState{
+		Balances: []banktypes.Balance{
+			{Address: "addr1", Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 100))},
+			{Address: "addr2", Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 200))},
+		},
+		Supply: sdk.NewCoins(sdk.NewInt64Coin("uatom", 300)),
+	}
+	cur := &banktypes.GenesisState{
+		Balances: []banktypes.Balance{
+			{Address: "addr2", Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 150))},
+		},
+		Supply: sdk.NewCoins(sdk.NewInt64Coin("uatom", 250)),
+	}
+	require.Same(t, cur, mergeBankModuleStates(nil, cur))
+	merged := mergeBankModuleStates(prev, cur)
+	require.Equal(t, cur.Supply, merged.Supply)
+	require.Equal(t, []banktypes.Balance{
+		{Address: "addr2", Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 150))},
+		{Address: "addr1", Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 100))},
+	}, merged.Balances)
+	require.Len(t, cur.Balances, 1)
+}
@@ -1,6 +1,11 @@
 package util
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 func NewImmediateTicker(d time.Duration) *time.Ticker {
 	t := time.NewTicker(d)
@@ -25,9 +30,37 @@ func StringInSlice(s string, ss []string) bool {
 	return false
 }
 
+func DurationInSlice(d time.Duration, ds []time.Duration) bool {
+	for _, x := range ds {
+		if d == x {
+			return true
+		}
+	}
+	return false
+}
+
 func MinInt(a, b int) int {
 	if a < b {
 		return a
 	}
 	return b
 }
+
+func MaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// ParseDuration is like time.ParseDuration, but also accepts days like "1d".
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
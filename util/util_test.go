@@ -0,0 +1,36 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	for _, tc := range []struct {
+		s   string
+		d   time.Duration
+		err bool
+	}{
+		{"1d", 24 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"1h", time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"1d12h", 0, true},
+		{"", 0, true},
+		{"abc", 0, true},
+	} {
+		d, err := ParseDuration(tc.s)
+		if tc.err {
+			require.Error(t, err, tc.s)
+		} else {
+			require.NoError(t, err, tc.s)
+			require.Equal(t, tc.d, d, tc.s)
+		}
+	}
+}